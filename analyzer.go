@@ -77,6 +77,8 @@ type Analyzer struct {
 	litmaps   []map[string]int
 	nodeCount []int
 
+	options MatchOptions
+
 	mu sync.RWMutex
 }
 
@@ -229,9 +231,16 @@ func (this *stackAnalyzerNode) String() string {
 }
 
 func NewAnalyzer() *Analyzer {
+	return NewAnalyzerWithOptions(DefaultMatchOptions())
+}
+
+// NewAnalyzerWithOptions returns an analyzer that compares the literals of the
+// messages as set by the options, the same way a parser with these options would.
+func NewAnalyzerWithOptions(options MatchOptions) *Analyzer {
 	tree := &Analyzer{
-		root: newAnalyzerNode(),
-		leaf: newAnalyzerNode(),
+		root:    newAnalyzerNode(),
+		leaf:    newAnalyzerNode(),
+		options: options,
 	}
 
 	tree.root.level = -1
@@ -266,6 +275,11 @@ func (this *Analyzer) Analyze(seq Sequence) (Sequence, error) {
 
 	for i, n := range path {
 		n.Token.Value, n.Token.isKey, n.Token.isValue = seq[i].Value, seq[i].isKey, seq[i].isValue
+		// the time stamps of a node can be of different units, the message gives the one
+		// of its pattern
+		if n.Token.Type == TokenTime && seq[i].Type == TokenTime && isEpochSubtype(seq[i].Special) {
+			n.Token.Special = seq[i].Special
+		}
 		seq2 = append(seq2, n.Token)
 	}
 
@@ -349,15 +363,12 @@ func (this *Analyzer) Add(seq Sequence) error {
 			// if the tag type is unknown, and the token type is literal or plain text, that
 			// means this is some type of string we parsed from the message.
 			//if we are marking spaces then " literal" and "literal" need to be stored as different tokens
-			space := ""
-			if token.IsSpaceBefore {
-				space = " "
-			}
+			key := this.literalKey(token)
 			// If we have gotten here, it means we found a string that we cannot
 			// determine if it's a fixed literal, or a changing variable. So we have
 			// to keep this in the literal map to track it.
 			// If we have seen this literal before, then there's already a node
-			if j, ok := this.litmaps[i][space+token.Value]; ok {
+			if j, ok := this.litmaps[i][key]; ok {
 				foundNode = this.levels[i][j]
 			} else {
 				// Otherwise we create a new node for this first time literal,
@@ -372,7 +383,7 @@ func (this *Analyzer) Add(seq Sequence) error {
 				foundNode.Tag = TagUnknown
 				//when adding to this map we must add the space before if it is marked true,
 				// or we get incorrect patterns
-				this.litmaps[i][space+foundNode.Value] = foundNode.index
+				this.litmaps[i][key] = foundNode.index
 				foundNode.isKey = token.isKey
 				foundNode.isSpaceBefore = token.IsSpaceBefore
 			}
@@ -616,7 +627,7 @@ func (this *Analyzer) compact() error {
 					cur.index = len(newLevels[i]) - 1
 
 					if cur.Type == TokenLiteral {
-						newmaps[i][cur.Value] = cur.index
+						newmaps[i][this.literalKey(cur.Token)] = cur.index
 					}
 				}
 			}
@@ -750,7 +761,12 @@ func (this *Analyzer) analyzeMessage(seq Sequence) ([]*analyzerNode, error) {
 					// technically a string.
 					toVisit = append(toVisit, stackAnalyzerNode{node, cur.level + 1, cur.score + partialMatchWeight})
 
-				case node.Type == TokenLiteral && token.Type == TokenLiteral && node.Value == token.Value:
+				case node.Type == TokenString && token.Type.isText():
+					// uuids, hex numbers, paths and quantities are words too, so
+					// it is also a partial match.
+					toVisit = append(toVisit, stackAnalyzerNode{node, cur.level + 1, cur.score + partialMatchWeight})
+
+				case node.Type == TokenLiteral && token.Type == TokenLiteral && this.sameLiteral(node, token):
 					// If the parse node and token are both literal type, then the
 					// value must also match. If matched, then let's add to the stack
 					// for visiting.
@@ -774,6 +790,30 @@ func (this *Analyzer) analyzeMessage(seq Sequence) ([]*analyzerNode, error) {
 	return nil, ErrNoMatch
 }
 
+// literalKey returns the key of a literal in the literal maps of the levels. The
+// spaces are always part of the key, so the patterns can be rebuilt with them.
+func (this *Analyzer) literalKey(token Token) string {
+	v := token.Value
+	if this.options.CaseInsensitive {
+		v = strings.ToLower(v)
+	}
+	if token.IsSpaceBefore {
+		v = " " + v
+	}
+	return v
+}
+
+// sameLiteral returns true if the literal token of a message matches the literal node.
+func (this *Analyzer) sameLiteral(node *analyzerNode, token Token) bool {
+	if this.options.StrictSpacing && node.isSpaceBefore != token.IsSpaceBefore {
+		return false
+	}
+	if this.options.CaseInsensitive {
+		return strings.EqualFold(node.Value, token.Value)
+	}
+	return node.Value == token.Value
+}
+
 func (this *Analyzer) dump() int {
 	total := 0
 	for i, l := range this.levels {
@@ -847,6 +887,49 @@ func markSequenceKV(seq Sequence) Sequence {
 	return seq
 }
 
+// hostOrEmail returns TokenEmail or TokenHost if the literal ends with an effective
+// top level domain and is an email address or a host name, TokenLiteral otherwise.
+func hostOrEmail(value string) TokenType {
+	if etld.Match(value) > 0 {
+		return hostOrEmailSyntax(value)
+	}
+	return TokenLiteral
+}
+
+// hostOrEmailSyntax returns TokenEmail or TokenHost if the literal is written as an
+// email address or a dotted host name, TokenLiteral otherwise. The domain is not
+// checked, as the parser matches the values of the patterns that expect them.
+func hostOrEmailSyntax(value string) TokenType {
+	t := TokenHost
+	if i := strings.IndexByte(value, '@'); i >= 0 {
+		if i == 0 || strings.ContainsAny(value[:i], " \"\t<>()[],;:") {
+			return TokenLiteral
+		}
+		value, t = value[i+1:], TokenEmail
+	}
+
+	labels := strings.Split(value, ".")
+	if len(labels) < 2 {
+		return TokenLiteral
+	}
+	for _, l := range labels {
+		if l == "" || l[0] == '-' || l[len(l)-1] == '-' {
+			return TokenLiteral
+		}
+		for _, r := range l {
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' {
+				return TokenLiteral
+			}
+		}
+	}
+
+	// a top level domain is not a number, or it is an ip address
+	if strings.IndexFunc(labels[len(labels)-1], unicode.IsLetter) < 0 {
+		return TokenLiteral
+	}
+	return t
+}
+
 func analyzeSequence(seq Sequence) Sequence {
 	l := len(seq)
 	var fexists = make([]bool, TagTypesCount)
@@ -854,10 +937,6 @@ func analyzeSequence(seq Sequence) Sequence {
 	defer func() {
 		// Step 7: try to see if we can find any srcport and dstport tags
 		for i, tok := range seq {
-			if tok.Type == token__host__ || tok.Type == token__email__ {
-				seq[i].Type = TokenString
-			}
-
 			if i < l-2 && tok.Type == TokenIPv4 && (seq[i+1].Value == "/" || seq[i+1].Value == ":") &&
 				seq[i+2].Type == TokenInteger {
 
@@ -904,19 +983,12 @@ func analyzeSequence(seq Sequence) Sequence {
 		}
 	}
 
-	// Step 2: try to recognize emails and host names
+	// Step 2: try to recognize emails and host names, the variable strings of
+	// the tree are checked too as they hold the value of the message
 	for i, tok := range seq {
-		if tok.Type == TokenLiteral && tok.Tag == TagUnknown {
-			//seq[i].Value = strings.ToLower(tok.Value)
-
-			// Matching a effective top level domain
-			if etld.Match(tok.Value) > 0 {
-				// Matching an email address
-				if strings.Index(tok.Value, "@") > 0 {
-					seq[i].Type = token__email__
-				} else if strings.Index(tok.Value, ".") > 0 {
-					seq[i].Type = token__host__
-				}
+		if (tok.Type == TokenLiteral || tok.Type == TokenString) && tok.Tag == TagUnknown {
+			if t := hostOrEmail(tok.Value); t != TokenLiteral {
+				seq[i].Type = t
 			}
 		}
 	}
@@ -933,7 +1005,7 @@ func analyzeSequence(seq Sequence) Sequence {
 	// - "Oct 11 22:14:15 mymachine su: ..."
 	// - "Aug 24 05:34:00 CST 1987 mymachine myproc[10]: ..."
 	if len(seq) >= 6 && seq[0].Type == TokenInteger && seq[1].Type == TokenTime &&
-		(seq[2].Type == TokenIPv4 || seq[2].Type == TokenIPv6 || seq[2].Type == token__host__ || seq[2].Type == TokenLiteral || seq[2].Type == TokenString) &&
+		(seq[2].Type == TokenIPv4 || seq[2].Type == TokenIPv6 || seq[2].Type == TokenHost || seq[2].Type == TokenLiteral || seq[2].Type == TokenString) &&
 		seq[3].Type == TokenLiteral &&
 		(seq[4].Type == TokenInteger || (seq[4].Type == TokenLiteral && seq[4].Value == "-")) &&
 		(seq[5].Type == TokenLiteral) {
@@ -951,7 +1023,7 @@ func analyzeSequence(seq Sequence) Sequence {
 		case TokenIPv4:
 			seq[2].Tag = TagAppIP
 
-		case token__host__, TokenLiteral, TokenString:
+		case TokenHost, TokenLiteral, TokenString:
 			seq[2].Tag = TagAppHost
 		}
 
@@ -973,7 +1045,7 @@ func analyzeSequence(seq Sequence) Sequence {
 		seq[5].Type = seq[5].Tag.TokenType()
 		fexists[seq[5].Tag] = true
 	} else if len(seq) >= 4 && seq[0].Type == TokenTime &&
-		(seq[1].Type == TokenIPv4 || seq[1].Type == TokenIPv6 || seq[1].Type == token__host__ || seq[1].Type == TokenLiteral || seq[1].Type == TokenString) &&
+		(seq[1].Type == TokenIPv4 || seq[1].Type == TokenIPv6 || seq[1].Type == TokenHost || seq[1].Type == TokenLiteral || seq[1].Type == TokenString) &&
 		(seq[2].Type == TokenLiteral || seq[2].Type == TokenString) &&
 		(seq[3].Type == TokenLiteral && seq[3].Value == ":") {
 
@@ -990,7 +1062,7 @@ func analyzeSequence(seq Sequence) Sequence {
 		case TokenIPv4:
 			seq[1].Tag = TagAppIP
 
-		case token__host__, TokenLiteral, TokenString:
+		case TokenHost, TokenLiteral, TokenString:
 			seq[1].Tag = TagAppHost
 		}
 
@@ -1002,7 +1074,7 @@ func analyzeSequence(seq Sequence) Sequence {
 		seq[2].Type = seq[2].Tag.TokenType()
 		fexists[seq[2].Tag] = true
 	} else if len(seq) >= 7 && seq[0].Type == TokenTime &&
-		(seq[1].Type == TokenIPv4 || seq[1].Type == TokenIPv6 || seq[1].Type == token__host__ || seq[1].Type == TokenLiteral || seq[1].Type == TokenString) &&
+		(seq[1].Type == TokenIPv4 || seq[1].Type == TokenIPv6 || seq[1].Type == TokenHost || seq[1].Type == TokenLiteral || seq[1].Type == TokenString) &&
 		(seq[2].Type == TokenLiteral || seq[2].Type == TokenString) &&
 		(seq[3].Type == TokenLiteral && seq[3].Value == "[") &&
 		(seq[4].Type == TokenInteger) &&
@@ -1022,7 +1094,7 @@ func analyzeSequence(seq Sequence) Sequence {
 		case TokenIPv4:
 			seq[1].Tag = TagAppIP
 
-		case token__host__, TokenLiteral, TokenString:
+		case TokenHost, TokenLiteral, TokenString:
 			seq[1].Tag = TagAppHost
 		}
 
@@ -1039,7 +1111,7 @@ func analyzeSequence(seq Sequence) Sequence {
 		seq[4].Type = seq[4].Tag.TokenType()
 		fexists[seq[4].Tag] = true
 	} else if len(seq) >= 7 && seq[0].Type == TokenTime &&
-		(seq[1].Type == TokenIPv4 || seq[1].Type == TokenIPv6 || seq[1].Type == token__host__ || seq[1].Type == TokenLiteral || seq[1].Type == TokenString) &&
+		(seq[1].Type == TokenIPv4 || seq[1].Type == TokenIPv6 || seq[1].Type == TokenHost || seq[1].Type == TokenLiteral || seq[1].Type == TokenString) &&
 		seq[2].Value == "last" {
 
 		// "jan 12 06:49:56 irc last message repeated 6 times"
@@ -1055,7 +1127,7 @@ func analyzeSequence(seq Sequence) Sequence {
 		case TokenIPv4:
 			seq[1].Tag = TagAppIP
 
-		case token__host__, TokenLiteral, TokenString:
+		case TokenHost, TokenLiteral, TokenString:
 			seq[1].Tag = TagAppHost
 		}
 
@@ -1095,7 +1167,7 @@ LOOP:
 				// This is a specific type, so match the type, within the next 2 tokens
 				// away, not counting single character non-a-zA-Z tokens.
 				for k := i + 1; k < l && j < distance; k++ {
-					if !fexists[f] && seq[k].Tag == TagUnknown && f.TokenType() == seq[k].Type && !seq[k].isKey {
+					if !fexists[f] && seq[k].Tag == TagUnknown && f.TokenType().accepts(seq[k].Type) && !seq[k].isKey {
 						seq[k].Tag = f
 						seq[k].Type = seq[k].Tag.TokenType()
 						fexists[seq[k].Tag] = true
@@ -1131,8 +1203,8 @@ LOOP:
 				case TagSrcHost, TagDstHost, TagSrcEmail, TagDstEmail:
 					for k := i + 1; k < l && k < i+distance; k++ {
 						if !fexists[f] && seq[k].Tag == TagUnknown && !seq[k].isKey &&
-							(seq[k].Type == token__host__ && (f == TagSrcHost || f == TagDstHost)) ||
-							(seq[k].Type == token__email__ && (f == TagSrcEmail || f == TagDstEmail)) {
+							(seq[k].Type == TokenHost && (f == TagSrcHost || f == TagDstHost)) ||
+							(seq[k].Type == TokenEmail && (f == TagSrcEmail || f == TagDstEmail)) {
 
 							seq[k].Tag = f
 							seq[k].Type = seq[k].Tag.TokenType()
@@ -1240,7 +1312,7 @@ LOOP:
 					fexists[TagDstIP] = true
 				}
 
-			case token__host__:
+			case TokenHost:
 				if !fexists[TagSrcHost] {
 					seq[i].Tag = TagSrcHost
 					seq[i].Type = seq[i].Tag.TokenType()
@@ -1251,7 +1323,7 @@ LOOP:
 					fexists[TagDstHost] = true
 				}
 
-			case token__email__:
+			case TokenEmail:
 				if !fexists[TagSrcEmail] {
 					seq[i].Tag = TagSrcEmail
 					seq[i].Type = seq[i].Tag.TokenType()
@@ -17,6 +17,7 @@ package sequence
 import (
 	"fmt"
 	"github.com/stretchr/testify/require"
+	"regexp"
 	"testing"
 )
 
@@ -252,3 +253,213 @@ func TestAnalyzerMatchPatterns(t *testing.T) {
 		}
 	}
 }
+
+func TestAnalyzerMatchOptions(t *testing.T) {
+	scanner := NewScanner()
+	var pos []int
+
+	msgs := []string{
+		"Queue flushed",
+		"queue flushed",
+	}
+
+	// the literals that only differ by case are the same literal when the case
+	// is ignored, rather than a variable string
+	for _, tc := range []struct {
+		options  MatchOptions
+		literals int
+		pattern  string
+	}{
+		{MatchOptions{}, 2, "%string% flushed"},
+		{MatchOptions{CaseInsensitive: true}, 1, "QUEUE flushed"},
+	} {
+		atree := NewAnalyzerWithOptions(tc.options)
+		for _, msg := range msgs {
+			seq, _, err := scanner.Scan(msg, false, pos)
+			require.NoError(t, err)
+			require.NoError(t, atree.Add(seq), msg)
+		}
+		require.Len(t, atree.litmaps[0], tc.literals)
+
+		atree.Finalize()
+
+		seq, _, err := scanner.Scan("QUEUE flushed", false, pos)
+		require.NoError(t, err)
+		seq, err = atree.Analyze(seq)
+		require.NoError(t, err)
+		r, _ := seq.String()
+		require.Equal(t, tc.pattern, r)
+	}
+}
+
+func TestAnalyzerQuantities(t *testing.T) {
+	scanner := NewScanner()
+	atree := NewAnalyzer()
+	var pos []int
+
+	// the quantities have the same type whatever their unit, so 153ms and 2s are
+	// at the same position of the tree
+	msgs := []string{
+		"Queue flushed in 153ms",
+		"Queue flushed in 2s",
+		"Queue flushed in 1h30m",
+	}
+	for _, msg := range msgs {
+		seq, _, err := scanner.Scan(msg, false, pos)
+		require.NoError(t, err)
+		require.NoError(t, atree.Add(seq), msg)
+	}
+	atree.Finalize()
+
+	var patterns []string
+	for _, msg := range msgs {
+		seq, _, err := scanner.Scan(msg, false, pos)
+		require.NoError(t, err)
+		seq, err = atree.Analyze(seq)
+		require.NoError(t, err)
+		r, _ := seq.String()
+		patterns = append(patterns, r)
+	}
+	require.Equal(t, []string{"Queue flushed in %timespan%", "Queue flushed in %timespan%", "Queue flushed in %timespan%"}, patterns)
+}
+
+func TestAnalyzerEpoch(t *testing.T) {
+	defer ReadConfig("sequence.toml")
+	require.NoError(t, readTestConfig("", testEpochWindow("2023-01-01", "2027-01-01")...))
+
+	scanner := NewScanner()
+	atree := NewAnalyzer()
+	var pos []int
+
+	// the epoch time stamps are tagged with their unit, so the exporters parse
+	// them with the right number of digits
+	msgs := []string{
+		"job 42 finished at 1697612345 with status ok",
+		"job 43 finished at 1697612399 with status ok",
+		"job 44 finished at 1697612345123 with status ok",
+	}
+	for _, msg := range msgs {
+		seq, _, err := scanner.Scan(msg, false, pos)
+		require.NoError(t, err)
+		require.NoError(t, atree.Add(seq), msg)
+	}
+	atree.Finalize()
+
+	var patterns []string
+	for _, msg := range msgs {
+		seq, _, err := scanner.Scan(msg, false, pos)
+		require.NoError(t, err)
+		seq, err = atree.Analyze(seq)
+		require.NoError(t, err)
+		r, _ := seq.String()
+		patterns = append(patterns, r)
+	}
+	require.Equal(t, []string{
+		"job %integer% %action% at %msgtime:epoch% with status ok",
+		"job %integer% %action% at %msgtime:epoch% with status ok",
+		"job %integer% %action% at %msgtime:epochms% with status ok",
+	}, patterns)
+}
+
+func TestAnalyzerHostEmail(t *testing.T) {
+	scanner := NewScanner()
+	atree := NewAnalyzer()
+	var pos []int
+
+	// the host names and email addresses keep their types, and the tags of these
+	// types are given to them
+	msgs := []string{
+		"mail relayed from mx1.example.com for bob@example.org via gw.example.net",
+		"mail relayed from mx2.example.net for alice@example.com via gw.example.org",
+	}
+	for _, msg := range msgs {
+		seq, _, err := scanner.Scan(msg, false, pos)
+		require.NoError(t, err)
+		require.NoError(t, atree.Add(seq), msg)
+	}
+	atree.Finalize()
+
+	for _, msg := range msgs {
+		seq, _, err := scanner.Scan(msg, false, pos)
+		require.NoError(t, err)
+		seq, err = atree.Analyze(seq)
+		require.NoError(t, err)
+		r, _ := seq.String()
+		require.Equal(t, "mail relayed from %srchost% for %srcemail% via %dsthost%", r, msg)
+	}
+}
+
+func TestAnalyzerCustomTokens(t *testing.T) {
+	defer ReadConfig("sequence.toml")
+	require.NoError(t, readTestConfig(customTokensConfig))
+
+	scanner := NewScanner()
+	atree := NewAnalyzer()
+	var pos []int
+
+	msgs := []string{
+		"Queue flushed for job.12345.batch",
+		"Queue flushed for job.678.gpu",
+	}
+	for _, msg := range msgs {
+		seq, _, err := scanner.Scan(msg, false, pos)
+		require.NoError(t, err)
+		require.NoError(t, atree.Add(seq), msg)
+	}
+	atree.Finalize()
+
+	seq, _, err := scanner.Scan(msgs[0], false, pos)
+	require.NoError(t, err)
+	seq, err = atree.Analyze(seq)
+	require.NoError(t, err)
+	r, _ := seq.String()
+	require.Equal(t, "Queue flushed for %jobid%", r)
+}
+
+func TestAnalyzerTimeDiscovery(t *testing.T) {
+	defer ReadConfig("sequence.toml")
+	require.NoError(t, readTestConfig(testLocales(t)))
+	scanner := NewScanner()
+	td := NewTimeDiscovery()
+	var pos []int
+
+	for _, msg := range []string{
+		"16/10/2023 07:39:05 job 42 started",
+		"17/10/2023 08:12:44 job 43 started",
+		"17/10/2023 08:12:45 job 43 finished",
+		"[10-16-2023 07:39:05.123] job started",
+		"[10-30-2023 07:39:05.456] job finished",
+		"lundi 16 octobre 2023 07:39:05 job started",
+		"job 42 started at 2023.10.16-07.39.05",
+		"Feb 06 15:56:09 higgs sshd[902]: job 1.2.3 started",
+		"Feb 07 15:56:09 higgs sshd[902]: job 1.2.3 finished",
+	} {
+		seq, _, err := scanner.Scan(msg, false, pos)
+		require.NoError(t, err)
+		td.Add(msg, seq)
+	}
+
+	// the known formats and the versions are left out
+	props := td.Proposals(2)
+	require.Len(t, props, 2)
+	require.Equal(t, "02/01/2006 15:04:05", props[0].Format)
+	require.Equal(t, 3, props[0].Count)
+	require.Equal(t, "16/10/2023 07:39:05", props[0].Example)
+	require.Equal(t, "01-02-2006 15:04:05.000", props[1].Format)
+	require.Equal(t, 2, props[1].Count)
+	require.Equal(t, props[0].FormatId+1, props[1].FormatId)
+	require.Equal(t, "8", props[0].RegexId)
+	require.Equal(t, "9", props[1].RegexId)
+	require.Equal(t, "(?<timestamp>%{MONTHNUM}-%{MONTHDAY}-%{YEAR} %{HOUR}:%{MINUTE}:%{SECOND}\\.[0-9]{3})", props[1].Grok)
+
+	for _, p := range props {
+		re := regexp.MustCompile("^" + p.Regex + "$")
+		require.True(t, re.MatchString(p.Example), p.Regex)
+	}
+
+	props = td.Proposals(1)
+	require.Len(t, props, 4)
+	require.Equal(t, "2006.01.02-15.04.05", props[2].Format)
+	require.Equal(t, "Monday 02 January 2006 15:04:05", props[3].Format)
+	require.Equal(t, "[daynames]\\s(?:0[1-9]|[12][0-9]|3[01])\\s[monthnames]\\s[0-9]{4}\\s(?:[01][0-9]|2[0-3]):[0-5][0-9]:(?:[0-5][0-9]|60)", props[3].Regex)
+}
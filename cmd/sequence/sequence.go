@@ -39,13 +39,16 @@ import (
 )
 
 var (
-	cfgfile    string
-	infile     string
-	outfile    string
-	patfile    string
-	cpuprofile string
-	workers    int
-	format     string
+	cfgfile     string
+	infile      string
+	outfile     string
+	patfile     string
+	parserCache string
+	cpuprofile  string
+	workers     int
+	format      string
+	stats       bool
+	minCount    int
 
 	quit chan struct{}
 	done chan struct{}
@@ -241,6 +244,7 @@ func parse(cmd *cobra.Command, args []string) {
 	profile()
 
 	parser := buildParser()
+	parser.EnableStats(stats)
 	scanner := sequence.NewScanner()
 
 	iscan, ifile := openInputFile(infile)
@@ -261,20 +265,86 @@ func parse(cmd *cobra.Command, args []string) {
 
 		seq := scanMessage(scanner, line)
 
-		seq, err := parser.Parse(seq)
+		pr, err := parser.ParseWithResult(seq)
 		if err != nil {
 			log.Printf("Error (%s) parsing: %s", err, line)
 		} else {
-			fmt.Fprintf(ofile, "%s\n%s\n\n", line, seq.PrintTokens())
+			fmt.Fprintf(ofile, "%s\n# pattern: %s (score %d)\n%s\n\n", line, pr.Pattern, pr.Score, pr.Sequence.PrintTokens())
 		}
 	}
 
 	since := time.Since(now)
 	log.Printf("Parsed %d messages in %.2f secs, ~ %.2f msgs/sec", n, float64(since)/float64(time.Second), float64(n)/(float64(since)/float64(time.Second)))
+
+	if stats {
+		st := parser.Stats()
+		log.Printf("Matched %d messages, %d not matched, coverage %.2f%%", st.Matched(), st.NoMatch, st.Coverage()*100)
+		for _, p := range st.Patterns {
+			log.Printf("%8d %s", p.Hits, p.Pattern)
+		}
+	}
+
 	close(quit)
 	<-done
 }
 
+func timeFormats(cmd *cobra.Command, args []string) {
+	readConfig()
+
+	if infile == "" {
+		log.Fatal("Invalid input file specified")
+	}
+
+	parser := buildParser()
+	scanner := sequence.NewScanner()
+	discovery := sequence.NewTimeDiscovery()
+
+	iscan, ifile := openInputFile(infile)
+	defer ifile.Close()
+
+	// Only the log messages we can't parse are looked at, the time stamps of the
+	// patterns are already known
+	n := 0
+	for iscan.Scan() {
+		line := iscan.Text()
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+
+		seq := scanMessage(scanner, line)
+
+		if _, err := parser.Parse(seq); err != nil {
+			n++
+			discovery.Add(line, seq)
+		}
+	}
+
+	ofile := openOutputFile(outfile)
+	defer ofile.Close()
+
+	props := discovery.Proposals(minCount)
+
+	fmt.Fprintf(ofile, "[timesettings.formats]\n")
+	for _, p := range props {
+		fmt.Fprintf(ofile, "    # %d of %d unmatched log messages (%.2f%%), e.g. %s\n", p.Count, n, float64(p.Count)*100/float64(n), p.Example)
+		fmt.Fprintf(ofile, "    %d = [%s, %s]\n", p.FormatId, tomlString(p.Format), tomlString(p.RegexId))
+	}
+	fmt.Fprintf(ofile, "\n[timesettings.regex]\n")
+	for _, p := range props {
+		fmt.Fprintf(ofile, "    %s = %s\n", tomlString(p.RegexId), tomlString(p.Regex))
+	}
+	fmt.Fprintf(ofile, "\n[timesettings.grok]\n")
+	for _, p := range props {
+		fmt.Fprintf(ofile, "    %s = %s\n", tomlString(p.RegexId), tomlString(p.Grok))
+	}
+
+	log.Printf("Looked at %d unmatched messages, found %d new time formats.", n, len(props))
+}
+
+func tomlString(s string) string {
+	return "\"" + strings.NewReplacer("\\", "\\\\", "\"", "\\\"").Replace(s) + "\""
+}
+
 func benchScan(cmd *cobra.Command, args []string) {
 	readConfig()
 
@@ -413,6 +483,18 @@ func scanMessage(scanner *sequence.Scanner, data string) sequence.Sequence {
 	case "json":
 		seq, _, err = scanner.ScanJson(data)
 
+	case "logfmt":
+		seq, _, err = scanner.ScanLogfmt(data)
+
+	case "cef":
+		seq, _, err = scanner.ScanCef(data)
+
+	case "leef":
+		seq, _, err = scanner.ScanLeef(data)
+
+	case "xml":
+		seq, _, err = scanner.ScanXml(data)
+
 	default:
 		seq, _, err = scanner.Scan(data, false, pos)
 	}
@@ -424,15 +506,14 @@ func scanMessage(scanner *sequence.Scanner, data string) sequence.Sequence {
 }
 
 func buildParser() *sequence.Parser {
-	parser := sequence.NewParser()
-
 	if patfile == "" {
-		return parser
+		return sequence.NewParser()
 	}
 
 	var files []string
 
-	if fi, err := os.Stat(patfile); err != nil {
+	fi, err := os.Stat(patfile)
+	if err != nil {
 		log.Fatal(err)
 	} else if fi.Mode().IsDir() {
 		files = getDirOfFiles(patfile)
@@ -440,6 +521,25 @@ func buildParser() *sequence.Parser {
 		files = append(files, patfile)
 	}
 
+	// the cache is rebuilt when a pattern file, or the directory, is more recent
+	modified := fi.ModTime()
+	for _, file := range files {
+		if fi, err := os.Stat(file); err == nil && fi.ModTime().After(modified) {
+			modified = fi.ModTime()
+		}
+	}
+
+	parser, err := sequence.CachedParser(parserCache, modified, func() *sequence.Parser {
+		return addPatterns(files)
+	})
+	if err != nil {
+		log.Println(err)
+	}
+	return parser
+}
+
+func addPatterns(files []string) *sequence.Parser {
+	parser := sequence.NewParser()
 	scanner := sequence.NewScanner()
 
 	for _, file := range files {
@@ -569,6 +669,11 @@ func main() {
 			Short: "parses a log file and output a list of parsed tokens for each of the log messages",
 		}
 
+		timeFormatsCmd = &cobra.Command{
+			Use:   "timeformats",
+			Short: "finds the time stamps of a log file that are not in the config and proposes the formats to add",
+		}
+
 		benchCmd = &cobra.Command{
 			Use:   "bench",
 			Short: "benchmarks scanning or parsing of a log file, no output is provided",
@@ -586,10 +691,14 @@ func main() {
 	)
 
 	sequenceCmd.PersistentFlags().StringVarP(&cfgfile, "config", "", "", "TOML-formatted configuration file, default checks ./sequence.toml, then sequence.toml in the same directory as program")
-	sequenceCmd.PersistentFlags().StringVarP(&format, "format", "", "", "format of the message to tokenize, can be 'json' or leave empty")
+	sequenceCmd.PersistentFlags().StringVarP(&format, "format", "", "", "format of the message to tokenize, can be 'json', 'xml', 'logfmt', 'cef', 'leef' or leave empty")
 	sequenceCmd.PersistentFlags().StringVarP(&infile, "input", "i", "", "input file, required")
 	sequenceCmd.PersistentFlags().StringVarP(&outfile, "output", "o", "", "output file, if empty, to stdout")
 	sequenceCmd.PersistentFlags().StringVarP(&patfile, "patterns", "p", "", "patterns, can be a file or directory, used by analyze and parse")
+	sequenceCmd.PersistentFlags().StringVarP(&parserCache, "parser-cache", "", "", "file caching the parser built from the patterns, rebuilt when the patterns are more recent")
+
+	parseCmd.Flags().BoolVarP(&stats, "stats", "", false, "print the number of messages matched by each pattern")
+	timeFormatsCmd.Flags().IntVarP(&minCount, "min", "", 2, "minimum number of messages with a time format to propose it")
 
 	benchCmd.PersistentFlags().StringVarP(&cpuprofile, "cpuprofile", "", "", "CPU profile filename")
 	benchCmd.PersistentFlags().IntVarP(&workers, "workers", "", 1, "number of parsing workers")
@@ -597,6 +706,7 @@ func main() {
 	scanCmd.Run = scan
 	analyzeCmd.Run = analyze
 	parseCmd.Run = parse
+	timeFormatsCmd.Run = timeFormats
 	benchScanCmd.Run = benchScan
 	benchParseCmd.Run = benchParse
 
@@ -606,6 +716,7 @@ func main() {
 	sequenceCmd.AddCommand(scanCmd)
 	sequenceCmd.AddCommand(analyzeCmd)
 	sequenceCmd.AddCommand(parseCmd)
+	sequenceCmd.AddCommand(timeFormatsCmd)
 	sequenceCmd.AddCommand(benchCmd)
 
 	sequenceCmd.Execute()
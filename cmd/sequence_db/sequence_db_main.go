@@ -24,6 +24,7 @@ var (
 	outformat      string
 	informat       string
 	patfile        string
+	parserCache    string
 	cpuprofile     string
 	dbtype         string
 	dbconn         string
@@ -96,6 +97,10 @@ func start(commandType string) {
 	readConfig()
 	validateInputs(commandType)
 	warnExtraInputs(commandType, allinone)
+	//the messages of the logfmt, cef and leef records are scanned in their format
+	if informat == "logfmt" || informat == "cef" || informat == "leef" {
+		format = informat
+	}
 	profile()
 }
 
@@ -103,18 +108,18 @@ func scan(cmd *cobra.Command, args []string) {
 	start("scan")
 	if infile != "" {
 		scanner := sequence.NewScanner()
-		iscan, ifile, err := sequence.OpenInputFile(infile)
+		reader, err := sequence.OpenLogReader(infile)
 		if err != nil {
 			standardLogger.HandleFatal(err.Error())
 		}
-		defer ifile.Close()
+		defer reader.Close()
 
 		ofile, _ := sequence.OpenOutputFile(outfile)
 		defer ofile.Close()
 
 		lrMap := make(map[string]sequence.LogRecordCollection)
 		//We load the file completely
-		_, lrMap, _ = sequence.ReadLogRecordAsMap(iscan, informat, lrMap, batchsize)
+		_, lrMap, _ = sequence.ReadLogRecordAsMap(reader, informat, lrMap, batchsize)
 		for _, lrc := range lrMap {
 			for _, l := range lrc.Records {
 				seq, _, _ := sequence.ScanMessage(scanner, l.Message, format)
@@ -153,6 +158,22 @@ func updateignorepatterns(cmd *cobra.Command, args []string) {
 	standardLogger.HandleInfo(fmt.Sprintf("Ignore patterns updated."))
 }
 
+func competingpatterns(cmd *cobra.Command, args []string) {
+	start("competingpatterns")
+	ofile, err := sequence.OpenOutputFile(outfile)
+	if err != nil {
+		standardLogger.HandleFatal(err.Error())
+	}
+	defer ofile.Close()
+
+	cps := sequence.FindCompetingPatterns(format)
+	for _, cp := range cps {
+		fmt.Fprintf(ofile, "# service: %s, %d examples matched by both patterns\n# example: %s\n%s (score %d): %s\n%s (score %d): %s\n\n",
+			cp.Service, cp.ExampleCount, cp.Example, cp.PatternId1, cp.Score1, cp.Pattern1, cp.PatternId2, cp.Score2, cp.Pattern2)
+	}
+	standardLogger.HandleInfo(fmt.Sprintf("Found %d pairs of competing patterns.", len(cps)))
+}
+
 func analyzebyservice(cmd *cobra.Command, args []string) {
 	start("analyzebyservice")
 	scanner := sequence.NewScanner()
@@ -161,17 +182,17 @@ func analyzebyservice(cmd *cobra.Command, args []string) {
 		aseq  sequence.Sequence
 		mtype string
 	)
-	iscan, ifile, err := sequence.OpenInputFile(infile)
+	reader, err := sequence.OpenLogReader(infile)
 	if err != nil {
 		standardLogger.HandleFatal(err.Error())
 	}
-	defer ifile.Close()
+	defer reader.Close()
 
 	for {
 		lrMap := make(map[string]sequence.LogRecordCollection)
 		startTime := time.Now()
 		//We load the file completely
-		total, lrMap, exit := sequence.ReadLogRecordAsMap(iscan, informat, lrMap, batchsize)
+		total, lrMap, exit := sequence.ReadLogRecordAsMap(reader, informat, lrMap, batchsize)
 		if exit {
 			break
 		}
@@ -194,19 +215,28 @@ func analyzebyservice(cmd *cobra.Command, args []string) {
 			jsonParser := sequence.NewParser()
 			sid := sequence.GenerateIDFromString("", svc)
 			standardLogger.HandleDebug("Started building parser using patterns from database")
-			parser := sequence.BuildParserFromDb(sid)
+			parser := sequence.BuildParserFromDb(sid, parserCache)
 			standardLogger.HandleDebug("Completed building parser and starting to check if matches existing patterns")
 			var seq sequence.Sequence
 			var isJson bool
 			partitionMap := make(map[int]sequence.LogRecordCollection)
+			//the messages that nearly match a pattern, only the tail after the prefix is analyzed
+			prefixes := make(map[sequence.LogRecord]sequence.PrefixResult)
+			scanTail := func(l sequence.LogRecord) sequence.Sequence {
+				seq, _, _ := sequence.ScanMessage(scanner, l.Message, format)
+				if pr, ok := prefixes[l]; ok {
+					seq = seq[pr.Remainder:]
+				}
+				return seq
+			}
 			var jCol sequence.LogRecordCollection
 			for _, l := range lrc.Records {
 				seq, isJson, _ = sequence.ScanMessage(scanner, l.Message, format)
-				pseq, err := parser.Parse(seq)
+				pr, err := parser.ParseWithResult(seq)
 				//if the pattern is found we still need to update the pattern/service relationship
 				//and the statistics
 				if err == nil {
-					pat, pos := pseq.String()
+					pat, pos := pr.Sequence.String()
 					ar, ok := pmap[pat]
 					if !ok {
 						ar = sequence.AnalyzerResult{}
@@ -215,7 +245,7 @@ func analyzebyservice(cmd *cobra.Command, args []string) {
 					ar.Service.ID = sid
 					ar.Service.Name = svc
 					ar.TagPositions = sequence.SplitToString(pos, ",")
-					ar.PatternId = sequence.GenerateIDFromString(pat, svc)
+					ar.PatternId = pr.PatternId
 					ar.Pattern = pat
 					ar.ExampleCount++
 					pmap[pat] = ar
@@ -227,6 +257,12 @@ func analyzebyservice(cmd *cobra.Command, args []string) {
 						jsonParser.Add(seq)
 						jCol.Records = append(jCol.Records, l)
 					} else {
+						//if at least half of the message matches a pattern, report it and only analyze the rest
+						if ppr, perr := parser.ParsePrefix(seq); perr == nil && ppr.Remainder*2 >= len(seq) && ppr.Remainder < len(seq) {
+							standardLogger.LogNearMiss(l, ppr.PatternId, ppr.Remainder, len(seq))
+							prefixes[l] = ppr
+							seq = seq[ppr.Remainder:]
+						}
 						//we need to do something here based on number of tokens
 						//we want to compare only those with same number.
 						if col, ok := partitionMap[len(seq)]; ok {
@@ -274,13 +310,14 @@ func analyzebyservice(cmd *cobra.Command, args []string) {
 			for _, lrc := range partitionMap {
 				analyzer = sequence.NewAnalyzer()
 				for _, l := range lrc.Records {
-					seq, _, _ := sequence.ScanMessage(scanner, l.Message, format)
-					analyzer.Add(seq)
+					analyzer.Add(scanTail(l))
 				}
 				analyzer.Finalize()
 				for _, l := range lrc.Records {
-					seq, _, _ := sequence.ScanMessage(scanner, l.Message, format)
-					aseq, err = analyzer.Analyze(seq)
+					aseq, err = analyzer.Analyze(scanTail(l))
+					if pr, ok := prefixes[l]; ok && err == nil {
+						aseq = append(append(sequence.Sequence{}, pr.Sequence...), aseq...)
+					}
 					mtype = "general"
 					if err != nil {
 						standardLogger.LogAnalysisFailed(l, mtype)
@@ -491,6 +528,20 @@ func validateInputs(commandType string) {
 		if infile == "" {
 			errors = append(errors, "Invalid input file specified")
 		}
+
+	case "competingpatterns":
+		//the examples are scanned in the input format of their records, text if it is not set
+		informat = strings.ToLower(informat)
+		if informat != "" {
+			err := sequence.ValidateInformat(informat)
+			if err != "" {
+				errors = append(errors, err)
+			}
+		}
+		err = sequence.ValidateOutFile(outfile)
+		if err != "" {
+			errors = append(errors, err)
+		}
 	}
 	exs := ""
 	for i, ex := range errors {
@@ -700,6 +751,40 @@ func warnExtraInputs(commandType string, all bool) {
 		if all {
 			extras = append(extras, "all in one (--all)")
 		}
+	case "competingpatterns":
+		if purgeThreshold != 0 {
+			extras = append(extras, "purge threshold (-t)")
+		}
+		if infile != "" {
+			extras = append(extras, "input file (-i)")
+		}
+		if batchsize != 0 {
+			extras = append(extras, "batch size (-b)")
+		}
+		if outformat != "" {
+			extras = append(extras, "output format (-f)")
+		}
+		if outsystem != "" {
+			extras = append(extras, "output system (-s)")
+		}
+		if complimit != 1 {
+			extras = append(extras, "complexity score limit (-c)")
+		}
+		if thresholdValue != "0" {
+			extras = append(extras, "threshold value (-v)")
+		}
+		if thresholdType != "" {
+			extras = append(extras, "threshold type (-y)")
+		}
+		if dbconn != "" {
+			extras = append(extras, "connection string (--conn)")
+		}
+		if dbtype != "" {
+			extras = append(extras, "database type (--type)")
+		}
+		if all {
+			extras = append(extras, "all in one (--all)")
+		}
 	}
 	// Build message
 	for _, w := range extras {
@@ -776,6 +861,11 @@ func main() {
 			Use:   "updateignorepatterns",
 			Short: "outputs a list of patterns to the files in the formats requested.",
 		}
+
+		competingPatternsCmd = &cobra.Command{
+			Use:   "competingpatterns",
+			Short: "outputs the pairs of patterns in the database that match the same examples",
+		}
 	)
 
 	sequenceCmd.PersistentFlags().StringVarP(&cfgfile, "config", "", "", "TOML-formatted configuration file, default checks ./sequence.toml, then sequence.toml in the same directory as program")
@@ -784,7 +874,7 @@ func main() {
 	sequenceCmd.PersistentFlags().StringVarP(&patfile, "patterns", "p", "", "existing patterns text file, can be a file or directory")
 	sequenceCmd.PersistentFlags().StringVarP(&outformat, "out-format", "f", "", "format of the output file, can be yaml, xml or txt or a combo comma separated eg txt,xml, if empty it uses text, used by analyze")
 	sequenceCmd.PersistentFlags().StringVarP(&outsystem, "out-system", "s", "", "system that will use the output, not needed if use database is set to true in the config, valid values are patterndb and grok, used by analyzebyservice")
-	sequenceCmd.PersistentFlags().StringVarP(&informat, "in-format", "k", "", "format of the input data, can be json or txt, if empty it uses txt, used by analyze")
+	sequenceCmd.PersistentFlags().StringVarP(&informat, "in-format", "k", "", "format of the input data, can be json, txt, logfmt, cef, leef, rfc3164 or rfc5424, if empty it uses txt, used by analyze and competingpatterns")
 	sequenceCmd.PersistentFlags().IntVarP(&batchsize, "batch-size", "b", 0, "if using a large file or stdin, the batch size sets the limit of how many to process at one time")
 	sequenceCmd.PersistentFlags().StringVarP(&logfile, "log-file", "l", "", "location of log file if different from the exe directory")
 	sequenceCmd.PersistentFlags().StringVarP(&loglevel, "log-level", "n", "", "defaults to info level, can be 'trace' 'debug', 'info', 'error', 'fatal'")
@@ -794,6 +884,7 @@ func main() {
 	sequenceCmd.PersistentFlags().Float64VarP(&complimit, "complexity-limit", "c", 1, "the complexity of a pattern is between 0 and 1, higher numbers represent more tags. 0.5 is a good level to limit exporting over-tagged patterns.")
 	sequenceCmd.PersistentFlags().BoolVarP(&allinone, "all", "", false, "if passed to analyzebyservice it by passes saving to the database and directly out puts the patterns.")
 	sequenceCmd.PersistentFlags().StringVarP(&dbtype, "type", "", "", "type of the database when creating it, can mssql, postgres, sqlite3 or mysql")
+	sequenceCmd.PersistentFlags().StringVarP(&parserCache, "parser-cache", "", "", "directory caching the parsers built from the patterns of each service in the database, used by analyzebyservice")
 	sequenceCmd.PersistentFlags().StringVarP(&dbconn, "conn", "", "", "connection details for the server")
 
 	scanCmd.Run = scan
@@ -802,6 +893,7 @@ func main() {
 	analyzeByServiceCmd.Run = analyzebyservice
 	exportPatternsCmd.Run = exportPatterns
 	updateIgnoreCmd.Run = updateignorepatterns
+	competingPatternsCmd.Run = competingpatterns
 
 	sequenceCmd.AddCommand(scanCmd)
 	sequenceCmd.AddCommand(createDatabaseCmd)
@@ -809,6 +901,7 @@ func main() {
 	sequenceCmd.AddCommand(analyzeByServiceCmd)
 	sequenceCmd.AddCommand(exportPatternsCmd)
 	sequenceCmd.AddCommand(updateIgnoreCmd)
+	sequenceCmd.AddCommand(competingPatternsCmd)
 
 	sequenceCmd.Execute()
 }
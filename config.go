@@ -18,8 +18,10 @@ import (
 	"fmt"
 	"github.com/BurntSushi/toml"
 	"github.com/zhenjl/porter2"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 var (
@@ -30,7 +32,11 @@ var (
 		//keep the spaces during tokenization
 		//set to true if spacing matters for your output
 		//format
-		markSpaces           bool
+		markSpaces bool
+		//compare the literals regardless of their case, and require the spacing of
+		//the patterns when parsing and analyzing, see MatchOptions
+		caseInsensitive      bool
+		strictSpacing        bool
 		matchThresholdType   string
 		matchThresholdValue  string
 		saveThreshold        string
@@ -44,11 +50,18 @@ var (
 		formats map[int][]string
 		regex   map[string]string
 		grok    map[string]string
+		//the plausibility window of the epoch time stamps, in seconds since the epoch,
+		//both are 0 when the epoch time stamps are not recognized
+		epochFrom int64
+		epochTo   int64
 	}
 
 	keymaps struct {
 		keywords map[string]TagType
 		prekeys  map[string][]TagType
+		//the tags of the values of the CEF and LEEF extension keys
+		cefkeys  map[string]TagType
+		leefkeys map[string]TagType
 	}
 
 	TagTypesCount   int
@@ -63,6 +76,8 @@ func ReadConfig(file string) error {
 		Version             string
 		Tags                []string
 		MarkSpaces          bool
+		CaseInsensitive     bool
+		StrictSpacing       bool
 		MatchThresholdType  string
 		MatchThresholdValue string
 		BelowThresholdPath  string
@@ -71,15 +86,39 @@ func ReadConfig(file string) error {
 		ConnectionInfo      string
 		DatabaseType        string
 
+		Tokens struct {
+			Custom map[string]customTokenConfig
+		}
+
 		Timesettings struct {
-			Formats map[string][]string
-			Regex   map[string]string
-			Grok    map[string]string
+			EpochFrom string
+			EpochTo   string
+			Formats   map[string][]string
+			Regex     map[string]string
+			Grok      map[string]string
+			Locales   map[string]*timeLocale
 		}
 
 		Analyzer struct {
 			Prekeys  map[string][]string
 			Keywords map[string][]string
+			CefKeys  map[string]string
+			LeefKeys map[string]string
+		}
+
+		Input struct {
+			Service   string
+			Message   string
+			Host      string
+			Timestamp string
+			Rejects   string
+		}
+
+		Multiline struct {
+			Start    string
+			Indent   bool
+			MaxLines int
+			Timeout  string
 		}
 	}
 
@@ -91,6 +130,8 @@ func ReadConfig(file string) error {
 	config.tagNames = config.tagNames[:0]
 	config.tagTypes = config.tagTypes[:0]
 	config.markSpaces = configInfo.MarkSpaces
+	config.caseInsensitive = configInfo.CaseInsensitive
+	config.strictSpacing = configInfo.StrictSpacing
 	config.matchThresholdType = configInfo.MatchThresholdType
 	config.matchThresholdValue = configInfo.MatchThresholdValue
 	config.saveThreshold = configInfo.SaveThreshold
@@ -98,6 +139,10 @@ func ReadConfig(file string) error {
 	config.connectionInfo = configInfo.ConnectionInfo
 	config.databaseType = configInfo.DatabaseType
 
+	if err := readCustomTokens(configInfo.Tokens.Custom); err != nil {
+		return err
+	}
+
 	timesettings.formats = make(map[int][]string, len(configInfo.Timesettings.Formats))
 	for i, f := range configInfo.Timesettings.Formats {
 		x, err := strconv.Atoi(i)
@@ -106,10 +151,28 @@ func ReadConfig(file string) error {
 		}
 	}
 
+	if err := readTimeLocales(configInfo.Timesettings.Locales); err != nil {
+		return err
+	}
+
+	// the exporters match the month and day names of the locales too
 	timesettings.regex = configInfo.Timesettings.Regex
 	timesettings.grok = configInfo.Timesettings.Grok
+	for id, re := range timesettings.regex {
+		timesettings.regex[id] = expandTimeNames(re)
+	}
+	for id, gk := range timesettings.grok {
+		timesettings.grok[id] = expandTimeNames(gk)
+	}
+
+	from, to, err := epochWindow(configInfo.Timesettings.EpochFrom, configInfo.Timesettings.EpochTo)
+	if err != nil {
+		return err
+	}
+	timesettings.epochFrom, timesettings.epochTo = from, to
 
 	timeFsmRoot = buildTimeFSM(timesettings.formats)
+	timeLayouts = buildTimeLayouts(timesettings.formats)
 
 	keymaps.keywords = make(map[string]TagType, 30)
 	keymaps.prekeys = make(map[string][]TagType, 30)
@@ -128,7 +191,7 @@ func ReadConfig(file string) error {
 
 		// tag type name, token type
 		tt := name2TokenType(fs[1])
-		if tt < TokenLiteral || tt > TokenString {
+		if (tt < TokenLiteral || tt > TokenString) && !tt.isCustom() {
 			return fmt.Errorf("Error parsing tag %q: invalid token type", f)
 		}
 
@@ -159,12 +222,85 @@ func ReadConfig(file string) error {
 		}
 	}
 
+	keymaps.cefkeys = make(map[string]TagType, len(configInfo.Analyzer.CefKeys))
+	keymaps.leefkeys = make(map[string]TagType, len(configInfo.Analyzer.LeefKeys))
+	for _, k := range []struct {
+		keys map[string]string
+		tags map[string]TagType
+	}{{configInfo.Analyzer.CefKeys, keymaps.cefkeys}, {configInfo.Analyzer.LeefKeys, keymaps.leefkeys}} {
+		for w, fw := range k.keys {
+			f, ok := config.tagIDs[fw]
+			if !ok {
+				return fmt.Errorf("Error parsing the key %q: unknown tag %q", w, fw)
+			}
+			k.tags[w] = f
+		}
+	}
+
+	in := configInfo.Input
+	if err := readInput(in.Service, in.Message, in.Host, in.Timestamp, in.Rejects); err != nil {
+		return err
+	}
+
+	if err := readMultiLine(configInfo.Multiline.Start, configInfo.Multiline.Indent, configInfo.Multiline.MaxLines, configInfo.Multiline.Timeout); err != nil {
+		return err
+	}
+
 	TagTypesCount = len(config.tagNames)
 	allTypesCount = TokenTypesCount + TagTypesCount
 
 	return nil
 }
 
+//readMultiLine sets the aggregation of the lines of the multi-line events, it is disabled if
+//there is no start regex and no indent.
+func readMultiLine(start string, indent bool, maxLines int, timeout string) error {
+	multiline.start, multiline.indent, multiline.maxLines, multiline.timeout = nil, indent, maxLines, 0
+
+	if start != "" {
+		re, err := regexp.Compile(start)
+		if err != nil {
+			return fmt.Errorf("Error parsing the multiline start %q: %v", start, err)
+		}
+		multiline.start = re
+	}
+	if maxLines < 0 {
+		return fmt.Errorf("Error parsing the multiline maxlines %d: expecting 0 or more lines", maxLines)
+	}
+	if timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil || d < 0 {
+			return fmt.Errorf("Error parsing the multiline timeout %q: expecting a duration such as 2s", timeout)
+		}
+		multiline.timeout = d
+	}
+	return nil
+}
+
+//epochWindow converts the dates of the epoch plausibility window. The epoch time
+//stamps are only recognized when both are set, any number with as many digits
+//would be one otherwise.
+func epochWindow(from, to string) (int64, int64, error) {
+	if from == "" && to == "" {
+		return 0, 0, nil
+	}
+	if from == "" || to == "" {
+		return 0, 0, fmt.Errorf("Error parsing the epoch window: expecting both epochfrom and epochto")
+	}
+	f, err := time.Parse("2006-01-02", from)
+	if err != nil {
+		return 0, 0, fmt.Errorf("Error parsing the epoch window %q: expecting a date such as 2023-01-01", from)
+	}
+	t, err := time.Parse("2006-01-02", to)
+	if err != nil {
+		return 0, 0, fmt.Errorf("Error parsing the epoch window %q: expecting a date such as 2023-01-01", to)
+	}
+	if !f.Before(t) {
+		return 0, 0, fmt.Errorf("Error parsing the epoch window: epochfrom %s is not before epochto %s", from, to)
+	}
+	return f.Unix(), t.Unix(), nil
+}
+
 //Returns the regular expression for patterndb matching the passed time format identifier.
 func GetTimeSettingsRegExValue(id string) (string, bool) {
 	f, ok := timesettings.regex[id]
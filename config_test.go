@@ -15,12 +15,157 @@
 package sequence
 
 import (
+	"io/ioutil"
+	"os"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
 )
 
+var customTokensConfig = `
+[tokens.custom.jobid]
+    regex = 'job\.[0-9]+\.[a-z]+'
+[tokens.custom.ticket]
+    prefix = "INC"
+    charset = "0-9"
+    minlength = 6
+`
+
 func TestSequenceConfig(t *testing.T) {
 	err := ReadConfig("sequence.toml")
 	require.NoError(t, err)
 }
+
+func TestCustomTokensConfig(t *testing.T) {
+	defer ReadConfig("sequence.toml")
+
+	require.NoError(t, readTestConfig(customTokensConfig, testTag("batchjob:jobid")...))
+	require.Equal(t, int(token__END__)+3, TokenTypesCount)
+	require.Equal(t, "jobid", name2TokenType("jobid").String())
+	require.Equal(t, name2TokenType("jobid"), name2TagType("batchjob").TokenType())
+
+	re, ok := GetCustomTokenRegex("ticket")
+	require.True(t, ok)
+	require.Equal(t, "INC[0-9]{6,}", re)
+	re, ok = GetCustomTokenRegex("batchjob")
+	require.True(t, ok)
+	require.Equal(t, `job\.[0-9]+\.[a-z]+`, re)
+	_, ok = GetCustomTokenRegex("srcip")
+	require.False(t, ok)
+
+	for _, custom := range []string{
+		"[tokens.custom.ipv4]\nregex = 'x'",
+		"[tokens.custom.job]\nregex = 'job'\nprefix = 'j'",
+		"[tokens.custom.job]\nregex = 'job['",
+		"[tokens.custom.job]\nprefix = 'job'",
+		"[tokens.custom.job]\ncharset = '0-9'\nminlength = 4\nmaxlength = 2",
+	} {
+		require.Error(t, readTestConfig(custom), custom)
+	}
+
+	require.NoError(t, ReadConfig("sequence.toml"))
+	require.Equal(t, int(token__END__)+1, TokenTypesCount)
+	require.Equal(t, TokenUnknown, name2TokenType("jobid"))
+}
+
+func TestEpochWindowConfig(t *testing.T) {
+	defer ReadConfig("sequence.toml")
+
+	// the epoch time stamps are not recognized by default
+	require.NoError(t, readTestConfig(""))
+	require.Equal(t, int64(0), timesettings.epochFrom)
+	require.Equal(t, int64(0), timesettings.epochTo)
+
+	require.NoError(t, readTestConfig("", testEpochWindow("2000-01-01", "2100-01-01")...))
+	require.Equal(t, int64(946684800), timesettings.epochFrom)
+	require.Equal(t, int64(4102444800), timesettings.epochTo)
+
+	for _, window := range [][]string{
+		testEpochWindow("2000", "2100-01-01"),
+		testEpochWindow("2100-01-01", "2000-01-01"),
+		testEpochWindow("2000-01-01", "")[:2],
+	} {
+		require.Error(t, readTestConfig("", window...), "%v", window)
+	}
+}
+
+func TestTimeLocalesConfig(t *testing.T) {
+	defer ReadConfig("sequence.toml")
+
+	// the default regex only has the English names
+	re, ok := GetTimeSettingsRegExValue("7")
+	require.True(t, ok)
+	require.NotContains(t, re, "[monthnames]")
+	require.Contains(t, re, "|january|")
+	require.NotContains(t, re, "|février|")
+
+	require.NoError(t, readTestConfig(testLocales(t)))
+	re, ok = GetTimeSettingsRegExValue("7")
+	require.True(t, ok)
+	for _, name := range []string{"january", "jan", `janv\.`, "février", "märz", "mär", "diciembre"} {
+		require.Contains(t, re, "|"+name+"|")
+	}
+	gk, ok := GetTimeSettingsGrokValue("6")
+	require.True(t, ok)
+	require.Contains(t, gk, `|lun\.|`)
+
+	for _, locale := range []string{
+		"[timesettings.locales.it]\nmonths = ['gennaio']\ndays = ['domenica', 'lunedì', 'martedì', 'mercoledì', 'giovedì', 'venerdì', 'sabato']",
+		"[timesettings.locales.it]\nmonths = ['gennaio', 'febbraio', 'marzo', 'aprile', 'maggio', 'giugno', 'luglio', 'agosto', 'settembre', 'ottobre', 'novembre', 'dicembre']\ndays = ['domenica']",
+		"[timesettings.locales.it]\nmonths = ['gennaio', 'febbraio', 'marzo', 'aprile', 'maggio', 'giugno', 'luglio', 'agosto', 'settembre', 'ottobre', 'novembre', '']\ndays = ['domenica', 'lunedì', 'martedì', 'mercoledì', 'giovedì', 'venerdì', 'sabato']",
+	} {
+		require.Error(t, readTestConfig(locale), locale)
+	}
+}
+
+// testLocales returns the locales of sequence.toml, which are commented out there.
+func testLocales(t *testing.T) string {
+	data, err := ioutil.ReadFile("testdata/locales.toml")
+	require.NoError(t, err)
+	return string(data)
+}
+
+// readTestConfig reads the test config with the sections and tags added, the
+// callers read sequence.toml again when they are done.
+func readTestConfig(sections string, replace ...string) error {
+	data, err := ioutil.ReadFile("sequence.toml")
+	if err != nil {
+		return err
+	}
+
+	// replace holds old and new pairs, each replaced once in sequence.toml
+	s := string(data)
+	for i := 0; i+1 < len(replace); i += 2 {
+		s = strings.Replace(s, replace[i], replace[i+1], 1)
+	}
+
+	f, err := ioutil.TempFile("", "sequence*.toml")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString(s + sections)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return ReadConfig(f.Name())
+}
+
+// testTag returns the replacement adding the tag to the config, after regextime
+// which must stay first.
+func testTag(tag string) []string {
+	return []string{"\"regextime:time\",", "\"regextime:time\", \"" + tag + "\","}
+}
+
+// testEpochWindow returns the replacements setting the epoch window of the config.
+func testEpochWindow(from, to string) []string {
+	return []string{
+		`#epochfrom = "2023-01-01"`, `epochfrom = "` + from + `"`,
+		`#epochto = "2027-01-01"`, `epochto = "` + to + `"`,
+	}
+}
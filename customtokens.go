@@ -0,0 +1,197 @@
+package sequence
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+//The custom token types are declared in the [tokens.custom] section of the config, for the
+//identifiers of a site such as job ids or ticket numbers. A type is declared by a regex, or by
+//a prefix followed by the characters of a charset:
+//
+//	[tokens.custom.jobid]
+//	regex = 'job\.[0-9]+\.[a-z]+'
+//
+//	[tokens.custom.ticket]
+//	prefix = "INC"
+//	charset = "0-9"
+//	minlength = 6
+//
+//The custom types are numbered after token__END__, in the order of their names, and can be
+//used in the tags like the built-in types.
+
+//customTokenConfig is a custom token type as read from the config.
+type customTokenConfig struct {
+	Regex     string
+	Prefix    string
+	Charset   string // the characters of a regex class, such as 0-9A-F
+	MinLength int    // the min and max number of charset characters, 0 for no limit
+	MaxLength int
+}
+
+//customToken is a custom token type, the prefix and charset ones are turned into a regex.
+type customToken struct {
+	name   string
+	ttype  TokenType
+	prefix string
+	regex  string
+	re     *regexp.Regexp // regex anchored at the start of the data
+}
+
+var customTokens []customToken
+
+//readCustomTokens replaces the custom token types with the ones of the config.
+func readCustomTokens(custom map[string]customTokenConfig) error {
+	customTokens = customTokens[:0]
+	TokenTypesCount = int(token__END__) + 1
+
+	names := make([]string, 0, len(custom))
+	for name := range custom {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		ct, err := newCustomToken(name, custom[name])
+		if err != nil {
+			return err
+		}
+		customTokens = append(customTokens, ct)
+	}
+
+	TokenTypesCount += len(customTokens)
+	return nil
+}
+
+func newCustomToken(name string, c customTokenConfig) (customToken, error) {
+	ct := customToken{name: name, ttype: TokenType(int(token__END__) + 1 + len(customTokens)), prefix: c.Prefix}
+
+	if !validCustomTokenName(name) {
+		return ct, fmt.Errorf("Error parsing custom token %q: invalid name", name)
+	}
+	if name2TokenType(name) != TokenUnknown || name == "tunknown" {
+		return ct, fmt.Errorf("Error parsing custom token %q: already a token type", name)
+	}
+
+	switch {
+	case c.Regex != "" && (c.Prefix != "" || c.Charset != ""):
+		return ct, fmt.Errorf("Error parsing custom token %q: regex cannot be used with prefix or charset", name)
+
+	case c.Regex != "":
+		ct.regex = c.Regex
+
+	case c.Charset != "":
+		if c.MaxLength > 0 && c.MaxLength < c.MinLength {
+			return ct, fmt.Errorf("Error parsing custom token %q: maxlength is less than minlength", name)
+		}
+		ct.regex = regexp.QuoteMeta(c.Prefix) + "[" + c.Charset + "]"
+		switch {
+		case c.MinLength <= 1 && c.MaxLength == 0:
+			ct.regex += "+"
+		case c.MaxLength == 0:
+			ct.regex += "{" + strconv.Itoa(c.MinLength) + ",}"
+		default:
+			ct.regex += "{" + strconv.Itoa(c.MinLength) + "," + strconv.Itoa(c.MaxLength) + "}"
+		}
+
+	default:
+		return ct, fmt.Errorf("Error parsing custom token %q: missing regex or charset", name)
+	}
+
+	re, err := regexp.Compile("^(?:" + ct.regex + ")")
+	if err != nil {
+		return ct, fmt.Errorf("Error parsing custom token %q: %v", name, err)
+	}
+	ct.re = re
+
+	return ct, nil
+}
+
+func validCustomTokenName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+//customToken returns the custom token type of t, or nil if t is not a custom type.
+func (this TokenType) customToken() *customToken {
+	i := int(this) - int(token__END__) - 1
+	if i < 0 || i >= len(customTokens) {
+		return nil
+	}
+	return &customTokens[i]
+}
+
+func (this TokenType) isCustom() bool {
+	return this.customToken() != nil
+}
+
+func name2CustomTokenType(s string) TokenType {
+	for _, ct := range customTokens {
+		if ct.name == s {
+			return ct.ttype
+		}
+	}
+	return TokenUnknown
+}
+
+//scanCustom returns the length and type of the longest custom token at the start of data,
+//or 0 if there is none. The token must not be followed by the characters of a literal.
+func (this *Message) scanCustom(data string, nt int) (int, TokenType) {
+	n, t := 0, TokenUnknown
+
+	for _, ct := range customTokens {
+		if !strings.HasPrefix(data, ct.prefix) {
+			continue
+		}
+		if loc := ct.re.FindStringIndex(data); loc != nil && loc[1] > n {
+			n, t = loc[1], ct.ttype
+		}
+	}
+
+	if n == 0 || (nt > 0 && n > nt) {
+		return 0, TokenUnknown
+	}
+
+	if n < len(data) {
+		r, _ := utf8.DecodeRuneInString(data[n:])
+		switch {
+		case r == '.':
+			// the end of a sentence
+			if n+1 < len(data) && data[n+1] != ' ' {
+				return 0, TokenUnknown
+			}
+		case isLiteral(r):
+			return 0, TokenUnknown
+		case this.state.inquote && r != ' ' && !matchQuote(this.state.chquote, r):
+			return 0, TokenUnknown
+		}
+	}
+
+	return n, t
+}
+
+//Returns the regular expression of a custom token type, or of a tag of a custom token type,
+//so the exporters can match the same values.
+func GetCustomTokenRegex(name string) (string, bool) {
+	t := name2CustomTokenType(name)
+	if t == TokenUnknown {
+		if f, ok := config.tagIDs[name]; ok {
+			t = f.TokenType()
+		}
+	}
+	if ct := t.customToken(); ct != nil {
+		return ct.regex, true
+	}
+	return "", false
+}
@@ -3,6 +3,7 @@ package sequence
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"github.com/gofrs/uuid"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/volatiletech/null"
@@ -96,9 +97,49 @@ func OpenDbandSetContext() (*sql.DB, context.Context) {
 	boil.SetDB(db)
 	// Need to set a context for purposes I don't understand yet
 	ctx := context.Background() // Dark voodoo magic, https://golang.org/pkg/context/#Background
+	if err = migrateExamples(ctx, db, config.databaseType); err != nil {
+		logger.HandleFatal(err.Error())
+	}
 	return db, ctx
 }
 
+//The statements adding the example_header column to the examples table of the databases
+//created before it, by database type.
+var exampleHeaderMigrations = map[string]string{
+	"sqlite3":   "ALTER TABLE Examples ADD COLUMN example_header STRING",
+	"mysql":     "ALTER TABLE `examples` ADD COLUMN `example_header` text DEFAULT NULL",
+	"postgres":  `ALTER TABLE public."Examples" ADD COLUMN example_header text`,
+	"sqlserver": "ALTER TABLE [dbo].[Examples] ADD [example_header] [nvarchar](max) NULL",
+}
+
+//This adds the example_header column to the examples table if it is missing,
+//so the databases created before it was added can still be used.
+func migrateExamples(ctx context.Context, db *sql.DB, dbtype string) error {
+	rows, err := models.Examples(qm.Limit(1)).QueryContext(ctx, db)
+	if err != nil {
+		return fmt.Errorf("Error reading the examples table: %v", err)
+	}
+	cols, err := rows.Columns()
+	rows.Close()
+	if err != nil {
+		return fmt.Errorf("Error reading the columns of the examples table: %v", err)
+	}
+	for _, c := range cols {
+		if strings.EqualFold(c, models.ExampleColumns.ExampleHeader) {
+			return nil
+		}
+	}
+
+	q, ok := exampleHeaderMigrations[dbtype]
+	if !ok {
+		return fmt.Errorf("Error adding the example_header column to the examples table: %s databases are not supported", dbtype)
+	}
+	if _, err = db.ExecContext(ctx, q); err != nil {
+		return fmt.Errorf("Error adding the example_header column to the examples table: %v", err)
+	}
+	return nil
+}
+
 //Returns all of the patterns from the database.
 func getPatternsFromDatabase(db *sql.DB, ctx context.Context) map[string]string {
 	pmap := make(map[string]string)
@@ -167,6 +208,9 @@ func GetPatternsWithExamplesFromDatabase(db *sql.DB, ctx context.Context, comple
 		for _, e := range ex {
 			s, _ := e.Service().One(ctx, db)
 			lr := LogRecord{Message: e.ExampleDetail, Service: s.Name}
+			if err := lr.SetHeader(e.ExampleHeader.String); err != nil {
+				logger.HandleError(fmt.Sprintf("Invalid header of the example %s: %v", e.ID, err))
+			}
 			ar.Examples = append(ar.Examples, lr)
 		}
 		pmap[p.ID] = ar
@@ -307,7 +351,8 @@ func insertExample(ctx context.Context, tx *sql.Tx, lr LogRecord, pid string, si
 	if err != nil {
 		logger.DatabaseInsertFailed("example", pid, err.Error())
 	}
-	ex := models.Example{ExampleDetail: strings.TrimRight(lr.Message, " "), PatternID: pid, ID: id.String(), ServiceID: sid}
+	h := lr.Header()
+	ex := models.Example{ExampleDetail: strings.TrimRight(lr.Message, " "), ExampleHeader: null.NewString(h, h != ""), PatternID: pid, ID: id.String(), ServiceID: sid}
 	err = ex.Insert(ctx, tx, boil.Infer())
 	if err != nil {
 		logger.DatabaseInsertFailed("example", pid, err.Error())
@@ -0,0 +1,47 @@
+package sequence
+
+import (
+	"context"
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/volatiletech/null"
+	"github.com/volatiletech/sqlboiler/boil"
+	"gitlab.in2p3.fr/cc-in2p3-system/sequence/models"
+)
+
+func TestMigrateExamples(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sequence")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "sequence.sdb"))
+	require.NoError(t, err)
+	defer db.Close()
+	ctx := context.Background()
+
+	// the examples table as created before the example_header column
+	_, err = db.Exec("CREATE TABLE Examples (id STRING PRIMARY KEY NOT NULL, service_id STRING NOT NULL, pattern_id STRING (20, 50) NOT NULL, example_detail STRING (1000) NOT NULL)")
+	require.NoError(t, err)
+	_, err = db.Exec("INSERT INTO Examples VALUES ('1', 's', 'p', 'user bob logged in')")
+	require.NoError(t, err)
+
+	require.Error(t, migrateExamples(ctx, db, "oracle"))
+	require.NoError(t, migrateExamples(ctx, db, "sqlite3"))
+	// the column is only added once
+	require.NoError(t, migrateExamples(ctx, db, "sqlite3"))
+
+	ex := models.Example{ID: "2", ServiceID: "s", PatternID: "p", ExampleDetail: "user ann logged in", ExampleHeader: null.StringFrom("host=web1")}
+	require.NoError(t, ex.Insert(ctx, db, boil.Infer()))
+
+	old, err := models.FindExample(ctx, db, "1")
+	require.NoError(t, err)
+	require.False(t, old.ExampleHeader.Valid)
+	added, err := models.FindExample(ctx, db, "2")
+	require.NoError(t, err)
+	require.Equal(t, "host=web1", added.ExampleHeader.String)
+}
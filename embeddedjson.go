@@ -0,0 +1,282 @@
+package sequence
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//The text messages with json embedded, such as
+//
+//	user login failed: {"user": "bob", "attempts": 3}
+//	event=login payload={"user": "bob"} status=ok
+//	user login failed: [1,2,3]
+//
+//have the text before the json scanned as text, followed by the %json% marker and the key=value
+//pairs of the json, flattened with the rules of ScanJson, the elements of an array being json.0,
+//json.1 and so on. The pairs are sorted by key. The text after the json, if any, follows a second
+//%json% marker closing the pairs, and is scanned as text. In the patterns, the markers tell the
+//exporters where the json is, so they can match the text around it and leave the json to a json
+//parser.
+//
+//The json must start after a space or an "=" and end the message or be followed by a space. It
+//is an object with at least one key, or an array with more than one element or with an object or
+//an array in it, so the bracketed values, such as sshd[902], [3] or {}, are scanned as text.
+//Only the outermost brackets are tried, and the first of them holding json is the embedded json.
+
+const jsonMarker = "%json%"
+
+type jsonPair struct {
+	key        string
+	start, end int
+}
+
+//embeddedJsonSpan returns the start and the end of the json embedded in the text message, or -1
+//and -1 if there is none. A message that is all json is not a text message, so the start is
+//never 0. The brackets are matched in one pass over the message, skipping the json strings.
+func embeddedJsonSpan(s string) (int, int) {
+	var (
+		open  = -1
+		stack []byte
+	)
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		if open < 0 {
+			if (c == '{' || c == '[') && (s[i-1] == ' ' || s[i-1] == '\t' || s[i-1] == '=') {
+				open, stack = i, append(stack[:0], c)
+			}
+			continue
+		}
+
+		switch c {
+		case '"':
+			end := jsonStringEnd(s, i)
+			if end < 0 {
+				return -1, -1
+			}
+			i = end - 1
+		case '{', '[':
+			stack = append(stack, c)
+		case '}', ']':
+			if stack[len(stack)-1] != c-2 {
+				//'{' and '[' are 2 before their closing bracket, the brackets do not match
+				open = -1
+				continue
+			}
+			if stack = stack[:len(stack)-1]; len(stack) > 0 {
+				continue
+			}
+			end := i + 1
+			if (end == len(s) || strings.IndexByte(" \t\r\n", s[end]) >= 0) && isEmbeddedJson(s[open:end]) {
+				return open, end
+			}
+			open = -1
+		}
+	}
+	return -1, -1
+}
+
+//isEmbeddedJson returns true if the bracketed value is json embedded in a text message, see
+//embeddedJsonSpan.
+func isEmbeddedJson(s string) bool {
+	if s[0] == '{' {
+		return s[skipJsonSpace(s, 1)] == '"' && json.Valid([]byte(s))
+	}
+
+	var elems []json.RawMessage
+	if err := json.Unmarshal([]byte(s), &elems); err != nil {
+		return false
+	}
+	if len(elems) != 1 {
+		return len(elems) > 1
+	}
+	first := elems[0][skipJsonSpace(string(elems[0]), 0)]
+	return first == '{' || first == '['
+}
+
+//ScanEmbeddedJson returns a Sequence, or a list of tokens, for a text message with json embedded.
+//The text is scanned as with Scan, and the json is flattened into key=value pairs after the
+//%json% marker. The keys are literals and the values are typed tokens, the values with spaces
+//being strings. The sequence is not structured, so the text can be analyzed, and the returned
+//bool is false.
+func (this *Scanner) ScanEmbeddedJson(s string) (Sequence, bool, error) {
+	start, end := embeddedJsonSpan(s)
+	return this.scanEmbeddedJson(s, start, end)
+}
+
+//scanEmbeddedJson scans the message with the json from start to end, as returned by
+//embeddedJsonSpan.
+func (this *Scanner) scanEmbeddedJson(s string, start, end int) (Sequence, bool, error) {
+	if start <= 0 {
+		return nil, false, fmt.Errorf("Invalid message. Expecting json in the message.")
+	}
+
+	//the text after the json is scanned first, Scan reuses the sequence
+	var after Sequence
+	if strings.TrimSpace(s[end:]) != "" {
+		seq, _, err := this.Scan(s[end:], false, nil)
+		if err != nil {
+			return nil, false, err
+		}
+		after = make(Sequence, len(seq))
+		for i, tok := range seq {
+			tok.Start, tok.End = tok.Start+end, tok.End+end
+			after[i] = tok
+		}
+	}
+
+	if _, _, err := this.Scan(s[:start], false, nil); err != nil {
+		return nil, false, err
+	}
+
+	//the elements of an array are numbered after json, a key that is only a number would be
+	//scanned as an integer in the pattern
+	var (
+		pairs []jsonPair
+		key   string
+	)
+	if s[start] == '[' {
+		key = "json"
+	}
+	if _, err := flattenJson(s[:end], start, key, &pairs); err != nil {
+		return nil, false, err
+	}
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return pairs[i].key < pairs[j].key
+	})
+
+	this.insertToken(Token{
+		Tag:           TagUnknown,
+		Type:          TokenLiteral,
+		Value:         jsonMarker,
+		Start:         start,
+		End:           start,
+		IsSpaceBefore: config.markSpaces && s[start-1] == ' ',
+		isKey:         true,
+	})
+
+	// the key and "=" are not in the message, so they get an empty span at the
+	// start of the value
+	val := &Message{}
+	for _, p := range pairs {
+		this.insertToken(Token{Tag: TagUnknown, Type: TokenLiteral, Value: p.key, Start: p.start, End: p.start, isKey: true, IsSpaceBefore: config.markSpaces})
+		this.insertToken(Token{Tag: TagUnknown, Type: TokenLiteral, Value: "=", Start: p.start, End: p.start})
+		this.insertToken(Token{Tag: TagUnknown, Type: val.valueType(s[p.start:p.end]), Value: s[p.start:p.end], Start: p.start, End: p.end, isValue: true})
+	}
+
+	if len(after) > 0 {
+		this.insertToken(Token{Tag: TagUnknown, Type: TokenLiteral, Value: jsonMarker, Start: end, End: end, IsSpaceBefore: config.markSpaces})
+		for _, tok := range after {
+			this.insertToken(tok)
+		}
+	}
+
+	return this.seq, false, nil
+}
+
+//flattenJson adds the pairs of the json value at s[i:] to pairs, as ScanJson does: the keys of
+//the nested objects are joined with ".", the array elements are numbered from 0 and the empty
+//values are skipped. It returns the index after the value. The json must be valid.
+func flattenJson(s string, i int, key string, pairs *[]jsonPair) (int, error) {
+	i = skipJsonSpace(s, i)
+	if i >= len(s) {
+		return i, fmt.Errorf("Invalid message. Expecting json value for %q.", key)
+	}
+
+	join := func(k string) string {
+		if key == "" {
+			return k
+		}
+		return key + "." + k
+	}
+
+	switch s[i] {
+	case '{', '[':
+		object := s[i] == '{'
+		close := byte(']')
+		if object {
+			close = '}'
+		}
+		i = skipJsonSpace(s, i+1)
+		for n := 0; i < len(s) && s[i] != close; n++ {
+			k := strconv.Itoa(n)
+			if object {
+				end := jsonStringEnd(s, i)
+				if err := json.Unmarshal([]byte(s[i:end]), &k); err != nil {
+					return i, fmt.Errorf("Invalid message. Expecting string key, got %q.", s[i:end])
+				}
+				i = skipJsonSpace(s, end)
+				if i >= len(s) || s[i] != ':' {
+					return i, fmt.Errorf("Invalid message. Expecting colon after key %q.", k)
+				}
+				i++
+			}
+
+			var err error
+			if i, err = flattenJson(s, i, join(k), pairs); err != nil {
+				return i, err
+			}
+			if i = skipJsonSpace(s, i); i < len(s) && s[i] == ',' {
+				i = skipJsonSpace(s, i+1)
+			}
+		}
+		return i + 1, nil
+
+	case '"':
+		end := jsonStringEnd(s, i)
+		if end-1 > i+1 {
+			*pairs = append(*pairs, jsonPair{key, i + 1, end - 1})
+		}
+		return end, nil
+
+	default:
+		end := i
+		for end < len(s) && strings.IndexByte(",]} \t\r\n", s[end]) < 0 {
+			end++
+		}
+		if s[i:end] != "null" {
+			*pairs = append(*pairs, jsonPair{key, i, end})
+		}
+		return end, nil
+	}
+}
+
+//jsonStringEnd returns the index after the closing quote of the json string at s[i], or -1 if the
+//string is not closed.
+func jsonStringEnd(s string, i int) int {
+	for j := i + 1; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case '"':
+			return j + 1
+		}
+	}
+	return -1
+}
+
+func skipJsonSpace(s string, i int) int {
+	for i < len(s) && strings.IndexByte(" \t\r\n", s[i]) >= 0 {
+		i++
+	}
+	return i
+}
+
+//TrimEmbeddedJson returns the pattern without the keys of the json, if it is the pattern of a text
+//message with json embedded: the text before the json, the %json% marker and the text after the
+//json, if any. The exporters match the text and the json as a whole, and leave the json to a json
+//parser, so they don't need the keys of the json.
+func TrimEmbeddedJson(pattern string) (string, bool) {
+	i := strings.Index(pattern, jsonMarker)
+	if i < 0 {
+		return pattern, false
+	}
+	i += len(jsonMarker)
+	j := strings.Index(pattern[i:], jsonMarker)
+	if j < 0 {
+		return pattern[:i], true
+	}
+	return pattern[:i] + pattern[i+j+len(jsonMarker):], true
+}
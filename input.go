@@ -0,0 +1,122 @@
+package sequence
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+//The json records are read with the [input] section of the config, which sets the json paths of
+//the service, message, host and timestamp of the log records, e.g. program and MESSAGE for the
+//journald exports or log.message for a nested message. The keys of the nested objects are
+//separated by dots in the paths. The records with no service or no message are written to the
+//rejects file, if it is set, instead of being read with the service none. The rejects file is
+//opened by the LogReader on its first rejected record, and closed with the reader.
+
+var input struct {
+	service   string
+	message   string
+	host      string
+	timestamp string
+	rejects   string
+}
+
+//readInput sets the json paths of the fields of the log records, an empty path is the key of
+//the field in the LogRecord.
+func readInput(service, message, host, timestamp, rejects string) error {
+	for _, p := range []string{service, message, host, timestamp} {
+		if strings.HasPrefix(p, ".") || strings.HasSuffix(p, ".") || strings.Contains(p, "..") {
+			return fmt.Errorf("Error parsing the input path %q: expecting keys separated by dots", p)
+		}
+	}
+
+	input.service, input.message, input.host, input.timestamp, input.rejects = service, message, host, timestamp, rejects
+	return nil
+}
+
+//inputPath returns the path of a field, def if it is not set.
+func inputPath(path, def string) string {
+	if path == "" {
+		return def
+	}
+	return path
+}
+
+//parseJsonRecord returns the log record of the json line, and false if it has no service or no
+//message at their paths.
+func parseJsonRecord(line string) (LogRecord, bool) {
+	var (
+		r LogRecord
+		m map[string]interface{}
+	)
+	d := json.NewDecoder(strings.NewReader(line))
+	d.UseNumber()
+	if err := d.Decode(&m); err != nil {
+		return r, false
+	}
+
+	var service, message bool
+	r.Service, service = jsonPath(m, inputPath(input.service, "service"))
+	r.Message, message = jsonPath(m, inputPath(input.message, "message"))
+	r.Host, _ = jsonPath(m, inputPath(input.host, "host"))
+	r.Timestamp, _ = jsonPath(m, inputPath(input.timestamp, "timestamp"))
+	//the other header fields are at the keys of the LogRecord
+	r.Priority, _ = jsonPath(m, "priority")
+	r.ProcId, _ = jsonPath(m, "procid")
+	r.MsgId, _ = jsonPath(m, "msgid")
+	r.StructuredData, _ = jsonPath(m, "structureddata")
+	return r, service && message
+}
+
+//jsonPath returns the value at the path in the json object. A key with dots is matched before the
+//nested objects. The numbers and booleans are returned as they are written.
+func jsonPath(m map[string]interface{}, path string) (string, bool) {
+	if v, ok := m[path]; ok {
+		switch v := v.(type) {
+		case string:
+			return v, strings.TrimSpace(v) != ""
+		case json.Number:
+			return v.String(), true
+		case bool:
+			return strconv.FormatBool(v), true
+		}
+		return "", false
+	}
+
+	for i := strings.IndexByte(path, '.'); i > 0; {
+		if sub, ok := m[path[:i]].(map[string]interface{}); ok {
+			if v, ok := jsonPath(sub, path[i+1:]); ok {
+				return v, true
+			}
+		}
+		j := strings.IndexByte(path[i+1:], '.')
+		if j < 0 {
+			break
+		}
+		i += j + 1
+	}
+	return "", false
+}
+
+//rejectRecord writes the line of a record with missing fields to the rejects file, it returns
+//false if there is no rejects file.
+func (this *LogReader) rejectRecord(line string) bool {
+	if input.rejects == "" {
+		return false
+	}
+
+	if this.rejects == nil {
+		f, err := os.OpenFile(input.rejects, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			logger.HandleError(fmt.Sprintf("Unable to open the rejects file %s: %v", input.rejects, err))
+			return false
+		}
+		this.rejects = f
+	}
+	if _, err := fmt.Fprintln(this.rejects, line); err != nil {
+		logger.HandleError(fmt.Sprintf("Unable to write to the rejects file %s: %v", input.rejects, err))
+	}
+	return true
+}
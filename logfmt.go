@@ -0,0 +1,198 @@
+package sequence
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+//ScanLogfmt returns a Sequence, or a list of tokens, for the logfmt string supplied, e.g.
+//
+//	level=info msg="user logged in" user=bob duration=12ms
+//
+//Like ScanJson, the keys are literals and the values are typed tokens, the literal values
+//being strings. The quotes of the values are kept as literals and the escapes are kept in the
+//values, so a quoted value with spaces is a single token. A key with no value, key= or key, has
+//no value token. The key/value pairs are sorted by key, so the messages with the same keys have
+//the same sequence whatever the order of their keys. A message without any key=value pair is not
+//logfmt, it gives an error.
+//
+//The sequence is structured, as the one of ScanJson_Preserve, so the returned bool is true.
+func (this *Scanner) ScanLogfmt(s string) (Sequence, bool, error) {
+	this.msg.Data = s
+	this.msg.reset()
+	this.seq = this.seq[:0]
+
+	type pair struct {
+		key  string
+		toks Sequence
+	}
+
+	var (
+		pairs  []pair
+		val    = &Message{}
+		hasKey bool
+	)
+
+	for i := 0; i < len(s); {
+		if s[i] == ' ' || s[i] == '\t' {
+			i++
+			continue
+		}
+
+		start := i
+		for i < len(s) && s[i] > ' ' && s[i] != '=' && s[i] != '"' {
+			i++
+		}
+		if i == start {
+			return nil, true, fmt.Errorf("Invalid message. Expecting key, got %q.", s[i:i+1])
+		}
+
+		p := pair{key: s[start:i]}
+		p.toks = append(p.toks, Token{Tag: TagUnknown, Type: TokenLiteral, Value: p.key, Start: start, End: i, isKey: true})
+
+		if i < len(s) && s[i] == '=' {
+			hasKey = true
+			p.toks = append(p.toks, Token{Tag: TagUnknown, Type: TokenLiteral, Value: "=", Start: i, End: i + 1})
+			i++
+
+			quoted := i < len(s) && s[i] == '"'
+			if quoted {
+				p.toks = append(p.toks, Token{Tag: TagUnknown, Type: TokenLiteral, Value: "\"", Start: i, End: i + 1})
+				i++
+			}
+
+			vstart := i
+			for i < len(s) {
+				if quoted && s[i] == '\\' && i+1 < len(s) {
+					i += 2
+					continue
+				}
+				if quoted && s[i] == '"' || !quoted && (s[i] == ' ' || s[i] == '\t') {
+					break
+				}
+				i++
+			}
+			if quoted && i >= len(s) {
+				return nil, true, fmt.Errorf("Invalid message. Expecting end quote for value of %q.", p.key)
+			}
+
+			if i > vstart {
+				p.toks = append(p.toks, Token{
+					Tag:     TagUnknown,
+					Type:    val.valueType(s[vstart:i]),
+					Value:   s[vstart:i],
+					Start:   vstart,
+					End:     i,
+					isValue: true,
+				})
+			}
+
+			if quoted {
+				p.toks = append(p.toks, Token{Tag: TagUnknown, Type: TokenLiteral, Value: "\"", Start: i, End: i + 1})
+				i++
+			}
+		}
+
+		if i < len(s) && s[i] != ' ' && s[i] != '\t' {
+			return nil, true, fmt.Errorf("Invalid message. Expecting space after value of %q, got %q.", p.key, s[i:i+1])
+		}
+		pairs = append(pairs, p)
+	}
+
+	if !hasKey {
+		return nil, true, fmt.Errorf("Invalid message. Expecting at least one key=value pair.")
+	}
+
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return pairs[i].key < pairs[j].key
+	})
+
+	for i, p := range pairs {
+		for j, tok := range p.toks {
+			tok.IsSpaceBefore = config.markSpaces && i > 0 && j == 0
+			this.insertToken(tok)
+		}
+	}
+
+	return this.seq, true, nil
+}
+
+//LogfmtPatterns returns the pattern of the logfmt messages in the key orders of its examples.
+//The keys of the pattern are sorted, see ScanLogfmt, so the pattern does not match the messages
+//in the systems the patterns are exported to. There is a pattern for each order of the keys in
+//the examples, the pattern itself for the examples it matches scanned as text. The examples the
+//pattern does not match are skipped.
+func LogfmtPatterns(ar AnalyzerResult) []string {
+	scanner := NewScanner()
+	pseq, _, err := scanner.Scan(ar.Pattern, true, SplitToInt(ar.TagPositions, ","))
+	if err != nil {
+		return nil
+	}
+	pseq = append(Sequence(nil), pseq...)
+	parser := NewParser()
+	if err := parser.Add(pseq); err != nil {
+		return nil
+	}
+
+	var patterns []string
+	seen := make(map[string]bool)
+	add := func(p string) {
+		if !seen[p] {
+			seen[p] = true
+			patterns = append(patterns, p)
+		}
+	}
+	for _, ex := range ar.Examples {
+		//the keys of the example are in the order of the pattern
+		if seq, _, err := ScanMessage(scanner, ex.Message, ""); err == nil {
+			if _, err := parser.Parse(seq); err == nil {
+				add(ar.Pattern)
+				continue
+			}
+		}
+
+		mseq, _, err := ScanMessage(scanner, ex.Message, "logfmt")
+		if err != nil || len(mseq) != len(pseq) {
+			continue
+		}
+		mseq = append(Sequence(nil), mseq...)
+		if _, err := parser.Parse(append(Sequence(nil), mseq...)); err != nil {
+			continue
+		}
+
+		//the tokens of the pairs go back to their place in the message
+		order := make([]int, len(mseq))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(i, j int) bool {
+			return mseq[order[i]].Start < mseq[order[j]].Start
+		})
+		seq := make(Sequence, len(pseq))
+		for k, i := range order {
+			seq[k] = pseq[i]
+			seq[k].IsSpaceBefore = config.markSpaces && k > 0 && mseq[i].isKey
+		}
+
+		p, _ := seq.String()
+		add(p)
+	}
+	return patterns
+}
+
+//valueType returns the type of the value of a key/value pair, a string if it is not a single
+//token of the scanner or if it is a literal.
+func (this *Message) valueType(v string) TokenType {
+	this.Data = v
+	this.reset()
+
+	tok, err := this.Tokenize(false, nil)
+	if err != nil || tok.Start != 0 || tok.End != len(v) || tok.Type == TokenLiteral || tok.Type == TokenMultiLine {
+		return TokenString
+	}
+	if _, err := this.Tokenize(false, nil); err != io.EOF {
+		return TokenString
+	}
+	return tok.Type
+}
@@ -60,6 +60,7 @@ var (
 	eventGenericInfo    = Event{100, "%s"}
 	eventAnalyzeInfo    = Event{101, "Analyzed %d messages, found %d unique patterns, %d are new, %d saved to the database. %d messages errored, Total time taken: %s, Time for analysis: %s"}
 	eventOutputInfo     = Event{102, "Output %d patterns to file, the top 5 matched patterns are %s, time taken: %s"}
+	eventNearMiss       = Event{103, "Near miss: %d of %d tokens matched pattern %s, only the rest is analyzed, message: %s"}
 	eventGenericError   = Event{200, "%s"}
 	eventAnalysisFailed = Event{201, "Unable to analyze: %s, Message type: %s"}
 	eventDbInsertFailed = Event{301, "Failed to insert record into %s table, id: %s, reason: %s"}
@@ -76,6 +77,13 @@ func (l *StandardLogger) LogAnalysisFailed(lr LogRecord, mtype string) {
 	}).Debugf(eventAnalysisFailed.message, lr.Message, mtype)
 }
 
+func (l *StandardLogger) LogNearMiss(lr LogRecord, patternId string, matched int, total int) {
+	l.WithFields(logrus.Fields{
+		"id":      eventNearMiss.id,
+		"version": Version,
+	}).Infof(eventNearMiss.message, matched, total, patternId, lr.Message)
+}
+
 func (l *StandardLogger) DatabaseInsertFailed(tablename string, id string, reason string) {
 	l.WithFields(logrus.Fields{
 		"id":      eventDbInsertFailed.id,
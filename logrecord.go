@@ -1,7 +1,6 @@
 package sequence
 
 import (
-	"bufio"
 	"encoding/json"
 	"strings"
 )
@@ -9,6 +8,53 @@ import (
 type LogRecord struct {
 	Service string `json:"service"`
 	Message string `json:"message"`
+	//the header fields of the rfc3164 and rfc5424 syslog formats
+	Priority       string `json:"priority,omitempty"`
+	Timestamp      string `json:"timestamp,omitempty"`
+	Host           string `json:"host,omitempty"`
+	ProcId         string `json:"procid,omitempty"`
+	MsgId          string `json:"msgid,omitempty"`
+	StructuredData string `json:"structureddata,omitempty"`
+}
+
+//the header fields of a log record, saved with its examples in the database
+type logRecordHeader struct {
+	Priority       string `json:"priority,omitempty"`
+	Timestamp      string `json:"timestamp,omitempty"`
+	Host           string `json:"host,omitempty"`
+	ProcId         string `json:"procid,omitempty"`
+	MsgId          string `json:"msgid,omitempty"`
+	StructuredData string `json:"structureddata,omitempty"`
+}
+
+//Returns the header fields of the record as a json object, or an empty string if it has none.
+func (this LogRecord) Header() string {
+	h := logRecordHeader{this.Priority, this.Timestamp, this.Host, this.ProcId, this.MsgId, this.StructuredData}
+	if h == (logRecordHeader{}) {
+		return ""
+	}
+	b, err := json.Marshal(h)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+//Sets the header fields of the record from the json object returned by Header.
+func (this *LogRecord) SetHeader(header string) error {
+	var h logRecordHeader
+	if header != "" {
+		if err := json.Unmarshal([]byte(header), &h); err != nil {
+			return err
+		}
+	}
+	this.Priority, this.Timestamp, this.Host, this.ProcId, this.MsgId, this.StructuredData = h.Priority, h.Timestamp, h.Host, h.ProcId, h.MsgId, h.StructuredData
+	return nil
+}
+
+//Returns the parameters of the rfc5424 structured data of the record, see ParseStructuredData.
+func (this LogRecord) Params() map[string]string {
+	return ParseStructuredData(this.StructuredData)
 }
 
 type LogRecordCollection struct {
@@ -17,45 +63,27 @@ type LogRecordCollection struct {
 }
 
 //This method expects records in the format {"service": "service-name", message: "log message"}
-//eg {"service":"remctld","message":"error receiving initial token: unexpected end of file"} if json or for text
+//eg {"service":"remctld","message":"error receiving initial token: unexpected end of file"} if json, or with
+//the json paths of the [input] section of the config, or for text
 //service [space] message, eg: remctld error receiving initial token: unexpected end of file.
+//The rfc3164 and rfc5424 formats read raw syslog lines, the app-name is the service.
+//The logfmt format is read as text. The cef and leef formats read the security events, the
+//device product is the service.
+//The lines of the multi-line events are joined in a record, as set in the [multiline] section of the config.
 //See Examples folder for example files.
 //Returns a collection of log records.
 func ReadLogRecord(fname string, format string, lr []LogRecord, batchLimit int) []LogRecord {
-	iscan, ifile, err := OpenInputFile(fname)
-	defer ifile.Close()
+	reader, err := OpenLogReader(fname)
 	if err != nil {
 		logger.HandleFatal(err.Error())
 	}
-	var r LogRecord
+	defer reader.Close()
 	var count = 0
-	for iscan.Scan() {
-		message := iscan.Text()
-		if len(message) == 0 {
+	for {
+		r, next := reader.read(format, false)
+		if next != readRecord {
 			break
 		}
-		if len(message) == 0 || message[0] == '#' {
-			continue
-		}
-		if format == "json" {
-			r = LogRecord{}
-			_ = json.Unmarshal([]byte(message), &r)
-			//check for an empty service and set it to none
-			//TODO: Review if these should be discarded too
-			if r.Service == "" {
-				r.Service = "none"
-			}
-		} else {
-			//the first field is the service, delimited by a space
-			k := strings.Fields(message)
-			s := k[0]
-			//we need to remove the service from the remaining message
-			i := len(s) + 1
-			if i < len(message) {
-				m := message[i:]
-				r = LogRecord{Service: s, Message: m}
-			}
-		}
 		//check for an empty message and discard
 		if len(strings.TrimSpace(r.Message)) == 0 {
 			continue
@@ -71,48 +99,28 @@ func ReadLogRecord(fname string, format string, lr []LogRecord, batchLimit int)
 }
 
 //This method expects records in the format {"service": "service-name", message: "log message"}
-//eg {"service":"remctld","message":"error receiving initial token: unexpected end of file"} if json or for text
+//eg {"service":"remctld","message":"error receiving initial token: unexpected end of file"} if json, or with
+//the json paths of the [input] section of the config, or for text
 //service [space] message, eg: remctld error receiving initial token: unexpected end of file.
+//The rfc3164 and rfc5424 formats read raw syslog lines, the app-name is the service.
+//The logfmt format is read as text. The cef and leef formats read the security events, the
+//device product is the service.
+//The lines of the multi-line events are joined in a record, as set in the [multiline] section of the config.
+//On the stdin, the pending event is returned after the timeout of the section, or with the next batch
+//read with the same reader.
 //See Examples folder for example files.
 //Returns a map.
-func ReadLogRecordAsMap(iscan *bufio.Scanner, format string, smap map[string]LogRecordCollection, batchLimit int) (int, map[string]LogRecordCollection, bool) {
+func ReadLogRecordAsMap(reader *LogReader, format string, smap map[string]LogRecordCollection, batchLimit int) (int, map[string]LogRecordCollection, bool) {
 	var lr LogRecordCollection
 	var count = 0
 	var exit = false
-	var r LogRecord
-	for iscan.Scan() {
-		message := iscan.Text()
-		//
-		if len(strings.TrimSpace(message)) == 0 {
-			break
-		}
-		if strings.TrimSpace(message) == "exit" {
+	for {
+		r, next := reader.read(format, true)
+		if next == readExit {
 			exit = true
-			break
 		}
-		if message[0] == '#' {
-			continue
-		}
-		if format == "json" {
-			r = LogRecord{}
-			_ = json.Unmarshal([]byte(message), &r)
-			//check for an empty service and set it to none
-			//TODO: Review if these should be discarded too
-			if r.Service == "" {
-				r.Service = "none"
-			}
-		} else {
-			//the first field is the service, delimited by a space
-			k := strings.Fields(message)
-			s := k[0]
-			//we need to remove the service from the remaining message
-			i := len(s) + 1
-			if i < len(message) {
-				m := message[i:]
-				r = LogRecord{Service: s, Message: m}
-			} else {
-				r = LogRecord{Service: s, Message: ""}
-			}
+		if next != readRecord {
+			break
 		}
 		//check for an empty message and discard
 		if len(strings.TrimSpace(r.Message)) == 0 {
@@ -134,3 +142,36 @@ func ReadLogRecordAsMap(iscan *bufio.Scanner, format string, smap map[string]Log
 	}
 	return count, smap, exit
 }
+
+//parseLogRecord returns the log record of a line in the format, and false if it has been written
+//to the rejects file.
+func (this *LogReader) parseLogRecord(message string, format string) (LogRecord, bool) {
+	var r LogRecord
+	if format == "json" {
+		var ok bool
+		if r, ok = parseJsonRecord(message); !ok && this.rejectRecord(message) {
+			return r, false
+		}
+		//check for an empty service and set it to none
+		if r.Service == "" {
+			r.Service = "none"
+		}
+	} else if format == "rfc3164" || format == "rfc5424" {
+		r = parseSyslogRecord(message, format)
+	} else if format == "cef" || format == "leef" {
+		r = parseSecurityEventRecord(message, format)
+	} else {
+		//the first field is the service, delimited by a space
+		k := strings.Fields(message)
+		s := k[0]
+		//we need to remove the service from the remaining message
+		i := len(s) + 1
+		if i < len(message) {
+			m := message[i:]
+			r = LogRecord{Service: s, Message: m}
+		} else {
+			r = LogRecord{Service: s, Message: ""}
+		}
+	}
+	return r, true
+}
@@ -0,0 +1,203 @@
+package sequence
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadLogRecordSyslog(t *testing.T) {
+	tests := []struct {
+		format string
+		line   string
+		record LogRecord
+	}{
+		{
+			"rfc3164",
+			"<34>Oct 11 22:14:15 mymachine su[230]: 'su root' failed for lonvick on /dev/pts/8",
+			LogRecord{Service: "su", Message: "'su root' failed for lonvick on /dev/pts/8", Priority: "34", Timestamp: "Oct 11 22:14:15", Host: "mymachine", ProcId: "230"},
+		},
+		{
+			"rfc3164",
+			"Oct  1 02:04:05 node12 kernel: eth0: link up",
+			LogRecord{Service: "kernel", Message: "eth0: link up", Timestamp: "Oct  1 02:04:05", Host: "node12"},
+		},
+		{
+			"rfc3164",
+			"<13>2023-10-11T22:14:15.003+02:00 node12 sshd[99]: Accepted publickey for root",
+			LogRecord{Service: "sshd", Message: "Accepted publickey for root", Priority: "13", Timestamp: "2023-10-11T22:14:15.003+02:00", Host: "node12", ProcId: "99"},
+		},
+		{
+			"rfc3164",
+			"not a syslog line",
+			LogRecord{Service: "none", Message: "not a syslog line"},
+		},
+		{
+			"rfc5424",
+			`<34>1 2023-10-11T22:14:15Z host app 123 ID47 [exampleSDID@32473 iut="3" eventSource="App\]lication"][meta seq="1"] 'su root' failed`,
+			LogRecord{Service: "app", Message: "'su root' failed", Priority: "34", Timestamp: "2023-10-11T22:14:15Z", Host: "host", ProcId: "123", MsgId: "ID47",
+				StructuredData: `[exampleSDID@32473 iut="3" eventSource="App\]lication"][meta seq="1"]`},
+		},
+		{
+			"rfc5424",
+			"<165>1 2003-08-24T05:14:15.000003-07:00 192.0.2.1 myproc 8710 - - \uFEFF%% It's time to make the do-nuts.",
+			LogRecord{Service: "myproc", Message: "%% It's time to make the do-nuts.", Priority: "165", Timestamp: "2003-08-24T05:14:15.000003-07:00", Host: "192.0.2.1", ProcId: "8710"},
+		},
+		{
+			"rfc5424",
+			"<34>1 2023-10-11T22:14:15Z host - - - -",
+			LogRecord{Service: "none", Message: "<34>1 2023-10-11T22:14:15Z host - - - -"},
+		},
+	}
+
+	for _, tc := range tests {
+		smap := make(map[string]LogRecordCollection)
+		count, smap, _ := ReadLogRecordAsMap(NewLogReader(bufio.NewScanner(strings.NewReader(tc.line))), tc.format, smap, 0)
+		require.Equal(t, 1, count, tc.line)
+		require.Equal(t, []LogRecord{tc.record}, smap[tc.record.Service].Records, tc.line)
+	}
+
+	params := ParseStructuredData(`[exampleSDID@32473 iut="3" eventSource="App\]lication"][meta seq="1" q="a \"b\""]`)
+	require.Equal(t, map[string]string{"exampleSDID@32473.iut": "3", "exampleSDID@32473.eventSource": "App]lication", "meta.seq": "1", "meta.q": `a "b"`}, params)
+
+	// the header is saved with the examples in the database
+	var r LogRecord
+	for _, tc := range tests {
+		if tc.record.StructuredData != "" {
+			r = tc.record
+		}
+	}
+	require.Equal(t, map[string]string{"exampleSDID@32473.iut": "3", "exampleSDID@32473.eventSource": "App]lication", "meta.seq": "1"}, r.Params())
+	saved := LogRecord{Service: r.Service, Message: r.Message}
+	require.NoError(t, saved.SetHeader(r.Header()))
+	require.Equal(t, r, saved)
+	require.Equal(t, "", LogRecord{Service: "app", Message: "m"}.Header())
+	require.Error(t, saved.SetHeader("{"))
+}
+
+func TestReadLogRecordMultiLine(t *testing.T) {
+	require.NoError(t, readMultiLine(`^[a-z]+ \d{4}-\d\d-\d\d `, true, 3, ""))
+	defer readMultiLine("", false, 0, "")
+
+	lines := "app 2023-10-11 12:00:00 ERROR request failed\n" +
+		"java.lang.NullPointerException: null\n" +
+		"\tat com.example.Handler.run(Handler.java:42)\n" +
+		"\tat java.lang.Thread.run(Thread.java:748)\n" +
+		"app 2023-10-11 12:00:01 INFO request done\n"
+	smap := make(map[string]LogRecordCollection)
+	count, smap, _ := ReadLogRecordAsMap(NewLogReader(bufio.NewScanner(strings.NewReader(lines))), "txt", smap, 0)
+	require.Equal(t, 3, count)
+	records := smap["app"].Records
+	require.Equal(t, "2023-10-11 12:00:00 ERROR request failed\njava.lang.NullPointerException: null\n\tat com.example.Handler.run(Handler.java:42)", records[0].Message)
+	require.Equal(t, "2023-10-11 12:00:01 INFO request done", records[1].Message)
+	// the line after maxlines begins a new record
+	require.Len(t, smap["at"].Records, 1)
+
+	// the tail of the event is a single token
+	seq, _, err := NewScanner().Scan(records[0].Message, false, nil)
+	require.NoError(t, err)
+	require.Equal(t, TokenMultiLine, seq[len(seq)-1].Type)
+	require.Equal(t, len(records[0].Message), seq[len(seq)-1].End)
+
+	// the comment lines are only skipped when they would begin a record
+	lines = "# app 2023-10-11 11:59:59 header\n" +
+		"app 2023-10-11 12:00:00 ERROR config dump\n" +
+		"# generated by app\n" +
+		"key = value\n" +
+		"app 2023-10-11 12:00:01 INFO done\n"
+	smap = make(map[string]LogRecordCollection)
+	count, smap, _ = ReadLogRecordAsMap(NewLogReader(bufio.NewScanner(strings.NewReader(lines))), "txt", smap, 0)
+	require.Equal(t, 2, count)
+	require.Equal(t, "2023-10-11 12:00:00 ERROR config dump\n# generated by app\nkey = value", smap["app"].Records[0].Message)
+	require.Equal(t, "2023-10-11 12:00:01 INFO done", smap["app"].Records[1].Message)
+
+	// the json records of the same service are joined
+	require.NoError(t, readMultiLine("", true, 0, ""))
+	lines = `{"service": "worker", "message": "Traceback (most recent call last):"}` + "\n" +
+		`{"service": "worker", "message": "  File \"job.py\", line 3, in <module>"}` + "\n" +
+		`{"service": "web", "message": "  GET /index.html"}` + "\n\n" +
+		`{"service": "worker", "message": "job done"}` + "\n"
+	reader := NewLogReader(bufio.NewScanner(strings.NewReader(lines)))
+	smap = make(map[string]LogRecordCollection)
+	count, smap, _ = ReadLogRecordAsMap(reader, "json", smap, 0)
+	require.Equal(t, 2, count)
+	require.Equal(t, "Traceback (most recent call last):\n  File \"job.py\", line 3, in <module>", smap["worker"].Records[0].Message)
+	require.Equal(t, "  GET /index.html", smap["web"].Records[0].Message)
+	count, smap, _ = ReadLogRecordAsMap(reader, "json", smap, 0)
+	require.Equal(t, 1, count)
+	require.Equal(t, "job done", smap["worker"].Records[1].Message)
+
+	// on the stdin, the pending event is returned after the timeout
+	require.NoError(t, readMultiLine("", true, 0, "20ms"))
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	reader = newLogReader(bufio.NewScanner(pr), true)
+	go pw.Write([]byte("app first line\n  second line\napp next\napp last\n"))
+	smap = make(map[string]LogRecordCollection)
+	count, smap, _ = ReadLogRecordAsMap(reader, "txt", smap, 1)
+	require.Equal(t, 1, count)
+	require.Equal(t, "first line\n  second line", smap["app"].Records[0].Message)
+
+	// the goroutine reading the lines stops when the reader is closed before the end of the input
+	fed := reader.lines
+	require.NoError(t, reader.Close())
+	for range fed {
+	}
+	count, _, _ = ReadLogRecordAsMap(reader, "txt", make(map[string]LogRecordCollection), 0)
+	require.Equal(t, 0, count)
+
+	require.Error(t, readMultiLine("(", false, 0, ""))
+	require.Error(t, readMultiLine("", true, 0, "2 s"))
+}
+
+func TestReadLogRecordInput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sequence")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	rejects := filepath.Join(dir, "rejects.json")
+
+	require.NoError(t, readInput("app", "log.message", "_HOSTNAME", "", rejects))
+	defer readInput("", "", "", "", "")
+
+	lines := `{"app": "billing", "log": {"message": "invoice 42 sent", "level": "info"}, "_HOSTNAME": "node12", "timestamp": "2023-10-11T22:14:15Z"}` + "\n" +
+		`{"app": "billing", "log.message": "invoice 43 sent"}` + "\n" +
+		`{"app": "billing", "msg": "no message at the path"}` + "\n" +
+		`{"log": {"message": "no service"}}` + "\n" +
+		`not json` + "\n"
+	smap := make(map[string]LogRecordCollection)
+	reader := NewLogReader(bufio.NewScanner(strings.NewReader(lines)))
+	count, smap, _ := ReadLogRecordAsMap(reader, "json", smap, 0)
+	require.Equal(t, 2, count)
+	require.Equal(t, []LogRecord{
+		{Service: "billing", Message: "invoice 42 sent", Host: "node12", Timestamp: "2023-10-11T22:14:15Z"},
+		{Service: "billing", Message: "invoice 43 sent"},
+	}, smap["billing"].Records)
+
+	// the rejects file is closed with the reader
+	require.NotNil(t, reader.rejects)
+	require.NoError(t, reader.Close())
+	require.Nil(t, reader.rejects)
+	data, err := ioutil.ReadFile(rejects)
+	require.NoError(t, err)
+	require.Equal(t, strings.Join(strings.Split(lines, "\n")[2:], "\n"), string(data))
+
+	// with no rejects file, the records with no service are read with the service none
+	require.NoError(t, readInput("app", "log.message", "", "", ""))
+	smap = make(map[string]LogRecordCollection)
+	count, smap, _ = ReadLogRecordAsMap(NewLogReader(bufio.NewScanner(strings.NewReader(lines))), "json", smap, 0)
+	require.Equal(t, 3, count)
+	require.Equal(t, "no service", smap["none"].Records[0].Message)
+
+	// the header fields are read at their keys, the numbers as they are written
+	r, ok := parseJsonRecord(`{"app": "sshd", "log": {"message": "accepted"}, "priority": 34, "procid": "902", "msgid": "ID47"}`)
+	require.True(t, ok)
+	require.Equal(t, LogRecord{Service: "sshd", Message: "accepted", Priority: "34", ProcId: "902", MsgId: "ID47"}, r)
+
+	require.Error(t, readInput("log..message", "", "", "", ""))
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/BurntSushi/toml"
 	"gitlab.in2p3.fr/cc-in2p3-system/sequence"
 	"index/suffixarray"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
@@ -23,6 +24,16 @@ var (
 		cfield  map[string]string
 	}
 	logger *sequence.StandardLogger
+
+	//a tag token with a /regex/ or {value|value} constraint
+	constraintTag = regexp.MustCompile(`%[A-Za-z0-9_]+(?::[A-Za-z0-9_+*-]*)*:(?:/.*?/|\{[^}]*\})%`)
+
+	//a tag or token type token, that can be a custom token type of the config
+	plainTag = regexp.MustCompile(`%[A-Za-z0-9_]+%`)
+
+	//a time tag with the regex id of its format, e.g. %regextime:1%, or a time tag or token with
+	//the unit of its epoch time stamps, e.g. %msgtime:epochms%
+	timeTag = regexp.MustCompile(`%(?:regextime:[0-9]+|[A-Za-z0-9_]+:epoch[a-z]*)%`)
 )
 
 func SetLogger(log *sequence.StandardLogger) {
@@ -94,21 +105,63 @@ func OutputToFiles(outfile string, config string, complexitylevel float64, cmap
 	//add all the patterns here
 	//match => { "message" => "Duration: %{NUMBER:duration}", "Speed: %{NUMBER:speed}" }
 	//add_tag => [ "id_value", "pattern_id" ]
+	skipped := 0
 	for _, result := range patmap {
-		fmt.Fprintf(txtFile, "\tgrok {\n \t\tmatch => {\"message\" => \"%s\"}\n\t\tadd_tag => [\"%s\", \"pattern_id\"]\n\t}\n", replaceTags(result.Pattern), result.PatternId)
+		//the keys of the xml patterns are the paths of the elements, which are not in the messages
+		if sequence.IsXmlPattern(result) {
+			skipped++
+			continue
+		}
+		fmt.Fprintf(txtFile, "\tgrok {\n \t\tmatch => {\"message\" => %s}\n\t\tadd_tag => [\"%s\", \"pattern_id\"]\n\t}\n", grokMatch(result), result.PatternId)
+		if _, ok := sequence.TrimEmbeddedJson(result.Pattern); ok {
+			fmt.Fprint(txtFile, jsonFilter(result.PatternId))
+		}
 	}
 	fmt.Fprintf(txtFile, "}\n")
+	if skipped > 0 {
+		logger.HandleInfo(fmt.Sprintf("Skipped %d patterns of XML messages in the grok output", skipped))
+	}
 	return 0, top5, nil
 }
 
+//grokMatch returns the patterns matched by the grok filter of the result, an array if the logfmt
+//pattern is written in several key orders, as the keys are sorted in the pattern.
+func grokMatch(result sequence.AnalyzerResult) string {
+	patterns := sequence.LogfmtPatterns(result)
+	if len(patterns) < 2 {
+		if len(patterns) == 0 {
+			patterns = []string{result.Pattern}
+		}
+		return fmt.Sprintf("\"%s\"", replaceTags(patterns[0]))
+	}
+	quoted := make([]string, len(patterns))
+	for i, p := range patterns {
+		quoted[i] = fmt.Sprintf("\"%s\"", replaceTags(p))
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+//jsonFilter returns the json filter parsing the json captured in the messages
+//matched by the pattern, into a field of the same name.
+func jsonFilter(patternId string) string {
+	field := checkForCustomFieldName("json")
+	return fmt.Sprintf("\tif \"%s\" in [tags] {\n\t\tjson {\n\t\t\tsource => \"%s\"\n\t\t\ttarget => \"%s\"\n\t\t}\n\t}\n", patternId, field, field)
+}
+
 //This replaces the sequence tags with the grok formatted tags
 func replaceTags(pattern string) string {
 	//make sure " are escaped \" before we start
 	//pattern = strings.Replace(pattern, "\"", "\\\"", -1)
+	//the json embedded in a text message is left to the json filter
+	pattern, _ = sequence.TrimEmbeddedJson(pattern)
 	s := strings.Fields(pattern)
 	var new []string
+	var named []string
 	mtc := make(map[string]int)
 	for _, p := range s {
+		p, mtc, named = replaceConstraints(p, mtc, named)
+		p, mtc, named = replaceCustomTokens(p, mtc, named)
+		p, mtc, named = replaceTimeTags(p, mtc, named)
 		if val, ok := tags.general[p]; ok {
 			p, mtc = getUpdatedTag(p, mtc, val, "")
 		} else {
@@ -127,9 +180,67 @@ func replaceTags(pattern string) string {
 
 	replacer := strings.NewReplacer("\"", "\\\"", "[", "\\[", "]", "\\]", "(", "\\(", ")", "\\)")
 	output := replacer.Replace(result)
+	for i, r := range named {
+		output = strings.Replace(output, constraintPlaceholder(i), r, 1)
+	}
 	return output
 }
 
+//the tags with a constraint are replaced by a named capture matching the same values
+//a placeholder is put in the pattern so the regex is not escaped with the rest of the pattern
+func replaceConstraints(p string, mtc map[string]int, named []string) (string, map[string]int, []string) {
+	for _, m := range constraintTag.FindAllString(p, -1) {
+		tag, re, ok := sequence.TagConstraintRegex(m)
+		if !ok {
+			continue
+		}
+		//the pattern is in a double quoted string in the config, escape the quotes like the rest of the pattern
+		re = strings.Replace(re, "\"", "\\\"", -1)
+		var val string
+		val, mtc = getUpdatedTag("%"+strings.Split(tag[1:len(tag)-1], ":")[0]+"%", mtc, "(?<[fieldname]>"+re+")", "")
+		p = strings.Replace(p, m, constraintPlaceholder(len(named)), 1)
+		named = append(named, val)
+	}
+	return p, mtc, named
+}
+
+//the custom token types of the config are replaced by a named capture with their regex
+func replaceCustomTokens(p string, mtc map[string]int, named []string) (string, map[string]int, []string) {
+	for _, m := range plainTag.FindAllString(p, -1) {
+		re, ok := sequence.GetCustomTokenRegex(m[1 : len(m)-1])
+		if !ok {
+			continue
+		}
+		re = strings.Replace(re, "\"", "\\\"", -1)
+		var val string
+		val, mtc = getUpdatedTag(m, mtc, "(?<[fieldname]>"+re+")", "")
+		p = strings.Replace(p, m, constraintPlaceholder(len(named)), 1)
+		named = append(named, val)
+	}
+	return p, mtc, named
+}
+
+//the time stamps are replaced by the grok pattern of their format or epoch unit in the timesettings
+//a placeholder is put in the pattern so the regex of the locale names is not escaped
+func replaceTimeTags(p string, mtc map[string]int, named []string) (string, map[string]int, []string) {
+	for _, m := range timeTag.FindAllString(p, -1) {
+		i := strings.Index(m, ":")
+		gk, ok := sequence.GetTimeSettingsGrokValue(m[i+1 : len(m)-1])
+		if !ok || gk == "" {
+			continue
+		}
+		var val string
+		val, mtc = getUpdatedTag(m[:i]+"%", mtc, gk, "")
+		p = strings.Replace(p, m, constraintPlaceholder(len(named)), 1)
+		named = append(named, val)
+	}
+	return p, mtc, named
+}
+
+func constraintPlaceholder(i int) string {
+	return "\x00" + strconv.Itoa(i) + "\x00"
+}
+
 //
 func getUpdatedTag(p string, mtc map[string]int, tag string, del string) (string, map[string]int) {
 	tok := ""
@@ -206,7 +317,8 @@ func getWithDelimiters(p string, start, end int, last int) (string, string, stri
 	fieldname := p[start+1 : end-1]
 	before := ""
 	//integer and ip fields are not considered strings so can bypass this
-	if fieldname == "integer" || fieldname == "srcip" || fieldname == "dstip" || fieldname == "float" || fieldname == "ipv6" {
+	if fieldname == "integer" || fieldname == "srcip" || fieldname == "dstip" || fieldname == "float" || fieldname == "ipv6" || fieldname == "uuid" || fieldname == "hex" ||
+		fieldname == "timespan" || fieldname == "size" || fieldname == "percent" || fieldname == "host" || fieldname == "email" {
 		return p[start:end], "", fieldname, end - 1
 	}
 	if start > 0 && end < len(p) {
@@ -3,6 +3,9 @@ package logstash_grok
 import (
 	"github.com/stretchr/testify/require"
 	"gitlab.in2p3.fr/cc-in2p3-system/sequence"
+	"io/ioutil"
+	"os"
+	"strings"
 	"testing"
 )
 
@@ -21,9 +24,23 @@ var (
 		{"%integer% ", "%{INT:integer}"},
 		{"%string%,%string%", "%{DATA:string},%{DATA:string1}"},
 		{"%srcmac%", "%{MAC:srcmac}"},
+		{"id=%uuid% ", "id=%{UUID:uuid}"},
+		{"%hex%,", "%{BASE16NUM:hex},"},
+		{"open %path% ", "open %{PATH:path}"},
+		{"took %timespan% ", "took %{NOTSPACE:timespan}"},
+		{"usage %percent% ", "usage %{NUMBER:percent}%"},
+		{"from %host% ", "from %{HOSTNAME:host}"},
+		{"to <%email%>", "to <%{EMAILADDRESS:email}>"},
 		{"%srchost% ", "%{HOSTNAME:srchost}"},
 		{"<%string%>,", "<%{DATA:string}>,"},
 		{"%multiline%", "%{GREEDYDATA:multiline}"},
+		{"login failed: %json% attempts=%integer% user=%string%", "login failed: %{GREEDYDATA:json}"},
+		{"login failed: %json% json.0=%integer% %json% from %srcip%", "login failed: %{GREEDYDATA:json} from %{IP:srcip}"},
+		{"at %msgtime:epochms% ", "at %{INT:timestamp}"},
+		{"%time:epoch%,", "%{NUMBER:time},"},
+		{"%status:string:/^(ok|fail)$/% ", "(?<status>(?:(ok|fail)))"},
+		{"[%status:/^(ok|fail)$/%]", "\\[(?<status>(?:(ok|fail)))\\]"},
+		{"%action:{allow|deny}% %action:{a.b|c}%", "(?<action>(?:allow|deny)) (?<action1>(?:a\\.b|c))"},
 	}
 )
 
@@ -33,6 +50,32 @@ func loadConfigs() {
 	sequence.ReadConfig(file)
 }
 
+// readTestConfig reads ../sequence.toml with the sections added, in the sequence
+// package and here, the callers call loadConfigs when they are done.
+func readTestConfig(sections string) error {
+	data, err := ioutil.ReadFile("../sequence.toml")
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile("", "sequence*.toml")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString(string(data) + "\n" + sections)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err := sequence.ReadConfig(f.Name()); err != nil {
+		return err
+	}
+	return readConfig(f.Name())
+}
+
 func TestTagTransformation(t *testing.T) {
 	loadConfigs()
 	for _, tc := range tagtests {
@@ -40,3 +83,48 @@ func TestTagTransformation(t *testing.T) {
 		require.Equal(t, tc.result, tag, tc.data)
 	}
 }
+
+func TestCustomTokenTransformation(t *testing.T) {
+	defer loadConfigs()
+	require.NoError(t, readTestConfig("[tokens.custom.jobid]\nregex = 'job\\.[0-9]+\\.[a-z]+'\n"))
+
+	for _, tc := range []struct {
+		data   string
+		result string
+	}{
+		{"job %jobid% started", "job (?<jobid>job\\.[0-9]+\\.[a-z]+) started"},
+		{"[%jobid%]", "\\[(?<jobid>job\\.[0-9]+\\.[a-z]+)\\]"},
+	} {
+		tag := replaceTags(tc.data)
+		require.Equal(t, tc.result, tag, tc.data)
+	}
+}
+
+func TestTimeLocaleTransformation(t *testing.T) {
+	loadConfigs()
+	tag := replaceTags("%regextime:7% [%integer%]")
+	require.Contains(t, tag, "|january|")
+	require.NotContains(t, tag, "|janv\\.|")
+
+	// the locales are commented out in sequence.toml
+	locales, err := ioutil.ReadFile("../testdata/locales.toml")
+	require.NoError(t, err)
+	defer loadConfigs()
+	require.NoError(t, readTestConfig(string(locales)))
+
+	// the regex of the month names is not escaped with the rest of the pattern
+	tag = replaceTags("%regextime:7% [%integer%]")
+	require.True(t, strings.HasPrefix(tag, "(?<timestamp>%{MONTHDAY} (?i:"), tag)
+	require.True(t, strings.HasSuffix(tag, ") %{YEAR} %{TIME}) \\[%{INT:integer}\\]"), tag)
+	require.Contains(t, tag, "|janv\\.|")
+}
+
+func TestGrokMatchLogfmt(t *testing.T) {
+	loadConfigs()
+	ar := sequence.AnalyzerResult{PatternId: "id1", Pattern: "level=%string% took=%timespan%", TagPositions: "6,20",
+		Examples: []sequence.LogRecord{{Message: "level=info took=3ms"}, {Message: "took=12ms level=error"}}}
+	require.Equal(t, `["level=%{DATA:string} took=%{NOTSPACE:timespan}", "took=%{NOTSPACE:timespan} level=%{DATA:string}"]`, grokMatch(ar))
+
+	ar.Examples = ar.Examples[:1]
+	require.Equal(t, `"level=%{DATA:string} took=%{NOTSPACE:timespan}"`, grokMatch(ar))
+}
@@ -19,6 +19,7 @@ import (
 	"io"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
 type Message struct {
@@ -97,6 +98,8 @@ func (this *Message) Tokenize(isParse bool, pos []int) (Token, error) {
 					Tag:   TagUnknown,
 					Type:  TokenLiteral,
 					Value: " ",
+					Start: this.state.start,
+					End:   this.state.start + 1,
 				}
 				this.state.start += 1
 				return tok, nil
@@ -117,11 +120,21 @@ func (this *Message) Tokenize(isParse bool, pos []int) (Token, error) {
 					}
 				}
 
+				//a constraint, /regex/ or {value|value}, can follow a colon in the tag
+				if (r == '/' || r == '{') && i > 0 && this.Data[this.state.start+i] == ':' {
+					if c := tagConstraintLen(this.Data[this.state.start+i+1:]); c > 0 {
+						i += c
+						r = '%'
+					}
+				}
+
 				if r == '%' && i > 0 {
 					tok := Token{
 						Tag:   TagUnknown,
 						Type:  TokenLiteral,
 						Value: this.Data[this.state.start : this.state.start+i+2],
+						Start: this.state.start,
+						End:   this.state.start + i + 2,
 					}
 
 					this.state.start += i + 2
@@ -154,12 +167,14 @@ func (this *Message) Tokenize(isParse bool, pos []int) (Token, error) {
 		//check the literal for any signs of it containing a tag symbol
 		val := this.Data[this.state.start : this.state.start+l]
 		tok.Value = val
+		tok.Start, tok.End = this.state.start, this.state.start+l
 		this.state.tokCount++
 		this.state.prevToken = tok
 		this.state.start += l + s
 
 		//this is for dealing with multiline strings and setting everything after the \n to a single token
 		//these can be super long so I have truncated it at 50 chars for the value as it is not really used.
+		//the offsets of the token still cover everything after the \n.
 		if tok.Value == "\n" {
 			l = len(this.Data[this.state.start:])
 			if l > 15 {
@@ -167,10 +182,12 @@ func (this *Message) Tokenize(isParse bool, pos []int) (Token, error) {
 			} else {
 				tok.Value = this.Data[this.state.start:]
 			}
+			tok.Start, tok.End = this.state.start, this.state.start+l
 			this.state.start += l
 			tok.Type = TokenMultiLine
 		} else if strings.Contains(tok.Value, "\n") && this.state.prevToken.Value != "\"" {
 			tok.Value = this.Data[this.state.start:]
+			tok.Start, tok.End = this.state.start, this.state.start+len(tok.Value)
 			this.state.start += len(tok.Value)
 			tok.Type = TokenMultiLine
 		}
@@ -207,6 +224,30 @@ func (this *Message) scanToken(data string, nt int) (int, Token, error) {
 
 	this.resetTokenStates()
 
+	// the custom token types of the config come first, they are what the site
+	// knows of its own logs
+	if n, t := this.scanCustom(data, nt); n > 0 {
+		return n, Token{Type: t, Tag: tagType}, nil
+	}
+
+	// uuids and hex numbers are checked next, the hex and token state machines
+	// would split them or see them as literals
+	if n, t := this.scanHash(data, nt); n > 0 {
+		return n, Token{Type: t, Tag: tagType}, nil
+	}
+
+	if n := this.scanPath(data, nt); n > 0 {
+		return n, Token{Type: TokenPath, Tag: tagType}, nil
+	}
+
+	if n, subtype := this.scanEpoch(data, nt); n > 0 {
+		return n, Token{Type: TokenTime, Tag: tagType, Special: subtype}, nil
+	}
+
+	if n, t := this.scanQuantity(data, nt); n > 0 {
+		return n, Token{Type: t, Tag: tagType}, nil
+	}
+
 	// short circuit the hex check
 	if l < 3 {
 		hexStop = true
@@ -238,7 +279,7 @@ func (this *Message) scanToken(data string, nt int) (int, Token, error) {
 		if !tokenStop {
 			tokenStop = this.tokenStep(i, r, s)
 			if !tokenStop {
-				tokenLen++
+				tokenLen += utf8.RuneLen(r)
 			}
 		}
 
@@ -253,14 +294,15 @@ func (this *Message) scanToken(data string, nt int) (int, Token, error) {
 		if !timeStop {
 			if tnode, timeStop = timeStep(r, tnode); timeStop == true {
 				if timeLen > 0 {
-					if tnode.regextype != "" {
-						tagType = TagRegExTime
-					}
-					return timeLen, Token{Type: TokenTime, Tag: tagType, Special: tnode.regextype}, nil
+					return this.timeToken(data, nt, timeLen, tnode)
 				}
 			} else if tnode.final == TokenTime {
-				if i+1 > timeLen {
-					timeLen = i + 1
+				if i+utf8.RuneLen(r) > timeLen {
+					timeLen = i + utf8.RuneLen(r)
+				}
+				// the words before the time are not names of months or days
+				if !timeNamesValid(data[:timeLen]) {
+					timeLen, timeStop = 0, true
 				}
 			}
 		}
@@ -269,10 +311,7 @@ func (this *Message) scanToken(data string, nt int) (int, Token, error) {
 		// This means either we found something, or we have exhausted the string
 		if (tokenStop && timeStop && hexStop) || i == l-1 {
 			if timeLen > 0 {
-				if tnode.regextype != "" {
-					tagType = TagRegExTime
-				}
-				return timeLen, Token{Type: TokenTime, Tag: tagType, Special: tnode.regextype}, nil
+				return this.timeToken(data, nt, timeLen, tnode)
 			} else if hexLen > 0 && this.state.hexColons > 1 {
 				if this.state.hexColons == 5 && this.state.hexMaxSuccColons == 1 {
 					//if the end of the message there won't be an extra space
@@ -310,13 +349,13 @@ func (this *Message) scanToken(data string, nt int) (int, Token, error) {
 					}
 
 				case TokenFloat:
-					if r == '.' && i == l-1 {
+					if r == '.' && i == l-1 && tokenLen == l {
 						tokenLen--
 						this.state.tokenType = TokenInteger
 					}
 				//if the sentence finishes with a . it is likely to be punctuation remove it so it makes its own token.
 				case TokenLiteral:
-					if r == '.' && i == l-1 && tokenLen > 1 {
+					if r == '.' && i == l-1 && tokenLen == l && tokenLen > 1 {
 						tokenLen--
 					}
 				}
@@ -664,6 +703,182 @@ func (this *Message) hexStep(i int, r rune, nr string) (bool, bool) {
 	return false, true
 }
 
+// timeToken returns the time stamp of length n found by the time FSM, with the
+// digits of its fractional seconds that are not in the format, and the time zone
+// that follows them.
+func (this *Message) timeToken(data string, nt, n int, tnode *timeNode) (int, Token, error) {
+	tagType := TagUnknown
+	if tnode.regextype != "" {
+		tagType = TagRegExTime
+	}
+
+	// the FSM can stop at the sign of the zone after the seconds
+	if n > 1 && (data[n-1] == '+' || data[n-1] == '-') && timeSecondsEnd(data, n-1) {
+		n--
+	}
+	if f := timeFractionLen(data, n); f > 0 && (nt <= 0 || n+f <= nt) {
+		n += f
+	}
+	if z := timeZoneLen(data, n); z > 0 && (nt <= 0 || n+z <= nt) {
+		n += z
+	}
+
+	return n, Token{Type: TokenTime, Tag: tagType, Special: tnode.regextype}, nil
+}
+
+// scanHash returns the length and type of the uuid or hex number at the start of
+// data, or 0 if there is none. The hex numbers must have at least minHashLength
+// hex digits with both digits and letters, such as a git sha or a digest, so that
+// words and integers are not taken for hex numbers. Values such as 0x1f are left
+// to the literals.
+func (this *Message) scanHash(data string, nt int) (int, TokenType) {
+	n, t := uuidLen(data), TokenUUID
+	if n == 0 {
+		n, t = hexNumLen(data), TokenHex
+	}
+
+	// the token must end there, and not go over the next tag position of a pattern
+	if n == 0 || (nt > 0 && n > nt) {
+		return 0, TokenUnknown
+	}
+
+	if n < len(data) {
+		r := rune(data[n])
+		switch {
+		case r == '.':
+			// the end of a sentence
+			if n+1 < len(data) && data[n+1] != ' ' {
+				return 0, TokenUnknown
+			}
+		case isLiteral(r) || r == ':':
+			return 0, TokenUnknown
+		case this.state.inquote && !matchQuote(this.state.chquote, r):
+			// the quoted string goes on
+			return 0, TokenUnknown
+		}
+	}
+
+	return n, t
+}
+
+// the minimum number of digits of a hex number
+const minHashLength = 12
+
+// uuidLen returns the length of the uuid at the start of data, 8-4-4-4-12 hex
+// digits, or 0 if there is none.
+func uuidLen(data string) int {
+	if len(data) < 36 {
+		return 0
+	}
+
+	for i := 0; i < 36; i++ {
+		switch i {
+		case 8, 13, 18, 23:
+			if data[i] != '-' {
+				return 0
+			}
+		default:
+			if !isHex(rune(data[i])) {
+				return 0
+			}
+		}
+	}
+
+	return 36
+}
+
+// hexNumLen returns the length of the hex number at the start of data, or 0 if
+// there is none, see scanHash.
+func hexNumLen(data string) int {
+	i, digits := 0, 0
+	for i < len(data) && isHex(rune(data[i])) {
+		if isDigit(rune(data[i])) {
+			digits++
+		}
+		i++
+	}
+
+	if i < minHashLength || digits == 0 || digits == i {
+		return 0
+	}
+
+	return i
+}
+
+// scanPath returns the length of the file system path at the start of data, or 0
+// if there is none. The absolute paths start with a / and the relative ones with
+// ./, ../ or ~/, and they must have a letter so that a lone / or a /24 network
+// prefix are not paths. A path right after an opening quote goes on through the
+// spaces up to the closing quote.
+func (this *Message) scanPath(data string, nt int) int {
+	switch {
+	case strings.HasPrefix(data, "//"):
+		return 0
+	case strings.HasPrefix(data, "/"), strings.HasPrefix(data, "./"), strings.HasPrefix(data, "../"), strings.HasPrefix(data, "~/"):
+	default:
+		return 0
+	}
+
+	// a / after an ipv4 address is the network prefix
+	if this.state.prevToken.Type == TokenIPv4 {
+		return 0
+	}
+
+	var (
+		n      int
+		letter bool
+		quoted = this.state.inquote && this.state.prevToken.Value == string(this.state.chquote)
+	)
+
+	for i, r := range data {
+		if quoted && matchQuote(this.state.chquote, r) {
+			break
+		}
+		// a comma or an equal sign ends a path that is not quoted, as in file=/a,mode=644
+		if !isPathChar(r) && !(quoted && (r == ' ' || r == ',' || r == '=')) {
+			// the quoted string is not only a path
+			if quoted {
+				return 0
+			}
+			break
+		}
+		letter = letter || unicode.IsLetter(r)
+		n = i + utf8.RuneLen(r)
+	}
+
+	if quoted && n == len(data) {
+		// no closing quote
+		return 0
+	}
+
+	if !letter || (nt > 0 && n > nt) {
+		return 0
+	}
+
+	if !quoted {
+		// a dot at the end of a sentence is not part of the path
+		if data[n-1] == '.' && (n == len(data) || data[n] == ' ') {
+			return n - 1
+		}
+
+		if n < len(data) {
+			if r, _ := utf8.DecodeRuneInString(data[n:]); isLiteral(r) || r == '\\' {
+				return 0
+			}
+		}
+	}
+
+	return n
+}
+
+func isPathChar(r rune) bool {
+	switch r {
+	case '/', '.', '-', '_', '+', '~', '@', '#':
+		return true
+	}
+	return r >= '0' && r <= '9' || unicode.IsLetter(r)
+}
+
 func (this *Message) reset() {
 	this.state.prevToken = Token{}
 	this.state.inquote = false
@@ -735,6 +950,19 @@ func isTagTokenChar(r rune) bool {
 	return 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || r >= '0' && r <= '9'
 }
 
+//Returns the length of the constraint at the start of data, up to the % that
+//closes the tag, or 0 if the constraint is not closed.
+func tagConstraintLen(data string) int {
+	end := "/%"
+	if data[0] == '{' {
+		end = "}%"
+	}
+	if i := strings.Index(data[1:], end); i >= 0 {
+		return i + 2
+	}
+	return 0
+}
+
 // q - quote char in state
 // r - current char
 func matchQuote(q, r rune) bool {
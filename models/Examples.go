@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/volatiletech/null"
 	"github.com/volatiletech/sqlboiler/boil"
 	"github.com/volatiletech/sqlboiler/queries"
 	"github.com/volatiletech/sqlboiler/queries/qm"
@@ -22,10 +23,11 @@ import (
 
 // Example is an object representing the database table.
 type Example struct {
-	ID            string `boil:"id" json:"id" toml:"id" yaml:"id"`
-	ServiceID     string `boil:"service_id" json:"service_id" toml:"service_id" yaml:"service_id"`
-	PatternID     string `boil:"pattern_id" json:"pattern_id" toml:"pattern_id" yaml:"pattern_id"`
-	ExampleDetail string `boil:"example_detail" json:"example_detail" toml:"example_detail" yaml:"example_detail"`
+	ID            string      `boil:"id" json:"id" toml:"id" yaml:"id"`
+	ServiceID     string      `boil:"service_id" json:"service_id" toml:"service_id" yaml:"service_id"`
+	PatternID     string      `boil:"pattern_id" json:"pattern_id" toml:"pattern_id" yaml:"pattern_id"`
+	ExampleDetail string      `boil:"example_detail" json:"example_detail" toml:"example_detail" yaml:"example_detail"`
+	ExampleHeader null.String `boil:"example_header" json:"example_header,omitempty" toml:"example_header" yaml:"example_header,omitempty"`
 
 	R *exampleR `boil:"-" json:"-" toml:"-" yaml:"-"`
 	L exampleL  `boil:"-" json:"-" toml:"-" yaml:"-"`
@@ -36,11 +38,13 @@ var ExampleColumns = struct {
 	ServiceID     string
 	PatternID     string
 	ExampleDetail string
+	ExampleHeader string
 }{
 	ID:            "id",
 	ServiceID:     "service_id",
 	PatternID:     "pattern_id",
 	ExampleDetail: "example_detail",
+	ExampleHeader: "example_header",
 }
 
 // Generated where
@@ -54,16 +58,41 @@ func (w whereHelperstring) LTE(x string) qm.QueryMod { return qmhelper.Where(w.f
 func (w whereHelperstring) GT(x string) qm.QueryMod  { return qmhelper.Where(w.field, qmhelper.GT, x) }
 func (w whereHelperstring) GTE(x string) qm.QueryMod { return qmhelper.Where(w.field, qmhelper.GTE, x) }
 
+type whereHelpernull_String struct{ field string }
+
+func (w whereHelpernull_String) EQ(x null.String) qm.QueryMod {
+	return qmhelper.WhereNullEQ(w.field, false, x)
+}
+func (w whereHelpernull_String) NEQ(x null.String) qm.QueryMod {
+	return qmhelper.WhereNullEQ(w.field, true, x)
+}
+func (w whereHelpernull_String) IsNull() qm.QueryMod    { return qmhelper.WhereIsNull(w.field) }
+func (w whereHelpernull_String) IsNotNull() qm.QueryMod { return qmhelper.WhereIsNotNull(w.field) }
+func (w whereHelpernull_String) LT(x null.String) qm.QueryMod {
+	return qmhelper.Where(w.field, qmhelper.LT, x)
+}
+func (w whereHelpernull_String) LTE(x null.String) qm.QueryMod {
+	return qmhelper.Where(w.field, qmhelper.LTE, x)
+}
+func (w whereHelpernull_String) GT(x null.String) qm.QueryMod {
+	return qmhelper.Where(w.field, qmhelper.GT, x)
+}
+func (w whereHelpernull_String) GTE(x null.String) qm.QueryMod {
+	return qmhelper.Where(w.field, qmhelper.GTE, x)
+}
+
 var ExampleWhere = struct {
 	ID            whereHelperstring
 	ServiceID     whereHelperstring
 	PatternID     whereHelperstring
 	ExampleDetail whereHelperstring
+	ExampleHeader whereHelpernull_String
 }{
 	ID:            whereHelperstring{field: `id`},
 	ServiceID:     whereHelperstring{field: `service_id`},
 	PatternID:     whereHelperstring{field: `pattern_id`},
 	ExampleDetail: whereHelperstring{field: `example_detail`},
+	ExampleHeader: whereHelpernull_String{field: `example_header`},
 }
 
 // ExampleRels is where relationship names are stored.
@@ -90,8 +119,8 @@ func (*exampleR) NewStruct() *exampleR {
 type exampleL struct{}
 
 var (
-	exampleColumns               = []string{"id", "service_id", "pattern_id", "example_detail"}
-	exampleColumnsWithoutDefault = []string{"id", "service_id", "pattern_id", "example_detail"}
+	exampleColumns               = []string{"id", "service_id", "pattern_id", "example_detail", "example_header"}
+	exampleColumnsWithoutDefault = []string{"id", "service_id", "pattern_id", "example_detail", "example_header"}
 	exampleColumnsWithDefault    = []string{}
 	examplePrimaryKeyColumns     = []string{"id"}
 )
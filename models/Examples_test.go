@@ -785,7 +785,7 @@ func testExamplesSelect(t *testing.T) {
 }
 
 var (
-	exampleDBTypes = map[string]string{`ID`: `STRING`, `ServiceID`: `STRING`, `PatternID`: `STRING (20, 50)`, `ExampleDetail`: `STRING (1000)`}
+	exampleDBTypes = map[string]string{`ID`: `STRING`, `ServiceID`: `STRING`, `PatternID`: `STRING (20, 50)`, `ExampleDetail`: `STRING (1000)`, `ExampleHeader`: `STRING`}
 	_              = bytes.MinRead
 )
 
@@ -0,0 +1,220 @@
+package sequence
+
+import (
+	"bufio"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+//The multi-line events, such as the Java stack traces and the Python tracebacks, are read as a
+//single log record when the [multiline] section of the config is set:
+//   - a line matching the start regex begins a new event, the other lines continue the current one
+//   - with indent, the lines starting with a space or a tab continue the current event
+//   - an event has at most maxlines lines, the next line begins a new event
+//   - on the stdin, the current event ends when no line is read during the timeout
+//
+//The lines of an event are joined with "\n" in the message of the record, so the scanner returns
+//everything after the first line as a TokenMultiLine. For the json format, the messages of the
+//records of the same service are joined, so each record has one line of the event, and the start
+//regex and indent are matched against the message of the record. For the other formats, the
+//continuation lines have no service or header, so they are matched against the raw line, and the
+//start regex must match the service or header at the start of the first line of the events.
+
+var multiline struct {
+	start    *regexp.Regexp
+	indent   bool
+	maxLines int
+	timeout  time.Duration
+}
+
+//the kinds of line returned by the log reader with a record
+const (
+	readRecord = iota
+	readBlank
+	readExit
+	readEnd
+)
+
+//LogReader reads the log records of an input, it keeps the pending multi-line event between the
+//batches read with ReadLogRecordAsMap. It must be closed when the reading stops.
+type LogReader struct {
+	iscan *bufio.Scanner
+	file  *os.File
+	//the lines read by a goroutine on the stdin, so the reader can time out, until done is closed
+	lines chan string
+	done  chan struct{}
+	//the rejects file of the json records with missing fields, opened on the first one
+	rejects *os.File
+	//the record of the event, and the number of its lines
+	pending *LogRecord
+	count   int
+	//the blank, exit or end of input read after the pending event
+	next int
+}
+
+//OpenLogReader opens the input file, or the stdin if fname is "-", for reading the log records.
+func OpenLogReader(fname string) (*LogReader, error) {
+	iscan, ifile, err := OpenInputFile(fname)
+	if err != nil {
+		if ifile != nil {
+			ifile.Close()
+		}
+		return nil, err
+	}
+	r := newLogReader(iscan, fname == "-")
+	r.file = ifile
+	return r, nil
+}
+
+//NewLogReader returns the reader of the log records of the scanner.
+func NewLogReader(iscan *bufio.Scanner) *LogReader {
+	return newLogReader(iscan, false)
+}
+
+//newLogReader returns the reader of the scanner, the lines of the stdin are read by a goroutine
+//when the multi-line events time out.
+func newLogReader(iscan *bufio.Scanner, stdin bool) *LogReader {
+	r := &LogReader{iscan: iscan}
+	if stdin && multiline.timeout > 0 && multiLineEnabled() {
+		lines, done := make(chan string), make(chan struct{})
+		r.lines, r.done = lines, done
+		go func() {
+			defer close(lines)
+			for iscan.Scan() {
+				select {
+				case lines <- iscan.Text():
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+	return r
+}
+
+//Close stops the goroutine reading the stdin, closes the rejects file and the input file opened
+//by OpenLogReader. The pending event is dropped.
+func (this *LogReader) Close() error {
+	if this.done != nil {
+		close(this.done)
+		this.done = nil
+	}
+	this.pending, this.count, this.next = nil, 0, readEnd
+
+	var err error
+	if this.rejects != nil {
+		err = this.rejects.Close()
+		this.rejects = nil
+	}
+	if this.file != nil {
+		if ferr := this.file.Close(); err == nil {
+			err = ferr
+		}
+		this.file = nil
+	}
+	return err
+}
+
+//multiLineEnabled is true if the lines can continue an event.
+func multiLineEnabled() bool {
+	return multiline.start != nil || multiline.indent
+}
+
+//continuesEvent returns true if the line continues the current event.
+func continuesEvent(line string) bool {
+	if multiline.indent && line != "" && (line[0] == ' ' || line[0] == '\t') {
+		return true
+	}
+	return multiline.start != nil && !multiline.start.MatchString(line)
+}
+
+//readLine returns the next line, or false at the end of the input or after the timeout, if there
+//is an event pending.
+func (this *LogReader) readLine() (string, bool, bool) {
+	if this.lines == nil {
+		if this.iscan.Scan() {
+			return this.iscan.Text(), true, false
+		}
+		return "", false, false
+	}
+
+	if this.pending == nil {
+		line, ok := <-this.lines
+		return line, ok, false
+	}
+	timer := time.NewTimer(multiline.timeout)
+	defer timer.Stop()
+	select {
+	case line, ok := <-this.lines:
+		return line, ok, false
+	case <-timer.C:
+		return "", true, true
+	}
+}
+
+//read returns the next log record, with the lines of its multi-line event, or the kind of line
+//that ends the reading of the batch: a blank line, exit if the exit word is read on the input, or
+//the end of the input. The comment lines are skipped, unless they continue the pending event.
+func (this *LogReader) read(format string, exit bool) (LogRecord, int) {
+	for {
+		if this.pending == nil && this.next != readRecord {
+			next := this.next
+			this.next = readRecord
+			return LogRecord{}, next
+		}
+
+		line, ok, timedOut := this.readLine()
+		switch {
+		case timedOut:
+			return this.flush(readRecord)
+		case !ok:
+			return this.flush(readEnd)
+		case strings.TrimSpace(line) == "":
+			return this.flush(readBlank)
+		case exit && strings.TrimSpace(line) == "exit":
+			return this.flush(readExit)
+		}
+
+		more := this.pending != nil && (multiline.maxLines == 0 || this.count < multiline.maxLines)
+		if more && format != "json" && continuesEvent(line) {
+			this.pending.Message += "\n" + line
+			this.count++
+			continue
+		}
+		//a comment line would begin a record
+		if line[0] == '#' {
+			continue
+		}
+		r, ok := this.parseLogRecord(line, format)
+		if !ok {
+			continue
+		}
+		if more && format == "json" && r.Service == this.pending.Service && continuesEvent(r.Message) {
+			this.pending.Message += "\n" + r.Message
+			this.count++
+			continue
+		}
+
+		prev := this.pending
+		this.pending, this.count = &r, 1
+		if !multiLineEnabled() || multiline.maxLines == 1 {
+			return this.flush(readRecord)
+		}
+		if prev != nil {
+			return *prev, readRecord
+		}
+	}
+}
+
+//flush returns the pending record, next is returned by the next read. If there is no pending
+//record, next is returned now.
+func (this *LogReader) flush(next int) (LogRecord, int) {
+	if this.pending == nil {
+		return LogRecord{}, next
+	}
+	r := *this.pending
+	this.pending, this.count, this.next = nil, 0, next
+	return r, readRecord
+}
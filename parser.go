@@ -16,9 +16,12 @@ package sequence
 
 import (
 	"fmt"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 const (
@@ -35,9 +38,58 @@ const (
 // matching pattern sequence. Each of the message tokens will be marked with the
 // semantic tag types.
 type Parser struct {
-	root   *parseNode
-	height int
-	mu     sync.RWMutex
+	// the counters of the messages not matched, first so they are aligned for the
+	// atomic operations, see EnableStats
+	noMatch     uint64
+	noMatchTime int64
+	statsSince  int64
+	statsOn     int32
+
+	root    *parseNode
+	height  int
+	ids     map[string]Sequence // the patterns added with an id, so they can be removed by id
+	options MatchOptions
+	mu      sync.RWMutex
+}
+
+// MatchOptions changes how the literals and the spacing of a message are compared
+// with the patterns. The parser and the analyzer take the same options, so the
+// analyzer only finds patterns the parser can tell apart.
+type MatchOptions struct {
+	// CaseInsensitive matches the literals regardless of their case, so "Accepted"
+	// and "accepted" are the same literal.
+	CaseInsensitive bool
+
+	// StrictSpacing requires a space before a token of the message where there is
+	// one in the pattern, and none where there is none. The spaces are only known
+	// when markSpaces is set in the config, otherwise it has no effect.
+	StrictSpacing bool
+}
+
+// DefaultMatchOptions returns the options set in the config, used by NewParser
+// and NewAnalyzer.
+func DefaultMatchOptions() MatchOptions {
+	return MatchOptions{
+		CaseInsensitive: config.caseInsensitive,
+		StrictSpacing:   config.strictSpacing,
+	}
+}
+
+// literalKey returns the key of a literal token in the literal children of a node.
+func (this MatchOptions) literalKey(token Token) string {
+	v := token.Value
+	if this.CaseInsensitive {
+		v = strings.ToLower(v)
+	}
+	if this.StrictSpacing && token.IsSpaceBefore {
+		v = " " + v
+	}
+	return v
+}
+
+// sameSpacing returns true if the token has the spacing of the pattern token.
+func (this MatchOptions) sameSpacing(pattern, token Token) bool {
+	return !this.StrictSpacing || pattern.IsSpaceBefore == token.IsSpaceBefore
 }
 
 type parseNode struct {
@@ -48,6 +100,13 @@ type parseNode struct {
 
 	minus bool // absorb the rest of the string?
 
+	// the value of the token must match the regex or be one of the enum values
+	regex *regexp.Regexp
+	enum  map[string]bool
+
+	// patterns ending at this leaf, the last one added is reported when matched
+	patterns []parsePattern
+
 	// token types children
 	tc [][]*parseNode
 
@@ -55,6 +114,12 @@ type parseNode struct {
 	lc map[string]*parseNode
 }
 
+type parsePattern struct {
+	id    string        // id of the pattern, can be empty
+	text  string        // text of the pattern
+	stats *patternStats // the match counters, see EnableStats
+}
+
 type stackParseNode struct {
 	node   *parseNode
 	level  int    // current level of the node
@@ -63,17 +128,58 @@ type stackParseNode struct {
 	value  string // value of the token evaluated
 }
 
+// ParseResult is the outcome of parsing a message with ParseWithResult. Besides the
+// tagged message sequence, it identifies the pattern that matched and carries the
+// extracted values keyed by field name.
+type ParseResult struct {
+	PatternId string            // PatternId is the id given when the pattern was added, can be empty.
+	Pattern   string            // Pattern is the text of the matched pattern.
+	Score     int               // Score is the score of the matching path, higher is better.
+	Sequence  Sequence          // Sequence is the message sequence, tagged by the pattern.
+	Fields    map[string]string // Fields maps the field names to the extracted values, see Sequence.Fields.
+}
+
+// Values returns the extracted values converted to their types, and the errors of
+// the fields that could not be converted, see Sequence.Values.
+func (this ParseResult) Values() (map[string]interface{}, map[string]error) {
+	return this.Sequence.Values(nil)
+}
+
+// PrefixResult is the outcome of parsing a message with ParsePrefix. It is a
+// ParseResult for the part of the message that matched.
+type PrefixResult struct {
+	ParseResult
+
+	Remainder int // Remainder is the index of the first token of the message that was not matched.
+}
+
 func (this stackParseNode) String() string {
 	return fmt.Sprintf("level=%d, score=%d, %s", this.level, this.score, this.node)
 }
 
 func NewParser() *Parser {
+	return NewParserWithOptions(DefaultMatchOptions())
+}
+
+// NewParserWithOptions returns a parser that compares the messages with the
+// patterns as set by the options.
+func NewParserWithOptions(options MatchOptions) *Parser {
 	return &Parser{
-		root:   newParseNode(),
-		height: 0,
+		root:    newParseNode(),
+		height:  0,
+		ids:     make(map[string]Sequence),
+		options: options,
 	}
 }
 
+// Options returns the options the parser compares the messages with.
+func (this *Parser) Options() MatchOptions {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+
+	return this.options
+}
+
 func newParseNode() *parseNode {
 	return &parseNode{
 		lc: make(map[string]*parseNode),
@@ -89,9 +195,17 @@ func (this *parseNode) String() string {
 // builds the parser tree so it can be used for parsing later.
 //func (this *Parser) Add(s string) error {
 func (this *Parser) Add(seq Sequence) error {
+	return this.AddPattern(seq, "")
+}
+
+// AddPattern is the same as Add, but it also records the id of the pattern, so
+// ParseWithResult can report which pattern matched a message.
+func (this *Parser) AddPattern(seq Sequence, patternId string) error {
 	this.mu.Lock()
 	defer this.mu.Unlock()
 
+	pattern, _ := seq.String()
+
 	parent := this.root
 	var grandparent *parseNode = nil
 
@@ -115,7 +229,7 @@ func (this *Parser) Add(seq Sequence) error {
 			// token nodes
 			if parent.tc[token.Type] != nil {
 				for _, n := range parent.tc[token.Type] {
-					if n.Type == token.Type && n.Tag == token.Tag && n.until == token.until {
+					if n.Type == token.Type && n.Tag == token.Tag && n.until == token.until && n.constraint == token.constraint && this.options.sameSpacing(n.Token, token) {
 						found = n
 						break
 					}
@@ -125,6 +239,7 @@ func (this *Parser) Add(seq Sequence) error {
 			if found == nil {
 				found = newParseNode()
 				found.Token = token
+				found.setConstraint(token.constraint)
 				parent.tc[found.Type] = append(parent.tc[found.Type], found)
 				parent.parent = true
 			}
@@ -138,11 +253,10 @@ func (this *Parser) Add(seq Sequence) error {
 
 		case token.Type == TokenLiteral:
 			var ok bool
-			v := token.Value
+			v := this.options.literalKey(token)
 			if found, ok = parent.lc[v]; !ok {
 				found = newParseNode()
 				found.Token = token
-				found.Value = v
 				found.until = token.until
 				parent.lc[v] = found
 				parent.parent = true
@@ -157,7 +271,7 @@ func (this *Parser) Add(seq Sequence) error {
 			case found.Type != TokenUnknown && found.Type != TokenLiteral:
 				if grandparent.tc[found.Type] != nil {
 					for _, n := range grandparent.tc[found.Type] {
-						if n.Type == found.Type && n.Tag == found.Tag {
+						if n.Type == found.Type && n.Tag == found.Tag && n.constraint == found.constraint && this.options.sameSpacing(n.Token, found.Token) {
 							grandchild = n
 							break
 						}
@@ -170,8 +284,8 @@ func (this *Parser) Add(seq Sequence) error {
 				}
 
 			case found.Type == TokenLiteral:
-				if grandchild, ok = grandparent.lc[found.Value]; !ok {
-					grandparent.lc[found.Value] = found
+				if grandchild, ok = grandparent.lc[this.options.literalKey(found.Token)]; !ok {
+					grandparent.lc[this.options.literalKey(found.Token)] = found
 					grandparent.parent = true
 				}
 			}
@@ -187,34 +301,472 @@ func (this *Parser) Add(seq Sequence) error {
 		parent = found
 	}
 
-	parent.leaf = true
+	parent.addPattern(patternId, pattern)
 
 	if grandparent != nil {
-		grandparent.leaf = true
+		grandparent.addPattern(patternId, pattern)
 	}
 
 	if len(seq) > this.height {
 		this.height = len(seq) + 1
 	}
 
+	if patternId != "" {
+		// the scanner reuses its sequence, so keep a copy
+		this.ids[patternId] = append(Sequence(nil), seq...)
+	}
+
+	return nil
+}
+
+// Remove takes a pattern sequence out of the parser tree, pruning the nodes that
+// are no longer used by any other pattern. ErrPatternNotFound is returned if the
+// pattern was never added.
+func (this *Parser) Remove(seq Sequence) error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	pattern, _ := seq.String()
+	return this.remove(seq, func(p parsePattern) bool {
+		if p.text == pattern {
+			delete(this.ids, p.id)
+			return true
+		}
+		return false
+	})
+}
+
+// RemovePattern removes the pattern added with AddPattern under the given id, the
+// same way as Remove.
+func (this *Parser) RemovePattern(patternId string) error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	seq, ok := this.ids[patternId]
+	if !ok {
+		return ErrPatternNotFound
+	}
+
+	delete(this.ids, patternId)
+	return this.remove(seq, func(p parsePattern) bool {
+		return p.id == patternId
+	})
+}
+
+// Swap atomically replaces the patterns of the parser, and the options they were
+// added with, with the ones of other, which is left empty. This allows a new parser to be built in the background while
+// this one keeps parsing: Parse calls that are running finish with the old patterns,
+// and the ones that follow use the new patterns.
+func (this *Parser) Swap(other *Parser) {
+	if this == other {
+		return
+	}
+
+	other.mu.Lock()
+	root, height, ids, options := other.root, other.height, other.ids, other.options
+	other.root, other.height, other.ids = newParseNode(), 0, make(map[string]Sequence)
+	other.mu.Unlock()
+
+	this.mu.Lock()
+	this.root, this.height, this.ids, this.options = root, height, ids, options
+	this.mu.Unlock()
+}
+
+// remove walks the tree the same way AddPattern builds it, drops the patterns
+// that match from the leaf, then prunes the branches left without any leaf. The
+// caller must hold the write lock.
+func (this *Parser) remove(seq Sequence, match func(parsePattern) bool) error {
+	parent := this.root
+	var grandparent *parseNode = nil
+
+	for _, token := range seq {
+		vl := len(token.Value)
+
+		if vl >= 2 && token.Value[0] == '%' && token.Value[vl-1] == '%' {
+			var err error
+			if token, err = processTagToken(token); err != nil {
+				return err
+			}
+		}
+
+		var found *parseNode
+
+		switch {
+		case token.Type != TokenUnknown && token.Type != TokenLiteral:
+			for _, n := range parent.tc[token.Type] {
+				if n.Type == token.Type && n.Tag == token.Tag && n.until == token.until && n.constraint == token.constraint && this.options.sameSpacing(n.Token, token) {
+					found = n
+					break
+				}
+			}
+
+		case token.Type == TokenLiteral:
+			found = parent.lc[this.options.literalKey(token)]
+		}
+
+		if found == nil {
+			return ErrPatternNotFound
+		}
+
+		if found.star {
+			grandparent = parent
+		} else {
+			grandparent = nil
+		}
+
+		parent = found
+	}
+
+	if !parent.removePatterns(match) {
+		return ErrPatternNotFound
+	}
+
+	if grandparent != nil {
+		grandparent.removePatterns(match)
+	}
+
+	// nodes can be shared between branches because of the * tokens, so the whole
+	// tree is checked rather than only the path of the pattern
+	this.root.prune(make(map[*parseNode]bool))
+
+	return nil
+}
+
+// nearestLeaf returns the leaf closest to the node in the tree, the node itself if
+// it is a leaf, or nil if there is none.
+func (this *parseNode) nearestLeaf() *parseNode {
+	seen := map[*parseNode]bool{this: true}
+	queue := []*parseNode{this}
+
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+
+		if n.leaf {
+			return n
+		}
+
+		// walk the children in a fixed order, the literal ones first
+		var lits []string
+		for v := range n.lc {
+			lits = append(lits, v)
+		}
+		sort.Strings(lits)
+
+		for _, v := range lits {
+			if c := n.lc[v]; !seen[c] {
+				seen[c] = true
+				queue = append(queue, c)
+			}
+		}
+
+		for _, nodes := range n.tc {
+			for _, c := range nodes {
+				if !seen[c] {
+					seen[c] = true
+					queue = append(queue, c)
+				}
+			}
+		}
+	}
+
 	return nil
 }
 
+// setConstraint compiles the constraint of a tag token, it has been checked by
+// processTagToken already.
+func (this *parseNode) setConstraint(c string) {
+	switch {
+	case c == "":
+	case c[0] == '/':
+		// the regex matches the whole value, as in the exporters
+		this.regex = regexp.MustCompile("^(?:" + c[1:len(c)-1] + ")$")
+	case c[0] == '{':
+		this.enum = make(map[string]bool)
+		for _, v := range strings.Split(c[1:len(c)-1], "|") {
+			this.enum[v] = true
+		}
+	}
+}
+
+// accepts returns false if the value does not satisfy the constraint of the node.
+func (this *parseNode) accepts(v string) bool {
+	if this.regex != nil {
+		return this.regex.MatchString(v)
+	}
+
+	if this.enum != nil {
+		return this.enum[v]
+	}
+
+	return true
+}
+
+func (this *parseNode) addPattern(id, text string) {
+	this.leaf = true
+	for _, p := range this.patterns {
+		if p.id == id && p.text == text {
+			return
+		}
+	}
+	this.patterns = append(this.patterns, parsePattern{id, text, &patternStats{}})
+}
+
+// removePatterns drops the patterns that match, and returns false if none did.
+func (this *parseNode) removePatterns(match func(parsePattern) bool) bool {
+	var kept []parsePattern
+	for _, p := range this.patterns {
+		if !match(p) {
+			kept = append(kept, p)
+		}
+	}
+
+	removed := len(kept) != len(this.patterns)
+	this.patterns = kept
+	this.leaf = len(kept) > 0
+	return removed
+}
+
+// hasChildren returns true if the node has children other than itself, which is
+// the case of the + and * tokens.
+func (this *parseNode) hasChildren() bool {
+	if len(this.lc) > 0 {
+		return true
+	}
+
+	for _, nodes := range this.tc {
+		for _, n := range nodes {
+			if n != this {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// prune removes the children that don't lead to a leaf, and returns true if the
+// node is a leaf or still has children. alive keeps the result for the nodes
+// already visited, as a node can have more than one parent.
+func (this *parseNode) prune(alive map[*parseNode]bool) bool {
+	if a, ok := alive[this]; ok {
+		return a
+	}
+
+	// + and * nodes are their own child, don't visit them twice
+	alive[this] = this.leaf
+
+	for v, n := range this.lc {
+		if !n.prune(alive) {
+			delete(this.lc, v)
+		}
+	}
+
+	for t, nodes := range this.tc {
+		var kept []*parseNode
+		for _, n := range nodes {
+			if n == this || n.prune(alive) {
+				kept = append(kept, n)
+			}
+		}
+		this.tc[t] = kept
+	}
+
+	this.parent = this.hasChildren()
+	alive[this] = this.leaf || this.parent
+	return alive[this]
+}
+
 // Parse will take the message sequence supplied and go through the parser tree to
 // find the matching pattern sequence. If found, the pattern sequence is returned.
+// The match is counted if EnableStats was called, the same as for ParseWithResult.
 //func (this *Parser) Parse(s string) (Sequence, error) {
 func (this *Parser) Parse(seq Sequence) (Sequence, error) {
 	this.mu.RLock()
 	defer this.mu.RUnlock()
 
+	if this.statsEnabled() {
+		start := time.Now()
+		path, leaf, _, err := this.parse(seq)
+		this.record(leaf, start)
+		return path, err
+	}
+
+	path, _, _, err := this.parse(seq)
+	return path, err
+}
+
+// ParseWithResult parses the message sequence the same way as Parse, and returns
+// the matched pattern id and text, the score of the match and the extracted
+// field values along with the tagged sequence.
+func (this *Parser) ParseWithResult(seq Sequence) (ParseResult, error) {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+
+	var start time.Time
+	stats := this.statsEnabled()
+	if stats {
+		start = time.Now()
+	}
+
+	path, leaf, score, err := this.parse(seq)
+	if stats {
+		this.record(leaf, start)
+	}
+	if err != nil {
+		return ParseResult{}, err
+	}
+
+	p := leaf.patterns[len(leaf.patterns)-1]
+
+	return ParseResult{
+		PatternId: p.id,
+		Pattern:   p.text,
+		Score:     score,
+		Sequence:  path,
+		Fields:    path.Fields(nil),
+	}, nil
+}
+
+// ParseAll parses the message sequence the same way as Parse, but returns all the
+// patterns that match it rather than the best one, sorted by score, the best first.
+// This shows when more than one pattern can match the same message.
+func (this *Parser) ParseAll(seq Sequence) ([]ParseResult, error) {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+
+	type match struct {
+		path  Sequence
+		score int
+	}
+
+	// the same leaf can be reached by more than one path, keep the best one
+	matches := make(map[*parseNode]*match)
+	var leaves []*parseNode
+
+	this.walk(seq, nil, func(path Sequence, leaf *parseNode, score int) {
+		m, ok := matches[leaf]
+		if !ok {
+			m = &match{}
+			matches[leaf] = m
+			leaves = append(leaves, leaf)
+		} else if score <= m.score {
+			return
+		}
+		m.path = append(m.path[:0], path...)
+		m.score = score
+	})
+
+	if len(leaves) == 0 {
+		return nil, ErrNoMatch
+	}
+
+	var results []ParseResult
+	for _, leaf := range leaves {
+		m := matches[leaf]
+		path := mergePath(m.path)
+		for _, p := range leaf.patterns {
+			results = append(results, ParseResult{
+				PatternId: p.id,
+				Pattern:   p.text,
+				Score:     m.score,
+				Sequence:  path,
+				Fields:    path.Fields(nil),
+			})
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+
+	return results, nil
+}
+
+// ParsePrefix parses the message sequence the same way as ParseWithResult, but if
+// no pattern matches the whole message, it returns the longest path that matches
+// the start of the message instead of ErrNoMatch. Remainder is then the index of
+// the first token of the message that was not matched, and the pattern is the
+// first one found that starts with the matched path, the one the message nearly
+// matched. ErrNoMatch is only returned if not even the first token matched.
+func (this *Parser) ParsePrefix(seq Sequence) (PrefixResult, error) {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+
+	if path, leaf, score, err := this.parse(seq); err == nil {
+		p := leaf.patterns[len(leaf.patterns)-1]
+		return PrefixResult{
+			ParseResult: ParseResult{PatternId: p.id, Pattern: p.text, Score: score, Sequence: path, Fields: path.Fields(nil)},
+			Remainder:   len(seq),
+		}, nil
+	}
+
 	var (
-		parent stackParseNode
+		bestIdx, bestScore int
+		bestPath           Sequence
+		bestNode           *parseNode
+	)
 
-		// Keep track of the path we have walked
-		path = make(Sequence, len(seq))
+	this.walk(seq, func(path Sequence, node *parseNode, seqidx, score int) {
+		if seqidx > bestIdx || (seqidx == bestIdx && score > bestScore) {
+			bestIdx, bestScore = seqidx, score
+			bestPath = append(bestPath[:0], path...)
+			bestNode = node
+		}
+	}, func(Sequence, *parseNode, int) {})
+
+	if bestNode == nil {
+		return PrefixResult{}, ErrNoMatch
+	}
+
+	path := mergePath(bestPath)
+	pr := PrefixResult{
+		ParseResult: ParseResult{Score: bestScore, Sequence: path, Fields: path.Fields(nil)},
+		Remainder:   bestIdx,
+	}
+	if leaf := bestNode.nearestLeaf(); leaf != nil {
+		p := leaf.patterns[len(leaf.patterns)-1]
+		pr.PatternId, pr.Pattern = p.id, p.text
+	}
+
+	return pr, nil
+}
 
+// parse walks the parser tree and returns the best matching path, the leaf node
+// it ended on and its score. The caller must hold the read lock.
+func (this *Parser) parse(seq Sequence) (Sequence, *parseNode, int, error) {
+	var (
 		bestScore int
 		bestPath  = make(Sequence, len(seq))
+		bestLeaf  *parseNode
+	)
+
+	this.walk(seq, nil, func(path Sequence, leaf *parseNode, score int) {
+		if score > bestScore {
+			bestScore = score
+			bestPath = append(bestPath[:0], path...)
+			bestLeaf = leaf
+		}
+	})
+
+	if bestScore > 0 {
+		return mergePath(bestPath), bestLeaf, bestScore, nil
+	}
+
+	return nil, nil, 0, ErrNoMatch
+}
+
+// walk goes through the parser tree and calls found for each complete path that
+// matches the message sequence, with the leaf it ended on and its score. If matched
+// is not nil, it is called for each node matched along the way, with the path up
+// to the node, the index of the next token of the message and the score so far.
+// The paths are only valid during the calls. The caller must hold the read lock.
+func (this *Parser) walk(seq Sequence, matched func(Sequence, *parseNode, int, int), found func(Sequence, *parseNode, int)) {
+	var (
+		parent stackParseNode
+
+		// Keep track of the path we have walked
+		path = make(Sequence, len(seq))
 	)
 
 	// toVisit is a stack, children that need to be visited are appended to the end,
@@ -240,11 +792,15 @@ func (this *Parser) Parse(seq Sequence) (Sequence, error) {
 			path[l] = parent.node.Token
 			path[l].Value = parent.value
 
+			// the token that got us here is the one before seqidx
+			path[l].Start, path[l].End = seq[parent.seqidx-1].Start, seq[parent.seqidx-1].End
+
 			if parent.node.until != "" {
 				i := parent.seqidx
 				for ; i < len(seq) && seq[i].Value != parent.node.until; i++ {
 					// glog.Debugf("consuming %q", seq[i])
 					path[l].Value += " " + seq[i].Value
+					path[l].End = seq[i].End
 				}
 
 				parent.seqidx = i
@@ -255,6 +811,10 @@ func (this *Parser) Parse(seq Sequence) (Sequence, error) {
 					continue
 				}
 			}
+
+			if matched != nil {
+				matched(path, parent.node, parent.seqidx, parent.score)
+			}
 		}
 
 		if parent.node.leaf {
@@ -263,6 +823,7 @@ func (this *Parser) Parse(seq Sequence) (Sequence, error) {
 				i := parent.seqidx
 				for ; i < len(seq); i++ {
 					path[l].Value += " " + seq[i].Value
+					path[l].End = seq[i].End
 				}
 				parent.seqidx = i
 			}
@@ -271,10 +832,7 @@ func (this *Parser) Parse(seq Sequence) (Sequence, error) {
 				// end of tokens, so let's finalize the current path. If the current
 				// node is a leaf, that means we matched the sequence, so let's add it
 				// to the path list.
-				if parent.score > bestScore {
-					bestScore = parent.score
-					bestPath = append(bestPath[:0], path...)
-				}
+				found(path, parent.node, parent.score)
 
 				continue
 			}
@@ -299,40 +857,91 @@ func (this *Parser) Parse(seq Sequence) (Sequence, error) {
 			// Find any children that's a string token and add them to the stack
 			// if len(token.Value) > 1 || (len(token.Value) == 1 && isLiteral(rune(token.Value[0]))) {
 			for _, n := range parent.node.tc[TokenString] {
+				if !n.accepts(token.Value) || !this.spacingAccepts(parent.node, n, token) {
+					continue
+				}
 				toVisit = append(toVisit, stackParseNode{n, parent.level + 1, parent.seqidx + 1, parent.score + partialMatchWeight, token.Value})
 			}
 			// }
 
+			// the host names and email addresses are scanned as literals, they
+			// are only checked when the patterns have such tokens there
+			if len(parent.node.tc[TokenHost]) > 0 || len(parent.node.tc[TokenEmail]) > 0 {
+				if t := hostOrEmailSyntax(token.Value); t != TokenLiteral {
+					for _, n := range parent.node.tc[t] {
+						if !n.accepts(token.Value) || !this.spacingAccepts(parent.node, n, token) {
+							continue
+						}
+						toVisit = append(toVisit, stackParseNode{n, parent.level + 1, parent.seqidx + 1, parent.score + fullMatchWeight, token.Value})
+					}
+				}
+			}
+
 			// If the values match, then it's a full match, add it to the stack
-			if n, ok := parent.node.lc[token.Value]; ok {
+			if n, ok := parent.node.lc[this.options.literalKey(token)]; ok {
 				toVisit = append(toVisit, stackParseNode{n, parent.level + 1, parent.seqidx + 1, parent.score + fullMatchWeight, token.Value})
 			}
 
 		default:
 			for _, n := range parent.node.tc[token.Type] {
+				if !n.accepts(token.Value) || !this.spacingAccepts(parent.node, n, token) {
+					continue
+				}
 				toVisit = append(toVisit, stackParseNode{n, parent.level + 1, parent.seqidx + 1, parent.score + fullMatchWeight, token.Value})
 			}
+
+			// the types that used to be scanned as literals are still strings, so
+			// the patterns written before them keep matching
+			if token.Type.isText() {
+				for _, n := range parent.node.tc[TokenString] {
+					if !n.accepts(token.Value) || !this.spacingAccepts(parent.node, n, token) {
+						continue
+					}
+					toVisit = append(toVisit, stackParseNode{n, parent.level + 1, parent.seqidx + 1, parent.score + partialMatchWeight, token.Value})
+				}
+			}
+
+			// the time spans and sizes can be plain numbers, in seconds and bytes
+			for _, t := range quantityTypes {
+				if t == token.Type || !t.accepts(token.Type) {
+					continue
+				}
+				for _, n := range parent.node.tc[t] {
+					if !n.accepts(token.Value) || !this.spacingAccepts(parent.node, n, token) {
+						continue
+					}
+					toVisit = append(toVisit, stackParseNode{n, parent.level + 1, parent.seqidx + 1, parent.score + partialMatchWeight, token.Value})
+				}
+			}
 		}
 	}
+}
 
-	if bestScore > 0 {
-		l := len(bestPath)
-		for i := 0; i < l; i++ {
-			t := bestPath[i]
-			if t.plus || t.star {
-				var j int
-				for j = i + 1; j < l && (bestPath[j].star || bestPath[j].plus) && t.Tag == bestPath[j].Tag && t.Type == bestPath[j].Type; j++ {
-					t.Value += " " + bestPath[j].Value
-				}
-				bestPath[i] = t
-				bestPath = append(bestPath[:i+1], bestPath[j:]...)
-				l = len(bestPath)
+// spacingAccepts returns true if the token can be matched by the child n of parent
+// given its spacing. The tokens repeated by a + or * node can be spaced either way.
+func (this *Parser) spacingAccepts(parent, n *parseNode, token Token) bool {
+	return n == parent || this.options.sameSpacing(n.Token, token)
+}
+
+// mergePath merges the consecutive tokens matched by the same + or * node into
+// a single token.
+func mergePath(path Sequence) Sequence {
+	l := len(path)
+	for i := 0; i < l; i++ {
+		t := path[i]
+		if t.plus || t.star {
+			var j int
+			for j = i + 1; j < l && (path[j].star || path[j].plus) && t.Tag == path[j].Tag && t.Type == path[j].Type; j++ {
+				t.Value += " " + path[j].Value
+				t.End = path[j].End
 			}
+			path[i] = t
+			path = append(path[:i+1], path[j:]...)
+			l = len(path)
 		}
-		return bestPath, nil
 	}
 
-	return nil, ErrNoMatch
+	return path
 }
 
 // A tag token is of the format "%tag:type:meta%".
@@ -343,6 +952,9 @@ func (this *Parser) Parse(seq Sequence) (Sequence, error) {
 //   - "+" means one or more of this token
 //   - "*" means zero or more of this token
 //
+// The meta of a time token can also be the regex id of its format, e.g. %regextime:1%,
+// or the unit of an epoch time stamp, e.g. %msgtime:epochms%.
+//
 // Formats can be
 // - %tag%
 // - %type%
@@ -350,8 +962,31 @@ func (this *Parser) Parse(seq Sequence) (Sequence, error) {
 // - %tag:meta%
 // - %type:meta%
 // - %tag:type:meta%
+//
+// Any of the formats can end with a constraint on the value of the token, which is
+// either a regular expression between slashes or a list of values between braces,
+// e.g. %status:string:/ok|fail/% or %action:{allow|deny}%. The regular expression
+// must match the whole value, as if it were anchored. The constraint cannot contain
+// spaces, and cannot match a colon, as the scanner splits the values at the colons.
 func processTagToken(token Token) (Token, error) {
-	parts := strings.Split(token.Value[1:len(token.Value)-1], ":")
+	value := token.Value
+
+	// the marker of the json embedded in a text message is a literal
+	if value == jsonMarker {
+		token.Type = TokenLiteral
+		return token, nil
+	}
+
+	if i := tagConstraintIndex(value); i > 0 {
+		c := value[i+1 : len(value)-1]
+		if err := checkTagConstraint(c); err != nil {
+			return token, fmt.Errorf("Invalid tag token %q: %v", token.Value, err)
+		}
+		token.constraint = c
+		value = value[:i] + "%"
+	}
+
+	parts := strings.Split(value[1:len(value)-1], ":")
 
 	switch len(parts) {
 	case 1:
@@ -396,9 +1031,12 @@ func processTagToken(token Token) (Token, error) {
 			case metaStar:
 				token.star = true
 			default:
-				//this is for any kind of numbering data such as regex id
+				//this is for any kind of numbering data such as regex id, or the
+				//unit of the epoch time stamps
 				if _, err := strconv.Atoi(parts[1]); err == nil {
 					token.Special = parts[1]
+				} else if token.Type == TokenTime && isEpochSubtype(parts[1]) {
+					token.Special = parts[1]
 				} else {
 					return token, fmt.Errorf("Invalid tag token %q: unknown meta character", token.Value)
 				}
@@ -441,3 +1079,121 @@ func processTagToken(token Token) (Token, error) {
 
 	return token, nil
 }
+
+// tagConstraintIndex returns the index of the colon before the constraint of the
+// tag token, or -1 if there is none. Tag and type names have no slashes or braces,
+// so the first ":/" or ":{" starts the constraint.
+func tagConstraintIndex(tag string) int {
+	i := strings.Index(tag, ":/")
+	if j := strings.Index(tag, ":{"); j >= 0 && (i < 0 || j < i) {
+		i = j
+	}
+	return i
+}
+
+// the groups with flags and the character classes of a regex constraint, whose colons
+// are not matched in the value
+var constraintRegexColons = regexp.MustCompile(`\(\?[a-zA-Z-]*:|\[:\^?[a-z]+:\]`)
+
+// checkTagConstraint returns an error if the constraint is not a valid /regex/ or
+// {value|value}. The scanner splits the values at the spaces and the colons, so a
+// constraint matching them could never match a token.
+func checkTagConstraint(c string) error {
+	if strings.ContainsAny(c, " \t") {
+		return fmt.Errorf("constraint cannot contain spaces")
+	}
+
+	switch {
+	case len(c) > 2 && c[0] == '/' && c[len(c)-1] == '/':
+		if _, err := regexp.Compile(c[1 : len(c)-1]); err != nil {
+			return err
+		}
+		if strings.Contains(constraintRegexColons.ReplaceAllString(c, ""), ":") {
+			return fmt.Errorf("constraint cannot match a colon, the values are split at the colons")
+		}
+
+	case len(c) > 2 && c[0] == '{' && c[len(c)-1] == '}':
+		for _, v := range strings.Split(c[1:len(c)-1], "|") {
+			if v == "" {
+				return fmt.Errorf("empty value in %s", c)
+			}
+			if strings.Contains(v, ":") {
+				return fmt.Errorf("value %q cannot contain a colon, the values are split at the colons", v)
+			}
+		}
+
+	default:
+		return fmt.Errorf("constraint must be /regex/ or {value|value}")
+	}
+
+	return nil
+}
+
+// TagConstraintRegex splits a tag token with a constraint, e.g. %action:{allow|deny}%,
+// into the tag token without the constraint, %action%, and a regular expression
+// equivalent to the constraint that can be embedded in a larger expression: the
+// ^ and $ anchors at the ends of the alternatives of a regex are removed, as the
+// regex matches the whole value anyway, and the values of a list are quoted. It
+// returns false if the tag token has no constraint.
+func TagConstraintRegex(tag string) (string, string, bool) {
+	i := tagConstraintIndex(tag)
+	if i < 0 || len(tag) < 2 || tag[0] != '%' || tag[len(tag)-1] != '%' {
+		return tag, "", false
+	}
+
+	c := tag[i+1 : len(tag)-1]
+	if checkTagConstraint(c) != nil {
+		return tag, "", false
+	}
+
+	var re string
+	if c[0] == '/' {
+		re = stripRegexAnchors(c[1 : len(c)-1])
+	} else {
+		vals := strings.Split(c[1:len(c)-1], "|")
+		for j, v := range vals {
+			vals[j] = regexp.QuoteMeta(v)
+		}
+		re = strings.Join(vals, "|")
+	}
+
+	return tag[:i] + "%", "(?:" + re + ")", true
+}
+
+// stripRegexAnchors removes the ^ at the start and the $ at the end of each top
+// level alternative of the regex, e.g. ^a$|^b$ is a|b.
+func stripRegexAnchors(re string) string {
+	var (
+		alts  []string
+		depth int
+		class bool
+		start int
+	)
+	for i := 0; i < len(re); i++ {
+		switch c := re[i]; {
+		case c == '\\':
+			i++
+		case class:
+			class = c != ']'
+		case c == '[':
+			class = true
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == '|' && depth == 0:
+			alts = append(alts, re[start:i])
+			start = i + 1
+		}
+	}
+	alts = append(alts, re[start:])
+
+	for i, a := range alts {
+		a = strings.TrimPrefix(a, "^")
+		if strings.HasSuffix(a, "$") && !strings.HasSuffix(a, "\\$") {
+			a = a[:len(a)-1]
+		}
+		alts[i] = a
+	}
+	return strings.Join(alts, "|")
+}
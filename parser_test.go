@@ -15,8 +15,16 @@
 package sequence
 
 import (
+	"bytes"
 	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 var (
@@ -165,6 +173,18 @@ var (
 			`{"EventTime":"2014-08-16T12:45:03-0400","URI":"myuri","uri_payload":{"value":[{"open":"2014-08-16T13:00:00.000+0000","close":"2014-08-16T23:00:00.000+0000","isOpen":true,"date":"2014-08-16"}],"Count":1}}`,
 			"eventtime = %msgtime% uri = %object% uri_payload.value.0.open = %time% uri_payload.value.0.close = %time% uri_payload.value.0.isopen = %string% uri_payload.value.0.date = %time% uri_payload.count = %integer%",
 		},*/
+		{
+			"general",
+			"job 550e8400-e29b-41d4-a716-446655440000 finished with digest d41d8cd98f00b204e9800998ecf8427e",
+			"job %uuid% finished with digest %hex%",
+			[]int{4, 32},
+		},
+		{
+			"general",
+			"backup of /var/lib/foo/bar.db to \"/mnt/my backup/bar.db\" done",
+			"backup of %path% to \" %path% \" done",
+			[]int{10, 22},
+		},
 	}
 
 	parsetestsnosp = []struct {
@@ -312,6 +332,18 @@ var (
 			`{"EventTime":"2014-08-16T12:45:03-0400","URI":"myuri","uri_payload":{"value":[{"open":"2014-08-16T13:00:00.000+0000","close":"2014-08-16T23:00:00.000+0000","isOpen":true,"date":"2014-08-16"}],"Count":1}}`,
 			"eventtime = %msgtime% uri = %object% uri_payload.value.0.open = %time% uri_payload.value.0.close = %time% uri_payload.value.0.isopen = %string% uri_payload.value.0.date = %time% uri_payload.count = %integer%",
 		},*/
+		{
+			"general",
+			"job 550e8400-e29b-41d4-a716-446655440000 finished with digest d41d8cd98f00b204e9800998ecf8427e",
+			"job %uuid% finished with digest %hex%",
+			[]int{4, 32},
+		},
+		{
+			"general",
+			"backup of /var/lib/foo/bar.db to \"/mnt/my backup/bar.db\" done",
+			"backup of %path% to \"%path%\" done",
+			[]int{10, 21},
+		},
 	}
 
 	parsetests2 = []struct {
@@ -551,6 +583,864 @@ func TestParserParseMessages(t *testing.T) {
 	}
 }
 
+func TestParserParseWithResult(t *testing.T) {
+	parser := NewParser()
+	scanner := NewScanner()
+	var pos []int
+
+	tc := parsetestsnosp[1]
+	seq, _, err := scanner.Scan(tc.rule, true, tc.pos)
+	require.NoError(t, err, tc.rule)
+	err = parser.AddPattern(seq, "pattern-1")
+	require.NoError(t, err, tc.rule)
+
+	seq, _, err = scanner.Scan(tc.msg, false, pos)
+	require.NoError(t, err, tc.msg)
+	pr, err := parser.ParseWithResult(seq)
+	require.NoError(t, err, tc.msg)
+	require.Equal(t, "pattern-1", pr.PatternId)
+	require.Equal(t, tc.rule, pr.Pattern)
+	require.True(t, pr.Score > 0)
+	require.Equal(t, "dlfssrv", pr.Fields["apphost"])
+	require.Equal(t, "unix", pr.Fields["appname"])
+	require.Equal(t, "dlfs_remove", pr.Fields["method"])
+	require.Equal(t, "tempfile", pr.Fields["string"])
+
+	_, err = parser.ParseWithResult(Sequence{Token{Type: TokenLiteral, Value: "nomatch"}})
+	require.Equal(t, ErrNoMatch, err)
+}
+
+func TestParserParseAll(t *testing.T) {
+	parser := NewParser()
+	scanner := NewScanner()
+	var pos []int
+
+	testset := parsetests2
+	if config.markSpaces {
+		testset = parsetests2nosp
+	}
+
+	// both the * and + patterns match the message of the first one
+	for i, tc := range testset[1:3] {
+		seq, _, err := scanner.Scan(tc.rule, true, tc.pos)
+		require.NoError(t, err, tc.rule)
+		err = parser.AddPattern(seq, strconv.Itoa(i))
+		require.NoError(t, err, tc.rule)
+	}
+
+	tc := testset[1]
+	seq, _, err := scanner.Scan(tc.msg, false, pos)
+	require.NoError(t, err, tc.msg)
+
+	prs, err := parser.ParseAll(seq)
+	require.NoError(t, err, tc.msg)
+	require.Len(t, prs, 2)
+	require.NotEqual(t, prs[0].PatternId, prs[1].PatternId)
+	require.True(t, prs[0].Score >= prs[1].Score)
+	for _, pr := range prs {
+		require.Equal(t, "tempfile", pr.Fields["object"], pr.Pattern)
+	}
+
+	best, err := parser.ParseWithResult(seq)
+	require.NoError(t, err, tc.msg)
+	require.Equal(t, best.Score, prs[0].Score)
+
+	_, err = parser.ParseAll(Sequence{Token{Type: TokenLiteral, Value: "nomatch"}})
+	require.Equal(t, ErrNoMatch, err)
+}
+
+func TestParserConstraints(t *testing.T) {
+	scanner := NewScanner()
+	var pos []int
+
+	tests := []struct {
+		rule, pattern string
+		match         []string
+		nomatch       []string
+	}{
+		{
+			"user %srcuser% login %status:string:/^(ok|fail)$/%",
+			"user %srcuser% login %status:/^(ok|fail)$/%",
+			[]string{"user bob login ok", "user bob login fail"},
+			[]string{"user bob login maybe", "user bob login okay"},
+		},
+		{
+			"%action:{allow|deny}% from %srcip%",
+			"%action:{allow|deny}% from %srcip%",
+			[]string{"allow from 10.0.0.1", "deny from 10.0.0.1"},
+			[]string{"drop from 10.0.0.1"},
+		},
+		{
+			// the regex matches the whole value
+			"user %srcuser% login %status:string:/ok|fail/%",
+			"user %srcuser% login %status:/ok|fail/%",
+			[]string{"user bob login ok", "user bob login fail"},
+			[]string{"user bob login not_ok", "user bob login failed"},
+		},
+	}
+
+	for _, tc := range tests {
+		parser := NewParser()
+		seq, _, err := scanner.Scan(tc.rule, true, tagPositions(tc.rule))
+		require.NoError(t, err, tc.rule)
+		require.NoError(t, parser.Add(seq), tc.rule)
+
+		for _, msg := range tc.match {
+			seq, _, err = scanner.Scan(msg, false, pos)
+			require.NoError(t, err, msg)
+			seq, err = parser.Parse(seq)
+			require.NoError(t, err, msg)
+			r, _ := seq.String()
+			require.Equal(t, tc.pattern, r, msg)
+		}
+
+		for _, msg := range tc.nomatch {
+			seq, _, err = scanner.Scan(msg, false, pos)
+			require.NoError(t, err, msg)
+			_, err = parser.Parse(seq)
+			require.Equal(t, ErrNoMatch, err, msg)
+		}
+	}
+
+	// the values with a colon are split by the scanner, so they are rejected
+	for _, v := range []string{"%status:string:/(/%", "%action:{allow||deny}%", "%action:/ok/x%", "%action:{a:b|c}%", "%action:/\\d+:\\d+/%", "%action:/a\\:b/%"} {
+		_, err := processTagToken(Token{Value: v})
+		require.Error(t, err, v)
+	}
+	for _, v := range []string{"%action:/(?i:allow|deny)/%", "%action:/[[:alpha:]]+/%"} {
+		_, err := processTagToken(Token{Value: v})
+		require.NoError(t, err, v)
+	}
+
+	tag, re, ok := TagConstraintRegex("%status:string:/^(ok|fail)$/%")
+	require.True(t, ok)
+	require.Equal(t, "%status:string%", tag)
+	require.Equal(t, "(?:(ok|fail))", re)
+
+	_, re, _ = TagConstraintRegex("%status:/^a$|^b\\$$|[|^]c/%")
+	require.Equal(t, "(?:a|b\\$|[|^]c)", re)
+
+	tag, re, ok = TagConstraintRegex("%action:{allow|a.b}%")
+	require.True(t, ok)
+	require.Equal(t, "%action%", tag)
+	require.Equal(t, "(?:allow|a\\.b)", re)
+
+	_, _, ok = TagConstraintRegex("%action%")
+	require.False(t, ok)
+}
+
+func TestParserParsePrefix(t *testing.T) {
+	parser := NewParser()
+	scanner := NewScanner()
+	var pos []int
+
+	rule := "user %srcuser% login %status%"
+	seq, _, err := scanner.Scan(rule, true, tagPositions(rule))
+	require.NoError(t, err, rule)
+	require.NoError(t, parser.AddPattern(seq, "p1"), rule)
+
+	tests := []struct {
+		msg       string
+		remainder int
+		fields    map[string]string
+	}{
+		{"user bob login failed", 4, map[string]string{"srcuser": "bob", "status": "failed"}},
+		{"user bob login failed because the password expired", 4, map[string]string{"srcuser": "bob", "status": "failed"}},
+		{"user bob logout", 2, map[string]string{"srcuser": "bob"}},
+	}
+
+	for _, tc := range tests {
+		seq, _, err = scanner.Scan(tc.msg, false, pos)
+		require.NoError(t, err, tc.msg)
+		pr, err := parser.ParsePrefix(seq)
+		require.NoError(t, err, tc.msg)
+		require.Equal(t, tc.remainder, pr.Remainder, tc.msg)
+		require.Equal(t, tc.fields, pr.Fields, tc.msg)
+		require.Equal(t, "p1", pr.PatternId, tc.msg)
+		require.Equal(t, rule, pr.Pattern, tc.msg)
+	}
+
+	seq, _, err = scanner.Scan("nothing here", false, pos)
+	require.NoError(t, err)
+	_, err = parser.ParsePrefix(seq)
+	require.Equal(t, ErrNoMatch, err)
+}
+
+func TestParserParseOffsets(t *testing.T) {
+	scanner := NewScanner()
+	var pos []int
+
+	// parsetests2nosp[3] and [4] end with a + and a - token
+	for _, tc := range parsetests2nosp[3:5] {
+		parser := NewParser()
+		seq, _, err := scanner.Scan(tc.rule, true, tc.pos)
+		require.NoError(t, err, tc.rule)
+		err = parser.Add(seq)
+		require.NoError(t, err, tc.rule)
+
+		seq, _, err = scanner.Scan(tc.msg, false, pos)
+		require.NoError(t, err, tc.msg)
+		seq, err = parser.Parse(seq)
+		require.NoError(t, err, tc.msg)
+
+		for _, tok := range seq {
+			require.True(t, tok.Start <= tok.End, tc.msg+"\n"+seq.PrintTokens())
+		}
+		last := seq[len(seq)-1]
+		require.Equal(t, "tempfile - abc", last.Value)
+		require.Equal(t, last.Value, tc.msg[last.Start:last.End])
+		require.Equal(t, "dlfssrv", tc.msg[seq[1].Start:seq[1].End])
+	}
+}
+
+func TestParserRemove(t *testing.T) {
+	parser := NewParser()
+	scanner := NewScanner()
+
+	testset := append(parsetests, parsetests2...)
+	if config.markSpaces {
+		testset = append(parsetestsnosp, parsetests2nosp...)
+	}
+
+	parseMsg := func(msg string) (ParseResult, error) {
+		seq, _, err := ScanMessage(scanner, msg, "")
+		require.NoError(t, err, msg)
+		return parser.ParseWithResult(seq)
+	}
+
+	for i, tc := range testset {
+		seq, _, err := scanner.Scan(tc.rule, true, tc.pos)
+		require.NoError(t, err, tc.rule)
+		err = parser.AddPattern(seq, strconv.Itoa(i))
+		require.NoError(t, err, tc.rule)
+	}
+
+	for i, tc := range testset {
+		id := strconv.Itoa(i)
+		require.NoError(t, parser.RemovePattern(id), tc.rule)
+		require.Equal(t, ErrPatternNotFound, parser.RemovePattern(id), tc.rule)
+
+		if pr, err := parseMsg(tc.msg); err == nil {
+			require.NotEqual(t, id, pr.PatternId, tc.msg)
+		}
+
+		// the remaining patterns must still match their messages, some of the
+		// patterns are equivalent so the id can be the one of another pattern
+		for _, rtc := range testset[i+1:] {
+			pr, err := parseMsg(rtc.msg)
+			require.NoError(t, err, rtc.msg)
+			rid, _ := strconv.Atoi(pr.PatternId)
+			require.True(t, rid > i, rtc.msg)
+		}
+	}
+
+	// everything was removed, so the tree must be pruned down to the root
+	require.False(t, parser.root.hasChildren())
+
+	// remove by sequence
+	tc := testset[0]
+	seq, _, err := scanner.Scan(tc.rule, true, tc.pos)
+	require.NoError(t, err, tc.rule)
+	require.NoError(t, parser.Add(seq))
+	_, err = parseMsg(tc.msg)
+	require.NoError(t, err, tc.msg)
+
+	seq, _, err = scanner.Scan(tc.rule, true, tc.pos)
+	require.NoError(t, err, tc.rule)
+	require.NoError(t, parser.Remove(seq))
+	require.Equal(t, ErrPatternNotFound, parser.Remove(seq))
+	_, err = parseMsg(tc.msg)
+	require.Equal(t, ErrNoMatch, err)
+	require.False(t, parser.root.hasChildren())
+}
+
+func TestParserSwap(t *testing.T) {
+	parser := NewParser()
+	scanner := NewScanner()
+
+	testset := parsetests
+	if config.markSpaces {
+		testset = parsetestsnosp
+	}
+	tc := testset[1]
+
+	seq, _, err := scanner.Scan(tc.msg, false, tc.pos)
+	require.NoError(t, err, tc.msg)
+	msg := append(Sequence(nil), seq...)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			parser.Parse(msg)
+		}
+	}()
+
+	// build the new parser while the old one keeps parsing
+	next := NewParser()
+	seq, _, err = scanner.Scan(tc.rule, true, tc.pos)
+	require.NoError(t, err, tc.rule)
+	require.NoError(t, next.AddPattern(seq, "next"))
+
+	parser.Swap(next)
+	<-done
+
+	pr, err := parser.ParseWithResult(msg)
+	require.NoError(t, err, tc.msg)
+	require.Equal(t, "next", pr.PatternId)
+	require.NoError(t, parser.RemovePattern("next"))
+
+	_, err = next.Parse(msg)
+	require.Equal(t, ErrNoMatch, err)
+}
+
+func TestParserStringMatchesText(t *testing.T) {
+	scanner := NewScanner()
+	parser := NewParser()
+
+	// the uuids and hex numbers were literals, the %string% patterns still match them
+	seq, _, err := scanner.Scan("job %string% finished with digest %string%", true, []int{4, 34})
+	require.NoError(t, err)
+	require.NoError(t, parser.Add(seq))
+
+	seq, _, err = scanner.Scan("job 123e4567-e89b-12d3-a456-426614174000 finished with digest 9f86d081884c7d65", false, nil)
+	require.NoError(t, err)
+	_, err = parser.Parse(seq)
+	require.NoError(t, err)
+}
+
+func TestParserSaveLoad(t *testing.T) {
+	parser := NewParser()
+	scanner := NewScanner()
+
+	testset := append(parsetests, parsetests2...)
+	if config.markSpaces {
+		testset = append(parsetestsnosp, parsetests2nosp...)
+	}
+
+	for i, tc := range testset {
+		seq, _, err := scanner.Scan(tc.rule, true, tc.pos)
+		require.NoError(t, err, tc.rule)
+		require.NoError(t, parser.AddPattern(seq, strconv.Itoa(i)), tc.rule)
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, parser.Save(&buf))
+	data := buf.Bytes()
+
+	loaded, err := LoadParser(bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Equal(t, parser.height, loaded.height)
+
+	for _, tc := range testset {
+		seq, _, err := ScanMessage(scanner, tc.msg, "")
+		require.NoError(t, err, tc.msg)
+		want, err := parser.ParseWithResult(seq)
+		require.NoError(t, err, tc.msg)
+
+		seq, _, err = ScanMessage(scanner, tc.msg, "")
+		require.NoError(t, err, tc.msg)
+		got, err := loaded.ParseWithResult(seq)
+		require.NoError(t, err, tc.msg)
+		require.Equal(t, want.PatternId, got.PatternId, tc.msg)
+		require.Equal(t, want.Pattern, got.Pattern, tc.msg)
+		require.Equal(t, want.Fields, got.Fields, tc.msg)
+	}
+
+	// the loaded tree keeps the pattern ids, so patterns can still be removed
+	for i := range testset {
+		require.NoError(t, loaded.RemovePattern(strconv.Itoa(i)))
+	}
+	require.False(t, loaded.root.hasChildren())
+
+	// a different version or tag set makes the file stale
+	bad := append([]byte(nil), data...)
+	bad[len(parserFileMagic)+3]++
+	_, err = LoadParser(bytes.NewReader(bad))
+	require.Error(t, err)
+
+	_, err = LoadParser(bytes.NewReader([]byte("not a parser file")))
+	require.Error(t, err)
+
+	names := config.tagNames
+	config.tagNames = append(append([]string(nil), names...), "fextra")
+	_, err = LoadParser(bytes.NewReader(data))
+	config.tagNames = names
+	require.Error(t, err)
+}
+
+func TestParserLoadInvalidConstraint(t *testing.T) {
+	scanner := NewScanner()
+	rule := "%action:{allow|deny}% from %srcip%"
+	seq, _, err := scanner.Scan(rule, true, tagPositions(rule))
+	require.NoError(t, err)
+	parser := NewParser()
+	require.NoError(t, parser.Add(seq))
+
+	// a crafted file with an invalid regex is rejected instead of panicking
+	var set bool
+	for _, children := range parser.root.tc {
+		for _, c := range children {
+			if c.constraint != "" {
+				c.constraint, set = "/(/", true
+			}
+		}
+	}
+	require.True(t, set)
+
+	var buf bytes.Buffer
+	require.NoError(t, parser.Save(&buf))
+	_, err = LoadParser(&buf)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Invalid parser file")
+}
+
+func TestParserCached(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sequence")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	cache := filepath.Join(dir, "parser.seqp")
+
+	scanner := NewScanner()
+	rule := "user %srcuser% login %status%"
+	builds := 0
+	build := func() *Parser {
+		builds++
+		seq, _, err := scanner.Scan(rule, true, tagPositions(rule))
+		require.NoError(t, err)
+		parser := NewParser()
+		require.NoError(t, parser.AddPattern(seq, "p1"))
+		return parser
+	}
+
+	past := time.Now().Add(-time.Hour)
+	parser, err := CachedParser(cache, past, build)
+	require.NoError(t, err)
+	require.Equal(t, 1, builds)
+
+	// the cache is newer than the patterns
+	parser, err = CachedParser(cache, past, build)
+	require.NoError(t, err)
+	require.Equal(t, 1, builds)
+	seq, _, err := scanner.Scan("user bob login ok", false, nil)
+	require.NoError(t, err)
+	pr, err := parser.ParseWithResult(seq)
+	require.NoError(t, err)
+	require.Equal(t, "p1", pr.PatternId)
+
+	// the patterns changed after the cache was saved
+	_, err = CachedParser(cache, time.Now().Add(time.Hour), build)
+	require.NoError(t, err)
+	require.Equal(t, 2, builds)
+
+	// an invalid cache is rebuilt
+	require.NoError(t, ioutil.WriteFile(cache, []byte("not a parser file"), 0600))
+	parser, err = CachedParser(cache, past, build)
+	require.Error(t, err)
+	require.NotNil(t, parser)
+	require.Equal(t, 3, builds)
+	_, err = LoadParserFromFile(cache)
+	require.NoError(t, err)
+
+	// the cache saved with other custom token regexes is rebuilt
+	defer ReadConfig("sequence.toml")
+	require.NoError(t, readTestConfig(customTokensConfig))
+	_, err = CachedParser(cache, past, build)
+	require.Error(t, err)
+	require.Equal(t, 4, builds)
+	require.NoError(t, readTestConfig(strings.Replace(customTokensConfig, "[a-z]+", "[a-z0-9]+", 1)))
+	_, err = CachedParser(cache, past, build)
+	require.Error(t, err)
+	require.Equal(t, 5, builds)
+	_, err = CachedParser(cache, past, build)
+	require.NoError(t, err)
+	require.Equal(t, 5, builds)
+
+	// the cache saved with other match options is rebuilt
+	config.caseInsensitive = !config.caseInsensitive
+	parser, err = CachedParser(cache, past, build)
+	require.Error(t, err)
+	require.Equal(t, 6, builds)
+	require.Equal(t, DefaultMatchOptions(), parser.Options())
+}
+
+func TestParserStats(t *testing.T) {
+	parser := NewParser()
+	scanner := NewScanner()
+
+	testset := parsetests
+	if config.markSpaces {
+		testset = parsetestsnosp
+	}
+
+	for i, tc := range testset[:2] {
+		seq, _, err := scanner.Scan(tc.rule, true, tc.pos)
+		require.NoError(t, err, tc.rule)
+		require.NoError(t, parser.AddPattern(seq, strconv.Itoa(i)), tc.rule)
+	}
+
+	parseMsg := func(msg string) {
+		seq, _, err := ScanMessage(scanner, msg, "")
+		require.NoError(t, err, msg)
+		parser.Parse(seq)
+	}
+
+	// nothing is counted until the stats are enabled
+	parseMsg(testset[0].msg)
+	stats := parser.Stats()
+	require.True(t, stats.Since.IsZero())
+	require.Equal(t, uint64(0), stats.Matched())
+
+	before := time.Now()
+	parser.EnableStats(true)
+	parseMsg(testset[0].msg)
+	parseMsg(testset[0].msg)
+	parseMsg(testset[1].msg)
+	parseMsg("no pattern matches this message")
+
+	stats = parser.Stats()
+	require.Len(t, stats.Patterns, 2)
+	require.Equal(t, "0", stats.Patterns[0].PatternId)
+	require.Equal(t, uint64(2), stats.Patterns[0].Hits)
+	require.False(t, stats.Patterns[0].LastMatch.Before(before))
+	require.Equal(t, "1", stats.Patterns[1].PatternId)
+	require.Equal(t, uint64(1), stats.Patterns[1].Hits)
+	require.Equal(t, uint64(1), stats.NoMatch)
+	require.Equal(t, uint64(3), stats.Matched())
+	require.Equal(t, 0.75, stats.Coverage())
+
+	parser.EnableStats(false)
+	parseMsg(testset[1].msg)
+	require.Equal(t, uint64(1), parser.Stats().Patterns[1].Hits)
+
+	parser.ResetStats()
+	stats = parser.Stats()
+	require.Equal(t, uint64(0), stats.Matched())
+	require.Equal(t, uint64(0), stats.NoMatch)
+	require.True(t, stats.Patterns[0].LastMatch.IsZero())
+	require.Equal(t, 0.0, stats.Coverage())
+}
+
+func TestParserMatchOptions(t *testing.T) {
+	scanner := NewScanner()
+
+	build := func(options MatchOptions, patterns ...string) *Parser {
+		parser := NewParserWithOptions(options)
+		for _, p := range patterns {
+			seq, _, err := scanner.Scan(p, true, tagPositions(p))
+			require.NoError(t, err, p)
+			require.NoError(t, parser.AddPattern(seq, p), p)
+		}
+		return parser
+	}
+
+	parseMsg := func(parser *Parser, msg string) (string, error) {
+		seq, _, err := ScanMessage(scanner, msg, "")
+		require.NoError(t, err, msg)
+		pr, err := parser.ParseWithResult(seq)
+		return pr.PatternId, err
+	}
+
+	pattern := "Accepted password for %srcuser%"
+
+	parser := build(MatchOptions{}, pattern)
+	_, err := parseMsg(parser, "accepted password for root")
+	require.Equal(t, ErrNoMatch, err)
+
+	parser = build(MatchOptions{CaseInsensitive: true}, pattern)
+	id, err := parseMsg(parser, "accepted PASSWORD for root")
+	require.NoError(t, err)
+	require.Equal(t, pattern, id)
+
+	// the patterns that only differ by case share their nodes
+	parser = build(MatchOptions{CaseInsensitive: true}, pattern, "accepted password for %srcuser%")
+	require.Len(t, parser.root.lc, 1)
+
+	if !config.markSpaces {
+		return
+	}
+
+	pattern = "session closed: %srcuser%"
+
+	parser = build(MatchOptions{}, pattern)
+	id, err = parseMsg(parser, "session closed : root")
+	require.NoError(t, err)
+	require.Equal(t, pattern, id)
+
+	parser = build(MatchOptions{StrictSpacing: true}, pattern)
+	_, err = parseMsg(parser, "session closed : root")
+	require.Equal(t, ErrNoMatch, err)
+	_, err = parseMsg(parser, "session closed:root")
+	require.Equal(t, ErrNoMatch, err)
+	id, err = parseMsg(parser, "session closed: root")
+	require.NoError(t, err)
+	require.Equal(t, pattern, id)
+
+	// the tokens repeated by a + node can be spaced either way
+	pattern = "users: %string:+%"
+	parser = build(MatchOptions{StrictSpacing: true}, pattern)
+	id, err = parseMsg(parser, "users: alice bob,carol")
+	require.NoError(t, err)
+	require.Equal(t, pattern, id)
+
+	// the options are kept by Swap and by a saved tree
+	other := NewParser()
+	other.Swap(parser)
+	require.Equal(t, MatchOptions{StrictSpacing: true}, other.Options())
+
+	var buf bytes.Buffer
+	require.NoError(t, other.Save(&buf))
+	loaded, err := LoadParser(&buf)
+	require.NoError(t, err)
+	require.Equal(t, MatchOptions{StrictSpacing: true}, loaded.Options())
+}
+
+func TestParserQuantities(t *testing.T) {
+	scanner := NewScanner()
+	parser := NewParser()
+	var pos []int
+
+	pattern := "session closed after %duration% with %bytesrecv% received"
+	seq, _, err := scanner.Scan(pattern, true, tagPositions(pattern))
+	require.NoError(t, err)
+	require.NoError(t, parser.Add(seq))
+
+	// the duration and sizes can have any unit, or none
+	for _, tc := range []struct {
+		msg      string
+		duration float64
+		bytes    float64
+	}{
+		{"session closed after 1h30m with 12.5MB received", 5400, 13107200},
+		{"session closed after 153ms with 512 received", 0.153, 512},
+		{"session closed after 27 with 2KB received", 27, 2048},
+	} {
+		seq, _, err := scanner.Scan(tc.msg, false, pos)
+		require.NoError(t, err, tc.msg)
+		pr, err := parser.ParseWithResult(seq)
+		require.NoError(t, err, tc.msg)
+
+		values, errs := pr.Values()
+		require.Empty(t, errs, tc.msg)
+		require.InDelta(t, tc.duration, values["duration"], 1e-9, tc.msg)
+		require.InDelta(t, tc.bytes, values["bytesrecv"], 1e-9, tc.msg)
+	}
+}
+
+func TestParserHostEmail(t *testing.T) {
+	scanner := NewScanner()
+	parser := NewParser()
+	var pos []int
+
+	for _, p := range []string{
+		"connection from %srchost% for %srcemail%",
+		"connection from %string% for %string%",
+	} {
+		seq, _, err := scanner.Scan(p, true, tagPositions(p))
+		require.NoError(t, err, p)
+		require.NoError(t, parser.AddPattern(seq, p), p)
+	}
+
+	// the typed tokens are only matched by the host names and email addresses
+	for _, tc := range []struct {
+		msg, pattern string
+	}{
+		{"connection from mx1.example.com for bob@example.org", "connection from %srchost% for %srcemail%"},
+		{"connection from mail.company.office for userA@company.office", "connection from %srchost% for %srcemail%"},
+		{"connection from localhost for bob", "connection from %string% for %string%"},
+		{"connection from 10.0.0.1.example for bob@", "connection from %string% for %string%"},
+	} {
+		seq, _, err := scanner.Scan(tc.msg, false, pos)
+		require.NoError(t, err, tc.msg)
+		pr, err := parser.ParseWithResult(seq)
+		require.NoError(t, err, tc.msg)
+		require.Equal(t, tc.pattern, pr.PatternId, tc.msg)
+	}
+}
+
+func TestParserEpoch(t *testing.T) {
+	defer ReadConfig("sequence.toml")
+	require.NoError(t, readTestConfig("", testEpochWindow("2023-01-01", "2027-01-01")...))
+
+	scanner := NewScanner()
+	parser := NewParser()
+	var pos []int
+
+	pattern := "job %integer% finished at %msgtime:epochms%"
+	seq, _, err := scanner.Scan(pattern, true, tagPositions(pattern))
+	require.NoError(t, err)
+	require.NoError(t, parser.Add(seq))
+
+	seq, _, err = scanner.Scan("job 42 finished at 1697612345123", false, pos)
+	require.NoError(t, err)
+	pr, err := parser.ParseWithResult(seq)
+	require.NoError(t, err)
+	values, errs := pr.Values()
+	require.Empty(t, errs)
+	require.Equal(t, time.Unix(1697612345, 123000000).UTC(), values["msgtime"])
+
+	// the epoch time stamps are also parsed by the time tags without a unit
+	pattern = "job %integer% started at %msgtime%"
+	seq, _, err = scanner.Scan(pattern, true, tagPositions(pattern))
+	require.NoError(t, err)
+	require.NoError(t, parser.Add(seq))
+
+	seq, _, err = scanner.Scan("job 42 started at 1697612345", false, pos)
+	require.NoError(t, err)
+	_, err = parser.Parse(seq)
+	require.NoError(t, err)
+}
+
+func TestParserCustomTokens(t *testing.T) {
+	defer ReadConfig("sequence.toml")
+	require.NoError(t, readTestConfig(customTokensConfig, testTag("batchjob:jobid")...))
+
+	scanner := NewScanner()
+	parser := NewParser()
+	var pos []int
+
+	for _, p := range []string{
+		"job %batchjob% started for %ticket%",
+		"job %string% done",
+	} {
+		seq, _, err := scanner.Scan(p, true, tagPositions(p))
+		require.NoError(t, err, p)
+		require.NoError(t, parser.AddPattern(seq, p), p)
+	}
+
+	// the custom tokens were literals, so the %string% patterns still match them
+	for _, tc := range []struct {
+		msg, pattern, job string
+	}{
+		{"job job.12345.batch started for INC004512", "job %batchjob% started for %ticket%", "job.12345.batch"},
+		{"job job.12345.batch done", "job %string% done", ""},
+	} {
+		seq, _, err := scanner.Scan(tc.msg, false, pos)
+		require.NoError(t, err, tc.msg)
+		pr, err := parser.ParseWithResult(seq)
+		require.NoError(t, err, tc.msg)
+		require.Equal(t, tc.pattern, pr.PatternId, tc.msg)
+		if tc.job != "" {
+			values, _ := pr.Values()
+			require.Equal(t, tc.job, values["batchjob"])
+		}
+	}
+
+	seq, _, err := scanner.Scan("job job.12345 started for INC004512", false, pos)
+	require.NoError(t, err)
+	_, err = parser.Parse(seq)
+	require.Equal(t, ErrNoMatch, err)
+}
+
+func TestParserBareHostNames(t *testing.T) {
+	scanner := NewScanner()
+	parser := NewParser()
+	var pos []int
+
+	// the srchost and dsthost tags are strings, so the patterns still match the
+	// host names without a domain
+	p := "connection from %srchost% to %dsthost% closed"
+	seq, _, err := scanner.Scan(p, true, tagPositions(p))
+	require.NoError(t, err)
+	require.NoError(t, parser.AddPattern(seq, p))
+
+	for _, msg := range []string{
+		"connection from localhost to web01 closed",
+		"connection from web01 to mx1.example.com closed",
+		"connection from mx1.example.com to localhost closed",
+	} {
+		seq, _, err := scanner.Scan(msg, false, pos)
+		require.NoError(t, err, msg)
+		pr, err := parser.ParseWithResult(seq)
+		require.NoError(t, err, msg)
+		require.Equal(t, p, pr.PatternId, msg)
+	}
+}
+
+func TestSequenceFields(t *testing.T) {
+	seq := Sequence{
+		Token{Type: TokenString, Value: "a"},
+		Token{Type: TokenLiteral, Value: "="},
+		Token{Type: TokenString, Value: "b"},
+		Token{Type: TokenString, Value: "c"},
+		Token{Type: TokenIPv4, Tag: TagSrcIP, Value: "10.0.0.1"},
+	}
+
+	require.Equal(t, map[string]string{"string": "a", "string1": "b", "string2": "c", "srcip": "10.0.0.1"}, seq.Fields(nil))
+	require.Equal(t, map[string]string{"f": "a", "f1": "b", "f2": "c", "f3": "10.0.0.1"}, seq.Fields(func(string) string { return "f" }))
+}
+
+func TestSequenceValues(t *testing.T) {
+	seq := Sequence{
+		Token{Type: TokenTime, Tag: TagMsgTime, Value: "2005-03-18 14:01:46"},
+		Token{Type: TokenInteger, Tag: TagSrcPort, Value: "4958"},
+		Token{Type: TokenFloat, Value: "0.24"},
+		Token{Type: TokenIPv4, Tag: TagSrcIP, Value: "210.82.121.91"},
+		Token{Type: TokenIPv6, Value: "fe80::1"},
+		Token{Type: TokenMac, Tag: TagSrcMac, Value: "00:0b:5f:b2:1d:80"},
+		Token{Type: TokenString, Value: "deny"},
+		Token{Type: TokenInteger, Value: "99999999999999999999"},
+		Token{Type: TokenTime, Value: "not a time"},
+	}
+
+	values, errs := seq.Values(nil)
+	require.Equal(t, time.Date(2005, 3, 18, 14, 1, 46, 0, time.UTC), values["msgtime"])
+	require.Equal(t, int64(4958), values["srcport"])
+	require.Equal(t, 0.24, values["float"])
+	require.Equal(t, net.ParseIP("210.82.121.91"), values["srcip"])
+	require.Equal(t, net.ParseIP("fe80::1"), values["ipv6"])
+	mac, _ := net.ParseMAC("00:0b:5f:b2:1d:80")
+	require.Equal(t, mac, values["srcmac"])
+	require.Equal(t, "deny", values["string"])
+
+	require.Len(t, errs, 2)
+	require.Error(t, errs["integer"])
+	require.Error(t, errs["time"])
+	require.NotContains(t, values, "integer")
+	require.NotContains(t, values, "time")
+}
+
+func TestParserParseValues(t *testing.T) {
+	parser := NewParser()
+	scanner := NewScanner()
+	var pos []int
+
+	tc := parsetests2nosp[6]
+	if !config.markSpaces {
+		tc = parsetests2[6]
+	}
+
+	seq, _, err := scanner.Scan(tc.rule, true, tc.pos)
+	require.NoError(t, err, tc.rule)
+	require.NoError(t, parser.Add(seq), tc.rule)
+
+	seq, _, err = scanner.Scan(tc.msg, false, pos)
+	require.NoError(t, err, tc.msg)
+	pr, err := parser.ParseWithResult(seq)
+	require.NoError(t, err, tc.msg)
+
+	values, errs := pr.Values()
+	require.Empty(t, errs)
+	require.Equal(t, time.Date(2005, 3, 18, 14, 1, 46, 0, time.UTC), values["regextime"])
+	require.Equal(t, net.ParseIP("61.167.71.244"), values["srcip"])
+	require.Equal(t, int64(35223), values["srcport"])
+	require.Equal(t, float64(20926), values["bytesrecv"])
+	require.Equal(t, "TCP", values["protocol"])
+}
+
+// tagPositions returns the positions of the tag tokens in the pattern, as they are
+// stored with the patterns in the database.
+func tagPositions(pattern string) []int {
+	var pos []int
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] == '%' {
+			pos = append(pos, i)
+			i += strings.Index(pattern[i+1:], "%") + 1
+		}
+	}
+	return pos
+}
+
 func BenchmarkParserParseMeta(b *testing.B) {
 	benchmarkRunParser(b, parsetests2[3])
 }
@@ -0,0 +1,387 @@
+package sequence
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+//The compiled parser tree is saved to a binary file, so a parser with a large number of patterns
+//can be loaded without scanning and adding every pattern again.
+//The file starts with parserFileMagic and the version of the format, followed by the gob encoded tree.
+//The tag and token type names of the config are saved with the tree, as the tree only stores their
+//numbers, a file saved with different tags or token types is rejected when loaded. The regexes of
+//the custom token types are saved too, as the tokens of the tree were scanned with them.
+const (
+	parserFileMagic   = "SEQP"
+	parserFileVersion = uint32(2)
+)
+
+type savedParser struct {
+	TagNames     []string
+	TagTypes     []TokenType
+	TokenTypes   []string
+	CustomTokens []string
+	Options      MatchOptions
+	Height     int
+	Ids        map[string][]savedToken
+	Nodes      []savedNode
+}
+
+//A node refers to its children by their index in the list of nodes, as the + and * tokens
+//make the nodes share children, or be their own child.
+type savedNode struct {
+	Token    savedToken
+	Leaf     bool
+	Parent   bool
+	Minus    bool
+	Patterns []savedPattern
+	TC       [][]int
+	LC       map[string]int
+}
+
+type savedToken struct {
+	Type          TokenType
+	Tag           TagType
+	Value         string
+	Special       string
+	IsSpaceBefore bool
+	IsKey         bool
+	IsValue       bool
+	Minus         bool
+	Plus          bool
+	Star          bool
+	Until         string
+	Constraint    string
+}
+
+type savedPattern struct {
+	Id   string
+	Text string
+}
+
+//Writes the parser tree to the writer in the versioned binary format.
+func (this *Parser) Save(w io.Writer) error {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+
+	sp := savedParser{
+		TagNames:     config.tagNames,
+		TagTypes:     config.tagTypes,
+		TokenTypes:   tokenTypeNames(),
+		CustomTokens: customTokenRegexes(),
+		Options:      this.options,
+		Height:       this.height,
+		Ids:          make(map[string][]savedToken, len(this.ids)),
+	}
+
+	for id, seq := range this.ids {
+		toks := make([]savedToken, len(seq))
+		for i, t := range seq {
+			toks[i] = saveToken(t)
+		}
+		sp.Ids[id] = toks
+	}
+
+	//number the nodes breadth first, the root is 0
+	index := map[*parseNode]int{this.root: 0}
+	nodes := []*parseNode{this.root}
+	add := func(n *parseNode) int {
+		i, ok := index[n]
+		if !ok {
+			i = len(nodes)
+			index[n] = i
+			nodes = append(nodes, n)
+		}
+		return i
+	}
+
+	for i := 0; i < len(nodes); i++ {
+		n := nodes[i]
+		sn := savedNode{
+			Token:  saveToken(n.Token),
+			Leaf:   n.leaf,
+			Parent: n.parent,
+			Minus:  n.minus,
+			TC:     make([][]int, len(n.tc)),
+			LC:     make(map[string]int, len(n.lc)),
+		}
+		for _, p := range n.patterns {
+			sn.Patterns = append(sn.Patterns, savedPattern{p.id, p.text})
+		}
+		for t, children := range n.tc {
+			for _, c := range children {
+				sn.TC[t] = append(sn.TC[t], add(c))
+			}
+		}
+		for v, c := range n.lc {
+			sn.LC[v] = add(c)
+		}
+		sp.Nodes = append(sp.Nodes, sn)
+	}
+
+	if _, err := io.WriteString(w, parserFileMagic); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, parserFileVersion); err != nil {
+		return err
+	}
+	return gob.NewEncoder(w).Encode(&sp)
+}
+
+//Reads a parser tree written by Save. The tree is rejected if the file is not a parser file,
+//has another version or was saved with tags or token types that differ from the current config.
+func LoadParser(r io.Reader) (*Parser, error) {
+	magic := make([]byte, len(parserFileMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != parserFileMagic {
+		return nil, fmt.Errorf("Invalid parser file: missing header")
+	}
+
+	var version uint32
+	if err := binary.Read(r, binary.BigEndian, &version); err != nil {
+		return nil, fmt.Errorf("Invalid parser file: %v", err)
+	}
+	if version != parserFileVersion {
+		return nil, fmt.Errorf("Invalid parser file: version %d, expecting %d", version, parserFileVersion)
+	}
+
+	var sp savedParser
+	if err := gob.NewDecoder(r).Decode(&sp); err != nil {
+		return nil, fmt.Errorf("Invalid parser file: %v", err)
+	}
+
+	if !equalStrings(sp.TagNames, config.tagNames) || !equalTokenTypes(sp.TagTypes, config.tagTypes) {
+		return nil, fmt.Errorf("Stale parser file: the tags in the config have changed")
+	}
+	if !equalStrings(sp.TokenTypes, tokenTypeNames()) {
+		return nil, fmt.Errorf("Stale parser file: the token types have changed")
+	}
+	if !equalStrings(sp.CustomTokens, customTokenRegexes()) {
+		return nil, fmt.Errorf("Stale parser file: the regexes of the custom token types have changed")
+	}
+	if len(sp.Nodes) == 0 {
+		return nil, fmt.Errorf("Invalid parser file: no root node")
+	}
+
+	nodes := make([]*parseNode, len(sp.Nodes))
+	for i := range nodes {
+		nodes[i] = newParseNode()
+	}
+
+	child := func(i int) (*parseNode, error) {
+		if i < 0 || i >= len(nodes) {
+			return nil, fmt.Errorf("Invalid parser file: node %d out of range", i)
+		}
+		return nodes[i], nil
+	}
+
+	for i, sn := range sp.Nodes {
+		n := nodes[i]
+		n.Token = sn.Token.token()
+		n.leaf, n.parent, n.minus = sn.Leaf, sn.Parent, sn.Minus
+		if n.constraint != "" {
+			if err := checkTagConstraint(n.constraint); err != nil {
+				return nil, fmt.Errorf("Invalid parser file: constraint %q: %v", n.constraint, err)
+			}
+		}
+		n.setConstraint(n.constraint)
+		for _, p := range sn.Patterns {
+			n.patterns = append(n.patterns, parsePattern{p.Id, p.Text, &patternStats{}})
+		}
+		if len(sn.TC) > len(n.tc) {
+			return nil, fmt.Errorf("Invalid parser file: too many token types")
+		}
+		for t, children := range sn.TC {
+			for _, c := range children {
+				cn, err := child(c)
+				if err != nil {
+					return nil, err
+				}
+				n.tc[t] = append(n.tc[t], cn)
+			}
+		}
+		for v, c := range sn.LC {
+			cn, err := child(c)
+			if err != nil {
+				return nil, err
+			}
+			n.lc[v] = cn
+		}
+	}
+
+	parser := NewParserWithOptions(sp.Options)
+	parser.root = nodes[0]
+	parser.height = sp.Height
+	for id, toks := range sp.Ids {
+		seq := make(Sequence, len(toks))
+		for i, t := range toks {
+			seq[i] = t.token()
+		}
+		parser.ids[id] = seq
+	}
+
+	return parser, nil
+}
+
+//Saves the parser tree to a file, see Save.
+func (this *Parser) SaveToFile(fname string) error {
+	f, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	if err = this.Save(w); err == nil {
+		err = w.Flush()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+//Loads a parser tree from a file, see LoadParser.
+func LoadParserFromFile(fname string) (*Parser, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return LoadParser(bufio.NewReader(f))
+}
+
+//Returns the parser saved in the cache file if the file is newer than modified, the time the
+//patterns last changed, otherwise the parser returned by build, which is saved to the cache file.
+//A cache file that cannot be loaded, e.g. saved with other tags or match options, is rebuilt. The
+//parser is always returned, the error reports a cache file that could not be loaded or saved. An
+//empty cache file name always builds the parser.
+func CachedParser(cache string, modified time.Time, build func() *Parser) (*Parser, error) {
+	if cache == "" {
+		return build(), nil
+	}
+
+	var lerr error
+	if fi, err := os.Stat(cache); err == nil && fi.ModTime().After(modified) {
+		parser, err := loadCachedParser(cache)
+		if err == nil {
+			return parser, nil
+		}
+		lerr = fmt.Errorf("Rebuilding the parser cache %s: %v", cache, err)
+	}
+
+	parser := build()
+	if err := parser.SaveToFile(cache); err != nil {
+		return parser, fmt.Errorf("Unable to save the parser cache %s: %v", cache, err)
+	}
+	return parser, lerr
+}
+
+//Loads the parser of a cache file, it is rejected if it was saved with other match options than
+//the ones of the config, as the parsers of the cache are built with NewParser.
+func loadCachedParser(cache string) (*Parser, error) {
+	parser, err := LoadParserFromFile(cache)
+	if err != nil {
+		return nil, err
+	}
+	if parser.Options() != DefaultMatchOptions() {
+		return nil, fmt.Errorf("Stale parser file: the match options in the config have changed")
+	}
+	return parser, nil
+}
+
+//Returns true if the parser has exactly the patterns of the map, keyed by pattern id.
+func (this *Parser) hasPatternIds(pmap map[string]AnalyzerResult) bool {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+
+	if len(this.ids) != len(pmap) {
+		return false
+	}
+	for id := range this.ids {
+		if _, ok := pmap[id]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func saveToken(t Token) savedToken {
+	return savedToken{
+		Type:          t.Type,
+		Tag:           t.Tag,
+		Value:         t.Value,
+		Special:       t.Special,
+		IsSpaceBefore: t.IsSpaceBefore,
+		IsKey:         t.isKey,
+		IsValue:       t.isValue,
+		Minus:         t.minus,
+		Plus:          t.plus,
+		Star:          t.star,
+		Until:         t.until,
+		Constraint:    t.constraint,
+	}
+}
+
+func (this savedToken) token() Token {
+	return Token{
+		Type:          this.Type,
+		Tag:           this.Tag,
+		Value:         this.Value,
+		Special:       this.Special,
+		IsSpaceBefore: this.IsSpaceBefore,
+		isKey:         this.IsKey,
+		isValue:       this.IsValue,
+		minus:         this.Minus,
+		plus:          this.Plus,
+		star:          this.Star,
+		until:         this.Until,
+		constraint:    this.Constraint,
+	}
+}
+
+//The names of the token types the parser nodes are indexed by.
+func tokenTypeNames() []string {
+	names := make([]string, TokenTypesCount)
+	for i := range names {
+		names[i] = TokenType(i).String()
+	}
+	return names
+}
+
+//customTokenRegexes returns the names, prefixes and regexes of the custom token types.
+func customTokenRegexes() []string {
+	var regexes []string
+	for _, ct := range customTokens {
+		regexes = append(regexes, fmt.Sprintf("%s %q %q", ct.name, ct.prefix, ct.regex))
+	}
+	return regexes
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func equalTokenTypes(a, b []TokenType) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,179 @@
+package sequence
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+//The parser can count the messages matched by each of its patterns, so the coverage of the
+//patterns is known without the database. The counting is off by default, see EnableStats.
+//The counters are updated with atomic operations, so parsing is not serialised by them.
+
+//patternStats holds the counters of a pattern at a leaf of the tree. It is allocated on its own
+//so the 64 bit fields are aligned for the atomic operations.
+type patternStats struct {
+	hits      uint64 // number of messages matched
+	parseTime int64  // total time spent parsing the messages matched, in nanoseconds
+	lastMatch int64  // time of the last match, in nanoseconds since the epoch
+}
+
+//PatternStats is the snapshot of the counters of a pattern.
+type PatternStats struct {
+	PatternId string        // PatternId is the id given when the pattern was added, can be empty.
+	Pattern   string        // Pattern is the text of the pattern.
+	Hits      uint64        // Hits is the number of messages matched by the pattern.
+	LastMatch time.Time     // LastMatch is the time of the last match, zero if the pattern never matched.
+	ParseTime time.Duration // ParseTime is the total time spent parsing the messages matched.
+}
+
+//ParserStats is the snapshot of the counters of a parser, returned by Stats.
+type ParserStats struct {
+	Since       time.Time      // Since is the time the counters were enabled or last reset.
+	Patterns    []PatternStats // Patterns holds the counters of all the patterns, the most matched first.
+	NoMatch     uint64         // NoMatch is the number of messages that no pattern matched.
+	NoMatchTime time.Duration  // NoMatchTime is the total time spent parsing the messages that did not match.
+}
+
+//Matched returns the number of messages matched by any pattern.
+func (this ParserStats) Matched() uint64 {
+	var n uint64
+	for _, p := range this.Patterns {
+		n += p.Hits
+	}
+	return n
+}
+
+//Coverage returns the ratio of the messages parsed that matched a pattern,
+//0 if no message was parsed.
+func (this ParserStats) Coverage() float64 {
+	matched := this.Matched()
+	if matched+this.NoMatch == 0 {
+		return 0
+	}
+	return float64(matched) / float64(matched+this.NoMatch)
+}
+
+//EnableStats turns the counting of the matches on or off, the counters keep their values
+//when it is turned off. Turning it on resets Since if the counters were never enabled.
+func (this *Parser) EnableStats(on bool) {
+	if on {
+		atomic.CompareAndSwapInt64(&this.statsSince, 0, time.Now().UnixNano())
+		atomic.StoreInt32(&this.statsOn, 1)
+	} else {
+		atomic.StoreInt32(&this.statsOn, 0)
+	}
+}
+
+func (this *Parser) statsEnabled() bool {
+	return atomic.LoadInt32(&this.statsOn) == 1
+}
+
+//record counts the outcome of a parse started at start, leaf is nil if nothing matched.
+//The caller must hold the read lock.
+func (this *Parser) record(leaf *parseNode, start time.Time) {
+	now := time.Now()
+	d := int64(now.Sub(start))
+
+	if leaf == nil {
+		atomic.AddUint64(&this.noMatch, 1)
+		atomic.AddInt64(&this.noMatchTime, d)
+		return
+	}
+
+	s := leaf.patterns[len(leaf.patterns)-1].stats
+	atomic.AddUint64(&s.hits, 1)
+	atomic.AddInt64(&s.parseTime, d)
+	atomic.StoreInt64(&s.lastMatch, now.UnixNano())
+}
+
+//Stats returns a snapshot of the counters. A pattern reached by more than one path in the
+//tree is reported once, with its counters added up.
+func (this *Parser) Stats() ParserStats {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+
+	stats := ParserStats{
+		NoMatch:     atomic.LoadUint64(&this.noMatch),
+		NoMatchTime: time.Duration(atomic.LoadInt64(&this.noMatchTime)),
+	}
+	if since := atomic.LoadInt64(&this.statsSince); since != 0 {
+		stats.Since = time.Unix(0, since)
+	}
+
+	index := make(map[parsePattern]int)
+	this.eachPattern(func(p parsePattern) {
+		key := parsePattern{id: p.id, text: p.text}
+		i, ok := index[key]
+		if !ok {
+			i = len(stats.Patterns)
+			index[key] = i
+			stats.Patterns = append(stats.Patterns, PatternStats{PatternId: p.id, Pattern: p.text})
+		}
+
+		ps := &stats.Patterns[i]
+		ps.Hits += atomic.LoadUint64(&p.stats.hits)
+		ps.ParseTime += time.Duration(atomic.LoadInt64(&p.stats.parseTime))
+		if last := atomic.LoadInt64(&p.stats.lastMatch); last != 0 {
+			if t := time.Unix(0, last); t.After(ps.LastMatch) {
+				ps.LastMatch = t
+			}
+		}
+	})
+
+	sort.SliceStable(stats.Patterns, func(i, j int) bool {
+		if stats.Patterns[i].Hits != stats.Patterns[j].Hits {
+			return stats.Patterns[i].Hits > stats.Patterns[j].Hits
+		}
+		return stats.Patterns[i].Pattern < stats.Patterns[j].Pattern
+	})
+
+	return stats
+}
+
+//ResetStats sets all the counters back to zero, and Since to now.
+func (this *Parser) ResetStats() {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+
+	this.eachPattern(func(p parsePattern) {
+		atomic.StoreUint64(&p.stats.hits, 0)
+		atomic.StoreInt64(&p.stats.parseTime, 0)
+		atomic.StoreInt64(&p.stats.lastMatch, 0)
+	})
+
+	atomic.StoreUint64(&this.noMatch, 0)
+	atomic.StoreInt64(&this.noMatchTime, 0)
+	atomic.StoreInt64(&this.statsSince, time.Now().UnixNano())
+}
+
+//eachPattern calls fn for the patterns of every leaf of the tree, the tree shares nodes
+//so each node is visited once. The caller must hold the lock.
+func (this *Parser) eachPattern(fn func(parsePattern)) {
+	visited := map[*parseNode]bool{this.root: true}
+	stack := []*parseNode{this.root}
+
+	push := func(n *parseNode) {
+		if !visited[n] {
+			visited[n] = true
+			stack = append(stack, n)
+		}
+	}
+
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		for _, p := range n.patterns {
+			fn(p)
+		}
+		for _, children := range n.tc {
+			for _, c := range children {
+				push(c)
+			}
+		}
+		for _, c := range n.lc {
+			push(c)
+		}
+	}
+}
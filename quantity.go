@@ -0,0 +1,166 @@
+package sequence
+
+import (
+	"fmt"
+	"strconv"
+)
+
+//The quantities are numbers followed by their unit, such as 153ms, 12.5MB or 87%.
+//They are scanned as TokenTimeSpan, TokenSize and TokenPercent tokens that keep their unit,
+//and TypedValue normalises them to seconds, bytes and a ratio.
+
+//quantityTypes are the token types of the quantities that can also be plain numbers.
+var quantityTypes = []TokenType{TokenTimeSpan, TokenSize}
+
+//quantityUnits lists the units of the quantities, the longest ones first as the first unit
+//that matches is the one used. The sizes are in powers of 1024, as they are in most logs.
+var quantityUnits = []struct {
+	unit   string
+	ttype  TokenType
+	factor float64
+}{
+	{"secs", TokenTimeSpan, 1},
+	{"mins", TokenTimeSpan, 60},
+	{"sec", TokenTimeSpan, 1},
+	{"min", TokenTimeSpan, 60},
+	{"hrs", TokenTimeSpan, 3600},
+	{"KiB", TokenSize, 1 << 10},
+	{"MiB", TokenSize, 1 << 20},
+	{"GiB", TokenSize, 1 << 30},
+	{"TiB", TokenSize, 1 << 40},
+	{"PiB", TokenSize, 1 << 50},
+	{"ns", TokenTimeSpan, 1e-9},
+	{"us", TokenTimeSpan, 1e-6},
+	{"µs", TokenTimeSpan, 1e-6},
+	{"ms", TokenTimeSpan, 1e-3},
+	{"hr", TokenTimeSpan, 3600},
+	{"KB", TokenSize, 1 << 10},
+	{"kB", TokenSize, 1 << 10},
+	{"kb", TokenSize, 1 << 10},
+	{"MB", TokenSize, 1 << 20},
+	{"mb", TokenSize, 1 << 20},
+	{"GB", TokenSize, 1 << 30},
+	{"gb", TokenSize, 1 << 30},
+	{"TB", TokenSize, 1 << 40},
+	{"tb", TokenSize, 1 << 40},
+	{"PB", TokenSize, 1 << 50},
+	{"s", TokenTimeSpan, 1},
+	{"m", TokenTimeSpan, 60},
+	{"h", TokenTimeSpan, 3600},
+	{"d", TokenTimeSpan, 86400},
+	{"B", TokenSize, 1},
+	{"K", TokenSize, 1 << 10},
+	{"M", TokenSize, 1 << 20},
+	{"G", TokenSize, 1 << 30},
+	{"T", TokenSize, 1 << 40},
+	{"%", TokenPercent, 0.01},
+}
+
+//scanQuantity returns the length and type of the quantity at the start of data, or 0 if there
+//is none. The time spans can be made of several parts, such as 1h30m.
+func (this *Message) scanQuantity(data string, nt int) (int, TokenType) {
+	n, t := 0, TokenUnknown
+
+	for n < len(data) {
+		d := numberLen(data[n:])
+		if d == 0 {
+			break
+		}
+
+		u, ut, _ := quantityUnit(data[n+d:])
+		if u == 0 || (t != TokenUnknown && ut != TokenTimeSpan) {
+			break
+		}
+
+		n, t = n+d+u, ut
+		if t != TokenTimeSpan {
+			break
+		}
+	}
+
+	// the token must end there, and not go over the next tag position of a pattern
+	if n == 0 || (nt > 0 && n > nt) {
+		return 0, TokenUnknown
+	}
+
+	if n < len(data) {
+		r := rune(data[n])
+		switch {
+		case r == '.':
+			// the end of a sentence
+			if n+1 < len(data) && data[n+1] != ' ' {
+				return 0, TokenUnknown
+			}
+		case isLiteral(r) || r == ':':
+			return 0, TokenUnknown
+		case this.state.inquote && !matchQuote(this.state.chquote, r):
+			return 0, TokenUnknown
+		}
+	}
+
+	return n, t
+}
+
+//numberLen returns the length of the number at the start of data, digits with an optional fraction.
+func numberLen(data string) int {
+	i := 0
+	for i < len(data) && isDigit(rune(data[i])) {
+		i++
+	}
+
+	if i > 0 && i+1 < len(data) && data[i] == '.' && isDigit(rune(data[i+1])) {
+		i++
+		for i < len(data) && isDigit(rune(data[i])) {
+			i++
+		}
+	}
+
+	return i
+}
+
+//quantityUnit returns the length, token type and factor of the unit at the start of data.
+func quantityUnit(data string) (int, TokenType, float64) {
+	for _, u := range quantityUnits {
+		if len(data) >= len(u.unit) && data[:len(u.unit)] == u.unit {
+			return len(u.unit), u.ttype, u.factor
+		}
+	}
+	return 0, TokenUnknown, 0
+}
+
+//quantityValue converts a quantity to seconds, bytes or a ratio. A number without a unit
+//is already in seconds or bytes, so the tags of these types can hold plain numbers.
+func quantityValue(s string, t TokenType) (float64, error) {
+	var total float64
+
+	if s == "" {
+		return 0, fmt.Errorf("Invalid %s %q", t, s)
+	}
+
+	for i := 0; i < len(s); {
+		d := numberLen(s[i:])
+		if d == 0 {
+			return 0, fmt.Errorf("Invalid %s %q", t, s)
+		}
+
+		v, err := strconv.ParseFloat(s[i:i+d], 64)
+		if err != nil {
+			return 0, fmt.Errorf("Invalid %s %q: %v", t, s, err)
+		}
+		i += d
+
+		if i == len(s) && t != TokenPercent {
+			total += v
+			break
+		}
+
+		u, ut, factor := quantityUnit(s[i:])
+		if u == 0 || ut != t {
+			return 0, fmt.Errorf("Invalid %s %q: unknown unit", t, s)
+		}
+		total += v * factor
+		i += u
+	}
+
+	return total, nil
+}
@@ -159,6 +159,8 @@ func (this *Scanner) Scan(s string, isParse bool, pos []int) (Sequence, bool, er
 					Tag:   TagUnknown,
 					Type:  TokenLiteral,
 					Value: s[this.msg.state.start : this.msg.state.start+l],
+					Start: this.msg.state.start,
+					End:   this.msg.state.start + l,
 				})
 
 				this.msg.state.inquote = false
@@ -446,10 +448,14 @@ func (this *Scanner) ScanJson(s string) (Sequence, bool, error) {
 			default:
 				if tok.Type == TokenLiteral {
 					//glog.Debugf("depth=%d, keys=%v", depth, keys)
+					// the key and "=" are not in the message, so they get an empty
+					// span at the start of the value
 					this.insertToken(Token{
 						Tag:     TagUnknown,
 						Type:    TokenLiteral,
 						Value:   keys[len(keys)-1],
+						Start:   tok.Start,
+						End:     tok.Start,
 						isKey:   true,
 						isValue: false,
 					})
@@ -458,6 +464,8 @@ func (this *Scanner) ScanJson(s string) (Sequence, bool, error) {
 						Tag:     TagUnknown,
 						Type:    TokenLiteral,
 						Value:   "=",
+						Start:   tok.Start,
+						End:     tok.Start,
 						isKey:   false,
 						isValue: false,
 					})
@@ -18,6 +18,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestScannerRequestMethods(t *testing.T) {
@@ -83,6 +84,393 @@ func TestMessageScanHexString(t *testing.T) {
 	}
 }
 
+func TestMessageScanHash(t *testing.T) {
+	msg := &Message{}
+
+	for _, tc := range hashtests {
+		msg.reset()
+		l, tok, err := msg.scanToken(tc.data, 0)
+		require.NoError(t, err, tc.data)
+		require.Equal(t, tc.result, tc.data[:l], tc.data)
+		require.Equal(t, tc.ttype, tok.Type, tc.data)
+	}
+}
+
+func TestScannerScanPath(t *testing.T) {
+	scanner := NewScanner()
+	var pos []int
+
+	for _, tc := range pathtests {
+		seq, _, err := scanner.Scan(tc.data, false, pos)
+		require.NoError(t, err, tc.data)
+
+		var paths []string
+		for _, tok := range seq {
+			if tok.Type == TokenPath {
+				paths = append(paths, tok.Value)
+			}
+		}
+		require.Equal(t, tc.paths, paths, tc.data+"\n"+seq.PrintTokens())
+	}
+}
+
+func TestScannerScanQuantity(t *testing.T) {
+	scanner := NewScanner()
+	var pos []int
+
+	for _, tc := range quantitytests {
+		seq, _, err := scanner.Scan(tc.data, false, pos)
+		require.NoError(t, err, tc.data)
+
+		var values []string
+		var typed []float64
+		for _, tok := range seq {
+			if tok.Type == tc.ttype {
+				v, err := tok.TypedValue()
+				require.NoError(t, err, tok.Value)
+				values = append(values, tok.Value)
+				typed = append(typed, v.(float64))
+			}
+		}
+		require.Equal(t, tc.values, values, tc.data+"\n"+seq.PrintTokens())
+		require.InDeltaSlice(t, tc.typed, typed, 1e-9, tc.data)
+	}
+}
+
+func TestScannerScanEpoch(t *testing.T) {
+	defer ReadConfig("sequence.toml")
+	scanner := NewScanner()
+	var pos []int
+
+	// without a window in the timesettings, no number is an epoch time stamp
+	for _, data := range []string{
+		"order id 1234567890 paid",
+		"phone 2125551234",
+		"job started at 1697612345 on port 8080",
+	} {
+		seq, _, err := scanner.Scan(data, false, pos)
+		require.NoError(t, err, data)
+		for _, tok := range seq {
+			require.NotEqual(t, TokenTime, tok.Type, data+"\n"+seq.PrintTokens())
+		}
+	}
+
+	require.NoError(t, readTestConfig("", testEpochWindow("2023-01-01", "2027-01-01")...))
+
+	// only the numbers with the digits of an epoch unit, in the window of the
+	// timesettings, are time stamps
+	for _, tc := range []struct {
+		data    string
+		special []string
+		unix    []int64
+	}{
+		{"job started at 1697612345 on port 8080", []string{"epoch"}, []int64{1697612345000000000}},
+		{"job started at 1697612345.123.", []string{"epoch"}, []int64{1697612345123000000}},
+		{"ts=1697612345123 ts2=1697612345123456", []string{"epochms", "epochus"}, []int64{1697612345123000000, 1697612345123456000}},
+		{"ts=1697612345123456789", []string{"epochns"}, []int64{1697612345123456789}},
+		{"counter at 9999999999 and 0000000001", nil, nil},
+		{"at 1697612345:12 or 1697612345abc", nil, nil},
+		{"order id 1234567890 paid", nil, nil},
+		{"phone 2125551234", nil, nil},
+	} {
+		seq, _, err := scanner.Scan(tc.data, false, pos)
+		require.NoError(t, err, tc.data)
+
+		var special []string
+		var unix []int64
+		for _, tok := range seq {
+			if tok.Type == TokenTime {
+				v, err := tok.TypedValue()
+				require.NoError(t, err, tok.Value)
+				special = append(special, tok.Special)
+				unix = append(unix, v.(time.Time).UnixNano())
+			}
+		}
+		require.Equal(t, tc.special, special, tc.data+"\n"+seq.PrintTokens())
+		require.Equal(t, tc.unix, unix, tc.data)
+	}
+}
+
+func TestScannerTimeFraction(t *testing.T) {
+	scanner := NewScanner()
+	var pos []int
+
+	// the fractional seconds are part of the time stamp whatever their number of digits
+	for _, data := range []string{
+		"2023-10-18 07:39:05.1234567 job started",
+		"2023-10-18 07:39:05,123456789 job started",
+		"2023-10-18 07:39:05.1 job started",
+	} {
+		seq, _, err := scanner.Scan(data, false, pos)
+		require.NoError(t, err, data)
+		require.Equal(t, TokenTime, seq[0].Type, data+"\n"+seq.PrintTokens())
+		require.Equal(t, data[:strings.Index(data, " job")], seq[0].Value)
+		v, err := seq[0].TypedValue()
+		require.NoError(t, err, data)
+		require.Equal(t, 39, v.(time.Time).Minute())
+		require.Equal(t, "job", seq[1].Value)
+	}
+
+	// the zone of RFC 3339 after the fractional seconds is part of the time stamp
+	for _, tc := range []struct {
+		data   string
+		offset int
+	}{
+		{"2023-10-18T07:39:05.123456789Z job started", 0},
+		{"2023-10-18T07:39:05.123Z job started", 0},
+		{"2023-10-18T07:39:05.123456+02:00 job started", 2 * 3600},
+		{"2023-10-18T07:39:05.123-05:00 job started", -5 * 3600},
+		{"2023-10-18T07:39:05.123456789+0200 job started", 2 * 3600},
+	} {
+		seq, _, err := scanner.Scan(tc.data, false, pos)
+		require.NoError(t, err, tc.data)
+		require.Equal(t, TokenTime, seq[0].Type, tc.data+"\n"+seq.PrintTokens())
+		require.Equal(t, tc.data[:strings.Index(tc.data, " job")], seq[0].Value)
+		v, err := seq[0].TypedValue()
+		require.NoError(t, err, tc.data)
+		_, offset := v.(time.Time).Zone()
+		require.Equal(t, tc.offset, offset, tc.data)
+		require.Equal(t, "job", seq[1].Value)
+	}
+
+	// a word starting with Z is not a zone
+	seq, _, err := scanner.Scan("2023-10-18T07:39:05.123456 Zulu time", false, pos)
+	require.NoError(t, err)
+	require.Equal(t, "2023-10-18T07:39:05.123456", seq[0].Value)
+	seq, _, err = scanner.Scan("2023-10-18T07:39:05.123456789Zulu time", false, pos)
+	require.NoError(t, err)
+	require.Equal(t, "2023-10-18T07:39:05.123456789", seq[0].Value)
+}
+
+func TestScannerTimeLocales(t *testing.T) {
+	defer ReadConfig("sequence.toml")
+	require.NoError(t, readTestConfig(testLocales(t)))
+	scanner := NewScanner()
+	var pos []int
+
+	// the names of the locales have other lengths, dots and accents
+	for _, tc := range []struct {
+		data, time string
+		typed      time.Time
+	}{
+		{"lun. 16 oct. 2023 07:39:05 job started", "lun. 16 oct. 2023 07:39:05", time.Date(2023, 10, 16, 7, 39, 5, 0, time.UTC)},
+		{"16 févr. 2023 07:39:05 job started", "16 févr. 2023 07:39:05", time.Date(2023, 2, 16, 7, 39, 5, 0, time.UTC)},
+		{"déc. 24 23:59:59 job started", "déc. 24 23:59:59", time.Date(0, 12, 24, 23, 59, 59, 0, time.UTC)},
+		{"Mo 16 Okt 2023 07:39:05 job started", "Mo 16 Okt 2023 07:39:05", time.Date(2023, 10, 16, 7, 39, 5, 0, time.UTC)},
+		{"Mär 16 07:39:05 job started", "Mär 16 07:39:05", time.Date(0, 3, 16, 7, 39, 5, 0, time.UTC)},
+		{"mar 14 mar 2023 07:39:05 job started", "mar 14 mar 2023 07:39:05", time.Date(2023, 3, 14, 7, 39, 5, 0, time.UTC)},
+		{"sáb 16 dic 2023 07:39:05 job started", "sáb 16 dic 2023 07:39:05", time.Date(2023, 12, 16, 7, 39, 5, 0, time.UTC)},
+	} {
+		seq, _, err := scanner.Scan(tc.data, false, pos)
+		require.NoError(t, err, tc.data)
+		require.Equal(t, TokenTime, seq[0].Type, tc.data+"\n"+seq.PrintTokens())
+		require.Equal(t, tc.time, seq[0].Value)
+		require.Equal(t, "job", seq[1].Value)
+
+		v, err := seq[0].TypedValue()
+		require.NoError(t, err, tc.data)
+		require.Equal(t, tc.typed, v)
+	}
+
+	// the words with accents are not cut
+	seq, _, err := scanner.Scan("la température dépasse 80 degrés.", false, pos)
+	require.NoError(t, err)
+	require.Equal(t, "température", seq[1].Value)
+	require.Equal(t, "degrés", seq[4].Value)
+
+	testScannerTimeWords(t, scanner)
+	require.NoError(t, ReadConfig("sequence.toml"))
+	testScannerTimeWords(t, NewScanner())
+}
+
+// testScannerTimeWords checks that the words before a time are not taken for day names, with
+// or without the locales.
+func testScannerTimeWords(t *testing.T, scanner *Scanner) {
+	for _, tc := range []struct {
+		data, time string
+	}{
+		{"job started at Mar 11 22:14:15 2023 ok", "Mar 11 22:14:15"},
+		{"backup on Oct 11 22:14:15 2023 done", "Oct 11 22:14:15"},
+		{"job run Fri Oct 13 22:14:15 2023 ok", "Fri Oct 13 22:14:15 2023"},
+	} {
+		seq, _, err := scanner.Scan(tc.data, false, nil)
+		require.NoError(t, err, tc.data)
+
+		var times []string
+		for _, tok := range seq {
+			if tok.Type == TokenTime {
+				times = append(times, tok.Value)
+				_, err := tok.TypedValue()
+				require.NoError(t, err, tok.Value)
+			}
+		}
+		require.Equal(t, []string{tc.time}, times, tc.data+"\n"+seq.PrintTokens())
+	}
+}
+
+func TestScannerCustomTokens(t *testing.T) {
+	defer ReadConfig("sequence.toml")
+	require.NoError(t, readTestConfig(customTokensConfig))
+
+	scanner := NewScanner()
+	var pos []int
+
+	for _, tc := range []struct {
+		data   string
+		tokens []string
+	}{
+		{"job job.12345.batch started, ticket INC004512 opened", []string{"jobid job.12345.batch", "ticket INC004512"}},
+		{"ticket INC0045 and INC004512.", []string{"ticket INC004512"}},
+		{"job job.12345.batch-2 and job.1.x:done", []string{"jobid job.1.x"}},
+		{"job \"job.7.gpu\" queued", []string{"jobid job.7.gpu"}},
+	} {
+		seq, _, err := scanner.Scan(tc.data, false, pos)
+		require.NoError(t, err, tc.data)
+
+		var tokens []string
+		for _, tok := range seq {
+			if tok.Type.isCustom() {
+				tokens = append(tokens, tok.Type.String()+" "+tok.Value)
+			}
+		}
+		require.Equal(t, tc.tokens, tokens, tc.data+"\n"+seq.PrintTokens())
+	}
+}
+
+func TestScannerScanLogfmt(t *testing.T) {
+	scanner := NewScanner()
+
+	// the pairs are sorted by key and the quotes are kept around the values
+	seq, isJson, err := scanner.ScanLogfmt(`level=info msg="user \"bob\" logged in" src=10.1.2.3 took=12ms empty= flag`)
+	require.NoError(t, err)
+	require.True(t, isJson)
+	pat, _ := seq.String()
+	require.Equal(t, `empty= flag level=%string% msg="%string%" src=%ipv4% took=%timespan%`, pat, seq.PrintTokens())
+	require.Equal(t, `user \"bob\" logged in`, seq[9].Value)
+
+	// the same keys in another order with other values give the same pattern
+	seq, _, err = scanner.ScanLogfmt(`flag took=3ms msg="disk full" empty= level=error src=192.168.0.1`)
+	require.NoError(t, err)
+	pat2, _ := seq.String()
+	require.Equal(t, pat, pat2)
+
+	// the messages without a key=value pair are not logfmt
+	for _, data := range []string{`msg="not closed`, `="value"`, `key="a"b`, `user bob logged in`, ``} {
+		_, _, err = scanner.ScanLogfmt(data)
+		require.Error(t, err, data)
+	}
+}
+
+func TestLogfmtPatterns(t *testing.T) {
+	scanner := NewScanner()
+	seq, _, err := scanner.ScanLogfmt(`took=12ms level=info msg="user bob"`)
+	require.NoError(t, err)
+	pat, pos := seq.String()
+	ar := AnalyzerResult{Pattern: pat, TagPositions: SplitToString(pos, ","), Examples: []LogRecord{
+		{Message: `level=error msg="disk full" took=3ms`},
+		{Message: `took=12ms level=info msg="user bob"`},
+		{Message: `level=warn msg="x" took=1ms`},
+		{Message: `not a logfmt message`}}}
+
+	// the keys go back to the orders of the examples, the pattern is kept for the sorted keys
+	require.Equal(t, []string{pat, `took=%timespan% level=%string% msg="%string%"`}, LogfmtPatterns(ar))
+
+	// the text patterns are kept as they are
+	seq, _, err = scanner.Scan("y x 12", false, nil)
+	require.NoError(t, err)
+	pat, pos = seq.String()
+	ar = AnalyzerResult{Pattern: pat, TagPositions: SplitToString(pos, ","), Examples: []LogRecord{{Message: "y x 12"}}}
+	require.Equal(t, []string{pat}, LogfmtPatterns(ar))
+}
+
+func TestScannerScanSecurityEvents(t *testing.T) {
+	scanner := NewScanner()
+
+	// the values of CEF run to the next key and the standard keys are tagged
+	seq, isJson, err := scanner.ScanCef(`Oct 11 22:14:15 fw1 CEF:0|Sec\|Corp|Threat Manager|1.0|100|Port scan|7|src=10.0.0.1 spt=1232 suser=bob act=blocked msg=Scan of 5 ports dpt=22`)
+	require.NoError(t, err)
+	require.True(t, isJson)
+	pat, _ := seq.String()
+	require.Equal(t, `%regextime:1% fw1 CEF:0|Sec\|Corp|Threat Manager|1.0|100|%string%|%severity%|src=%srcip% spt=%srcport% suser=%srcuser% act=%action% msg=%string% dpt=%dstport%`, pat, seq.PrintTokens())
+	for _, tok := range seq {
+		require.Equal(t, tok.Value, `Oct 11 22:14:15 fw1 CEF:0|Sec\|Corp|Threat Manager|1.0|100|Port scan|7|src=10.0.0.1 spt=1232 suser=bob act=blocked msg=Scan of 5 ports dpt=22`[tok.Start:tok.End])
+	}
+
+	// the pairs of LEEF are separated by tabs, or by the delimiter of the header in 2.0
+	seq, _, err = scanner.ScanLeef("LEEF:1.0|Vendor|IDS|2.1|deny|src=10.0.0.1\tsrcPort=80\tusrName=alice")
+	require.NoError(t, err)
+	pat, _ = seq.String()
+	require.Equal(t, "LEEF:1.0|Vendor|IDS|2.1|deny|src=%srcip%\tsrcPort=%srcport%\tusrName=%srcuser%", pat, seq.PrintTokens())
+
+	seq, _, err = scanner.ScanLeef("LEEF:2.0|Vendor|IDS|2.1|deny|x5E|dst=10.0.0.2^dstPort=443^note=a b")
+	require.NoError(t, err)
+	pat, _ = seq.String()
+	require.Equal(t, "LEEF:2.0|Vendor|IDS|2.1|deny|x5E|dst=%dstip%^dstPort=%dstport%^note=%string%", pat, seq.PrintTokens())
+
+	for _, data := range []string{"CEF:0|Vendor|Product|1.0", "src=10.0.0.1", "LEEF:2.0|Vendor|IDS|2.1|deny|xZZ|src=10.0.0.1"} {
+		_, _, err = scanner.ScanCef(data)
+		if strings.HasPrefix(data, "LEEF") {
+			_, _, err = scanner.ScanLeef(data)
+		}
+		require.Error(t, err, data)
+	}
+
+	require.Equal(t, LogRecord{Service: "Threat Manager", Message: "CEF:0|Sec|Threat Manager|1.0|100|Scan|7|src=10.0.0.1"},
+		parseSecurityEventRecord("CEF:0|Sec|Threat Manager|1.0|100|Scan|7|src=10.0.0.1", "cef"))
+}
+
+func TestScannerScanXml(t *testing.T) {
+	scanner := NewScanner()
+
+	data := `<?xml version="1.0"?>
+<Event xmlns="http://schemas.microsoft.com/win/2004/08/events/event">
+  <System><Provider Name="Microsoft-Windows-Security-Auditing"/><EventID>4625</EventID></System>
+  <EventData><Data Name="TargetUserName">bob smith</Data><Data Name="IpAddress">10.0.0.5</Data></EventData>
+</Event>`
+	require.True(t, testXml(data))
+
+	seq, isJson, err := ScanMessage(scanner, data, "")
+	require.NoError(t, err)
+	require.True(t, isJson)
+	pat, _ := seq.String()
+	require.Equal(t, "Event.EventData.IpAddress=%ipv4% Event.EventData.TargetUserName=%string% "+
+		"Event.System.EventID=%integer% Event.System.Provider.Name=%string%", pat, seq.PrintTokens())
+	for _, tok := range seq {
+		if tok.isValue {
+			require.Equal(t, tok.Value, data[tok.Start:tok.End])
+		}
+	}
+
+	// the order of the elements does not change the sequence, the Data elements being keyed by name
+	seq, _, err = scanner.ScanXml(`<Event><EventData><Data Name="IpAddress">10.1.1.1</Data><Data Name="TargetUserName">alice</Data></EventData>` +
+		`<System><EventID>4624</EventID><Provider Name="Microsoft-Windows-Security-Auditing"></Provider></System></Event>`)
+	require.NoError(t, err)
+	pat2, _ := seq.String()
+	require.Equal(t, pat, pat2)
+
+	// the Data elements with no name are numbered
+	seq, _, err = scanner.ScanXml(`<Event><EventData><Data>a</Data><Data>b</Data><Data Name="">c</Data></EventData></Event>`)
+	require.NoError(t, err)
+	pat, _ = seq.String()
+	require.Equal(t, "Event.EventData.Data=%string% Event.EventData.Data.1=%string% Event.EventData.Data.2=%string%", pat, seq.PrintTokens())
+
+	require.True(t, IsXmlPattern(AnalyzerResult{Examples: []LogRecord{{Message: data}}}))
+	require.False(t, IsXmlPattern(AnalyzerResult{Examples: []LogRecord{{Message: "user bob logged in"}}}))
+
+	// the texts of an element with mixed content are one value
+	data = "<a>text <b>x</b>\n  more <c/>end</a>"
+	seq, _, err = scanner.ScanXml(data)
+	require.NoError(t, err)
+	pat, _ = seq.String()
+	require.Equal(t, "a=%string% a.b=%string%", pat, seq.PrintTokens())
+	require.Equal(t, "text more end", seq[2].Value)
+	require.Equal(t, "text <b>x</b>\n  more <c/>end", data[seq[2].Start:seq[2].End])
+
+	for _, data := range []string{"<34>1 2023-10-11T22:14:15Z host app - - - msg", "<a>1</a><b>2</b>", "<a><b></a>", "<a>"} {
+		require.False(t, testXml(data), data)
+	}
+}
+
 func TestScannerSignature(t *testing.T) {
 	scanner := NewScanner()
 	var pos []int
@@ -93,6 +481,21 @@ func TestScannerSignature(t *testing.T) {
 	}
 }
 
+func TestScannerOffsets(t *testing.T) {
+	scanner := NewScanner()
+	var pos []int
+	for _, tc := range sigtests {
+		seq, _, err := scanner.Scan(tc.data, false, pos)
+		require.NoError(t, err, tc.data)
+		for _, tok := range seq {
+			if tok.Type == TokenMultiLine {
+				continue
+			}
+			require.Equal(t, tok.Value, tc.data[tok.Start:tok.End], tc.data+"\n"+seq.PrintTokens())
+		}
+	}
+}
+
 func TestScannerScan(t *testing.T) {
 	if config.markSpaces {
 		runTestCases(t, scantestsmarkspaces)
@@ -163,6 +566,8 @@ func runTestCases(t *testing.T, tests []testCase) {
 			require.FailNow(t, seq.PrintTokens())
 		} else {
 			for i, tok := range seq {
+				//offsets are checked in TestScannerOffsets
+				tok.Start, tok.End = 0, 0
 				require.Equal(t, tc.seq[i], tok, tc.data)
 			}
 		}
@@ -241,6 +646,59 @@ var (
 		{"12345:32432:3232", false},
 	}
 
+	hashtests = []struct {
+		data   string
+		result string
+		ttype  TokenType
+	}{
+		{"550e8400-e29b-41d4-a716-446655440000", "550e8400-e29b-41d4-a716-446655440000", TokenUUID},
+		{"550E8400-E29B-41D4-A716-446655440000 done", "550E8400-E29B-41D4-A716-446655440000", TokenUUID},
+		{"550e8400-e29b-41d4-a716-446655440000.", "550e8400-e29b-41d4-a716-446655440000", TokenUUID},
+		{"550e8400-e29b-41d4-a716-446655440000x", "550e8400-e29b-41d4-a716-446655440000x", TokenLiteral},
+		{"550e8400-e29b-41d4-a716-44665544000 ", "550e8400-e29b-41d4-a716-44665544000", TokenLiteral},
+		{"3f2a9c1b7e4d8a6f0b5c2e1d9a8b7c6d5e4f3a2b ", "3f2a9c1b7e4d8a6f0b5c2e1d9a8b7c6d5e4f3a2b", TokenHex},
+		{"d41d8cd98f00b204e9800998ecf8427e,", "d41d8cd98f00b204e9800998ecf8427e", TokenHex},
+		{"3f2a9c1b7e4 ", "3f2a9c1b7e4", TokenLiteral},
+		{"123456789012 ", "123456789012", TokenInteger},
+		{"deadbeefcafe ", "deadbeefcafe", TokenLiteral},
+		{"3f2a9c1b7e4d8a6fzz ", "3f2a9c1b7e4d8a6fzz", TokenLiteral},
+		{"dead:beef:1234:5678:223:32ff:feb1:2e50", "dead:beef:1234:5678:223:32ff:feb1:2e50", TokenIPv6},
+	}
+
+	pathtests = []struct {
+		data  string
+		paths []string
+	}{
+		{"open /var/lib/foo/bar.db failed", []string{"/var/lib/foo/bar.db"}},
+		{"running ./bin/run.sh and ../lib/x.so from ~/work", []string{"./bin/run.sh", "../lib/x.so", "~/work"}},
+		{"wrote /var/log/messages.", []string{"/var/log/messages"}},
+		{"file=/etc/passwd:12", []string{"/etc/passwd"}},
+		{"open /etc/passwd, then", []string{"/etc/passwd"}},
+		{"file=/etc/passwd,mode=644 ok", []string{"/etc/passwd"}},
+		{"open \"/srv/a=1,b\" failed", []string{"/srv/a=1,b"}},
+		{"open \"/var/lib/my data/file.db\" failed", []string{"/var/lib/my data/file.db"}},
+		{"open '/tmp/a b' failed", []string{"/tmp/a b"}},
+		{"cmd \"/bin/ls -l | wc\" done", nil},
+		{"route 10.0.0.0/24 via /", nil},
+		{"read and/or write // 12/24", nil},
+		{"see http://example.com/a/b", nil},
+	}
+
+	quantitytests = []struct {
+		data   string
+		ttype  TokenType
+		values []string
+		typed  []float64
+	}{
+		{"request took 153ms, retry in 2s", TokenTimeSpan, []string{"153ms", "2s"}, []float64{0.153, 2}},
+		{"session closed after 1h30m.", TokenTimeSpan, []string{"1h30m"}, []float64{5400}},
+		{"timeout 250us 1.5sec 3mins", TokenTimeSpan, []string{"250us", "1.5sec", "3mins"}, []float64{0.00025, 1.5, 180}},
+		{"received 12.5MB of 2GiB", TokenSize, []string{"12.5MB", "2GiB"}, []float64{13107200, 2147483648}},
+		{"disk usage 87% (1.5%)", TokenPercent, []string{"87%", "1.5%"}, []float64{0.87, 0.015}},
+		{"version 2s3 at 10mph", TokenTimeSpan, nil, nil},
+		{"took 5s:12 or 3msx", TokenTimeSpan, nil, nil},
+	}
+
 	tokentests = []struct {
 		data   string
 		result string
@@ -273,6 +731,10 @@ var (
 	sigtests = []struct {
 		data, sig string
 	}{
+		{
+			"request 550e8400-e29b-41d4-a716-446655440000 at commit 3f2a9c1b7e4d8a6f0b5c2e1d done",
+			"%uuid%%hex%",
+		},
 		{
 			"2.0.0",
 			"",
@@ -287,7 +749,7 @@ var (
 		},
 		{
 			"9.26.157.45 - - [16/jan/2003:21:22:59 -0500] \"get /wssamples/ http/1.1\" 200 1576",
-			"%ipv4%--[%time%]\"\"%integer%%integer%",
+			"%ipv4%--[%time%]\"%path%\"%integer%%integer%",
 		},
 		{
 			"209.36.88.3 - - [03/may/2004:01:19:07 +0000] \"get http://npkclzicp.xihudohtd.ngm.au/abramson/eiyscmeqix.ac;jsessionid=b0l0v000u0?sid=00000000&sy=afr&kw=goldman&pb=fin&dt=selectrange&dr=0month&so=relevance&st=nw&ss=afr&sf=article&rc=00&clspage=0&docid=fin0000000r0jl000d00 http/1.0\" 200 27981",
@@ -441,7 +903,7 @@ var (
 				Token{Type: TokenLiteral, Tag: TagUnknown, Value: "]"},
 				Token{Type: TokenLiteral, Tag: TagUnknown, Value: "\""},
 				Token{Type: TokenLiteral, Tag: TagUnknown, Value: "GET"},
-				Token{Type: TokenLiteral, Tag: TagUnknown, Value: "/WSsamples/"},
+				Token{Type: TokenPath, Tag: TagUnknown, Value: "/WSsamples/"},
 				Token{Type: TokenLiteral, Tag: TagUnknown, Value: "HTTP/1.1"},
 				Token{Type: TokenLiteral, Tag: TagUnknown, Value: "\""},
 				Token{Type: TokenInteger, Tag: TagUnknown, Value: "200"},
@@ -1051,7 +1513,7 @@ var (
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "]", isKey: false, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "\"", isKey: false, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "GET", isKey: false, isValue: false},
-				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "/organizations/exampleorg/data/firewall/nova_api", isKey: false, isValue: false},
+				Token{Tag: TagUnknown, Type: TokenPath, Value: "/organizations/exampleorg/data/firewall/nova_api", isKey: false, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "HTTP/1.1", isKey: false, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "\"", isKey: false, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenInteger, Value: "200", isKey: false, isValue: false},
@@ -1178,7 +1640,7 @@ var (
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "request/response", isKey: false, isValue: true},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "uri", isKey: true, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "=", isKey: false, isValue: false},
-				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "/ping", isKey: false, isValue: true},
+				Token{Tag: TagUnknown, Type: TokenPath, Value: "/ping", isKey: false, isValue: true},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "request.ssl-client-cert", isKey: true, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "=", isKey: false, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "null", isKey: false, isValue: true},
@@ -1202,7 +1664,7 @@ var (
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "null", isKey: false, isValue: true},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "request.uri", isKey: true, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "=", isKey: false, isValue: false},
-				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "/ping", isKey: false, isValue: true},
+				Token{Tag: TagUnknown, Type: TokenPath, Value: "/ping", isKey: false, isValue: true},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "request.server-name", isKey: true, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "=", isKey: false, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "xxxx.staging.strace.io", isKey: false, isValue: true},
@@ -1549,7 +2011,7 @@ var (
 				Token{Type: TokenLiteral, Tag: TagUnknown, Value: "]"},
 				Token{Type: TokenLiteral, Tag: TagUnknown, Value: "\"", IsSpaceBefore: true},
 				Token{Type: TokenLiteral, Tag: TagUnknown, Value: "GET"},
-				Token{Type: TokenLiteral, Tag: TagUnknown, Value: "/WSsamples/", IsSpaceBefore: true},
+				Token{Type: TokenPath, Tag: TagUnknown, Value: "/WSsamples/", IsSpaceBefore: true},
 				Token{Type: TokenLiteral, Tag: TagUnknown, Value: "HTTP/1.1", IsSpaceBefore: true},
 				Token{Type: TokenLiteral, Tag: TagUnknown, Value: "\""},
 				Token{Type: TokenInteger, Tag: TagUnknown, Value: "200", IsSpaceBefore: true},
@@ -2132,7 +2594,7 @@ var (
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "]", isKey: false, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "\"", isKey: false, isValue: false, IsSpaceBefore: true},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "GET", isKey: false, isValue: false},
-				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "/organizations/exampleorg/data/firewall/nova_api", isKey: false, isValue: false, IsSpaceBefore: true},
+				Token{Tag: TagUnknown, Type: TokenPath, Value: "/organizations/exampleorg/data/firewall/nova_api", isKey: false, isValue: false, IsSpaceBefore: true},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "HTTP/1.1", isKey: false, isValue: false, IsSpaceBefore: true},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "\"", isKey: false, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenInteger, Value: "200", isKey: false, isValue: false, IsSpaceBefore: true},
@@ -2273,7 +2735,7 @@ var (
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "\"", isKey: false, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: ":", isKey: false, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "\"", isKey: false, isValue: false},
-				Token{Tag: TagUnknown, Type: TokenString, Value: "/ping", isKey: false, isValue: true},
+				Token{Tag: TagUnknown, Type: TokenPath, Value: "/ping", isKey: false, isValue: true},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "\"", isKey: false, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: ",", isKey: false, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "\"", isKey: false, isValue: false},
@@ -2338,7 +2800,7 @@ var (
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "\"", isKey: false, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: ":", isKey: false, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "\"", isKey: false, isValue: false},
-				Token{Tag: TagUnknown, Type: TokenString, Value: "/ping", isKey: false, isValue: true},
+				Token{Tag: TagUnknown, Type: TokenPath, Value: "/ping", isKey: false, isValue: true},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "\"", isKey: false, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: ",", isKey: false, isValue: false},
 				Token{Tag: TagUnknown, Type: TokenLiteral, Value: "\"", isKey: false, isValue: false},
@@ -2687,3 +3149,98 @@ var (
 		},
 	}
 )
+
+func TestScannerScanEmbeddedJson(t *testing.T) {
+	scanner := NewScanner()
+
+	data := `login failed: {"user": {"name": "bob smith", "id": 1001}, "attempts": 3, "tags": ["ssh", "pam"], "reason": null}`
+	start, end := embeddedJsonSpan(data)
+	require.Equal(t, 14, start)
+	require.Equal(t, len(data), end)
+
+	seq, isJson, err := ScanMessage(scanner, data, "")
+	require.NoError(t, err)
+	require.False(t, isJson)
+	pat, pos := seq.String()
+	require.Equal(t, "login failed: %json% attempts=%integer% tags.0=%string% tags.1=%string% user.id=%integer% user.name=%string%", pat, seq.PrintTokens())
+	require.Equal(t, "%json%", pat[pos[0]:pos[0]+6])
+	for _, tok := range seq {
+		if tok.isValue {
+			require.Equal(t, tok.Value, data[tok.Start:tok.End])
+		}
+	}
+
+	// the pattern is read back and matches the message
+	parser := NewParser()
+	pseq, _, err := scanner.Scan(pat, true, pos)
+	require.NoError(t, err)
+	require.NoError(t, parser.Add(pseq))
+	seq, _, err = ScanMessage(scanner, `login failed: {"attempts": 1, "user": {"id": 42, "name": "alice"}, "tags": ["ssh", "pam"]}`, "")
+	require.NoError(t, err)
+	_, err = parser.Parse(seq)
+	require.NoError(t, err)
+
+	seq, _, err = scanner.ScanEmbeddedJson(`event=login payload={"src":"10.0.0.1"}`)
+	require.NoError(t, err)
+	pat, _ = seq.String()
+	require.Equal(t, "event=login payload=%json% src=%ipv4%", pat)
+
+	// the braces in the json strings are skipped
+	data = `msg {"a": "x} {\"y", "b": {"c": "{"}}`
+	start, end = embeddedJsonSpan(data)
+	require.Equal(t, 4, start)
+	require.Equal(t, len(data), end)
+
+	// the json is found anywhere in the message, with text after it, and the arrays are json
+	for _, tc := range []struct {
+		data, json string
+	}{
+		{`a {"x":1} b`, `{"x":1}`},
+		{`payload={"a":1} status=ok`, `{"a":1}`},
+		{"user login failed: [1,2,3]", "[1,2,3]"},
+		{`list ["a", "b"] sent`, `["a", "b"]`},
+		{`events [{"id": 1}]`, `[{"id": 1}]`},
+		{`sshd[902]: {"a": [1]} [2]`, `{"a": [1]}`},
+		{`config {} loaded {"a": 1}`, `{"a": 1}`},
+	} {
+		start, end = embeddedJsonSpan(tc.data)
+		require.True(t, start > 0, tc.data)
+		require.Equal(t, tc.json, tc.data[start:end], tc.data)
+	}
+
+	for _, data := range []string{`{"a": 1}`, "no json {here}", "list [1, 2", "sshd[902]: retries exceeded [3]", "config loaded {}",
+		`text:{"a": 1}`, `text {"a": 1`, `text {"a": 1}, more`, `list [1, 2]x`, `quote " {"a": 1`, `[]`, `empty []`} {
+		start, _ = embeddedJsonSpan(data)
+		require.Equal(t, -1, start, data)
+	}
+
+	// the text after the json follows a second marker, the exporters keep it
+	seq, _, err = ScanMessage(scanner, `user login failed: [1,2,3] from 10.0.0.1`, "")
+	require.NoError(t, err)
+	pat, pos = seq.String()
+	require.Equal(t, "user login failed: %json% json.0=%integer% json.1=%integer% json.2=%integer% %json% from %ipv4%", pat, seq.PrintTokens())
+	for _, tok := range seq {
+		if tok.isValue {
+			require.Equal(t, tok.Value, `user login failed: [1,2,3] from 10.0.0.1`[tok.Start:tok.End])
+		}
+	}
+	trimmed, ok := TrimEmbeddedJson(pat)
+	require.True(t, ok)
+	require.Equal(t, "user login failed: %json% from %ipv4%", trimmed)
+
+	parser = NewParser()
+	pseq, _, err = scanner.Scan(pat, true, pos)
+	require.NoError(t, err)
+	require.NoError(t, parser.Add(pseq))
+	seq, _, err = ScanMessage(scanner, `user login failed: [4,5,6] from 10.0.0.2`, "")
+	require.NoError(t, err)
+	_, err = parser.Parse(seq)
+	require.NoError(t, err)
+
+	// the bracketed values are scanned as text
+	seq, isJson, err = ScanMessage(scanner, "sshd[902]: retries exceeded [3]", "")
+	require.NoError(t, err)
+	require.False(t, isJson)
+	pat, _ = seq.String()
+	require.Equal(t, "sshd[%integer%]: retries exceeded [%integer%]", pat, seq.PrintTokens())
+}
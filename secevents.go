@@ -0,0 +1,245 @@
+package sequence
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//The ArcSight CEF and QRadar LEEF security events have a header of fields separated by pipes,
+//followed by the key=value pairs of the extension:
+//
+//	CEF:0|Vendor|Product|1.0|100|Port scan detected|7|src=10.0.0.1 spt=1232 act=blocked msg=Scan of 5 ports
+//	LEEF:2.0|Vendor|Product|1.0|deny|^|src=10.0.0.1^dst=10.0.0.2^usrName=bob
+//
+//The vendor, product, version and event class id of the header are literals, the name and the
+//severity are values. In the extension, the keys are literals and the values are typed tokens,
+//the values of the keys of the [analyzer.cefkeys] and [analyzer.leefkeys] sections of the config
+//are tagged, e.g. src with srcip. A value can have spaces in CEF, it ends at the next key.
+
+//ScanCef returns a Sequence, or a list of tokens, for the CEF event supplied. The syslog header
+//before the CEF: is scanned as text. The sequence is structured, so the returned bool is true.
+func (this *Scanner) ScanCef(s string) (Sequence, bool, error) {
+	start, err := this.scanEventPrefix(s, "CEF:")
+	if err != nil {
+		return nil, true, err
+	}
+
+	// version, vendor, product, device version, event class id, name, severity
+	fields, ext, ok := splitEventHeader(s, start, 7)
+	if !ok {
+		return nil, true, fmt.Errorf("Invalid message. Expecting 7 header fields separated by '|' after \"CEF:\".")
+	}
+	this.insertEventHeader(s, fields, start)
+
+	val := &Message{}
+	for _, kv := range cefPairs(s, ext) {
+		this.insertEventPair(s, kv, val, keymaps.cefkeys, s[kv[0]-1] == ' ')
+	}
+
+	return this.seq, true, nil
+}
+
+//ScanLeef returns a Sequence, or a list of tokens, for the LEEF event supplied. The pairs are
+//separated by tabs, or by the delimiter of the header in LEEF 2.0, and the delimiters are kept
+//as literals. The syslog header before the LEEF: is scanned as text. The sequence is structured,
+//so the returned bool is true.
+func (this *Scanner) ScanLeef(s string) (Sequence, bool, error) {
+	start, err := this.scanEventPrefix(s, "LEEF:")
+	if err != nil {
+		return nil, true, err
+	}
+
+	// version, vendor, product, device version, event id and the delimiter in 2.0
+	n := 5
+	if strings.HasPrefix(s[start:], "LEEF:2") {
+		n = 6
+	}
+	fields, ext, ok := splitEventHeader(s, start, n)
+	if !ok {
+		return nil, true, fmt.Errorf("Invalid message. Expecting %d header fields separated by '|' after \"LEEF:\".", n)
+	}
+	this.insertEventHeader(s, fields, start)
+
+	delim := "\t"
+	if n == 6 {
+		if d, ok := leefDelimiter(s[fields[5][0]:fields[5][1]]); ok {
+			delim = d
+		} else if fields[5][1] > fields[5][0] {
+			return nil, true, fmt.Errorf("Invalid message. Invalid LEEF delimiter %q.", s[fields[5][0]:fields[5][1]])
+		}
+	}
+
+	val := &Message{}
+	for i := ext; i < len(s); {
+		end := strings.Index(s[i:], delim)
+		if end < 0 {
+			end = len(s)
+		} else {
+			end += i
+		}
+
+		if eq := strings.IndexByte(s[i:end], '='); eq > 0 {
+			this.insertEventPair(s, [4]int{i, i + eq, i + eq + 1, end}, val, keymaps.leefkeys, false)
+		} else if end > i {
+			return nil, true, fmt.Errorf("Invalid message. Expecting key=value, got %q.", s[i:end])
+		}
+
+		if end < len(s) {
+			this.insertToken(Token{Tag: TagUnknown, Type: TokenLiteral, Value: delim, Start: end, End: end + len(delim)})
+		}
+		i = end + len(delim)
+	}
+
+	return this.seq, true, nil
+}
+
+//scanEventPrefix scans the text before the header, and returns the start of the header.
+func (this *Scanner) scanEventPrefix(s, header string) (int, error) {
+	start := strings.Index(s, header)
+	if start < 0 {
+		return 0, fmt.Errorf("Invalid message. Expecting %q.", header)
+	}
+
+	if start == 0 {
+		this.msg.Data = s
+		this.msg.reset()
+		this.seq = this.seq[:0]
+		return 0, nil
+	}
+
+	// the tokens of the prefix are the first ones of the sequence
+	if _, _, err := this.Scan(s[:start], false, nil); err != nil {
+		return 0, err
+	}
+	return start, nil
+}
+
+//splitEventHeader returns the start and end of the n fields of the header starting at start,
+//and the start of the extension. The pipes can be escaped with a backslash.
+func splitEventHeader(s string, start, n int) ([][2]int, int, bool) {
+	var fields [][2]int
+	fstart := start
+	for i := start; i < len(s) && len(fields) < n; i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '|':
+			fields = append(fields, [2]int{fstart, i})
+			fstart = i + 1
+		}
+	}
+	if len(fields) < n {
+		return nil, 0, false
+	}
+	return fields, fstart, true
+}
+
+//insertEventHeader inserts the fields of the header separated by the pipes. The vendor, product,
+//version and event id are literals, the name and severity of CEF are values.
+func (this *Scanner) insertEventHeader(s string, fields [][2]int, start int) {
+	cef := strings.HasPrefix(s[start:], "CEF:")
+	val := &Message{}
+
+	for i, f := range fields {
+		if f[1] > f[0] {
+			tok := Token{Tag: TagUnknown, Type: TokenLiteral, Value: s[f[0]:f[1]], Start: f[0], End: f[1]}
+			if i == 0 {
+				tok.IsSpaceBefore = config.markSpaces && start > 0 && s[start-1] == ' '
+			}
+			if cef && i >= 5 {
+				tok.Type = val.valueType(tok.Value)
+				tok.isValue = true
+				if i == 6 && TagSeverity.TokenType().accepts(tok.Type) {
+					tok.Tag = TagSeverity
+				}
+			}
+			this.insertToken(tok)
+		}
+		this.insertToken(Token{Tag: TagUnknown, Type: TokenLiteral, Value: "|", Start: f[1], End: f[1] + 1})
+	}
+}
+
+//insertEventPair inserts the key, = and the value of a pair of the extension, kv is the start and
+//end of the key and of the value. The value is tagged if its key is in the keys of the config.
+func (this *Scanner) insertEventPair(s string, kv [4]int, val *Message, keys map[string]TagType, space bool) {
+	key := s[kv[0]:kv[1]]
+	this.insertToken(Token{Tag: TagUnknown, Type: TokenLiteral, Value: key, Start: kv[0], End: kv[1], isKey: true, IsSpaceBefore: config.markSpaces && space})
+	this.insertToken(Token{Tag: TagUnknown, Type: TokenLiteral, Value: "=", Start: kv[1], End: kv[1] + 1})
+
+	if kv[3] > kv[2] {
+		tok := Token{Tag: TagUnknown, Type: val.valueType(s[kv[2]:kv[3]]), Value: s[kv[2]:kv[3]], Start: kv[2], End: kv[3], isValue: true}
+		if tag, ok := keys[key]; ok && tag.TokenType().accepts(tok.Type) {
+			tok.Tag = tag
+		}
+		this.insertToken(tok)
+	}
+}
+
+//cefPairs returns the start and end of the keys and values of a CEF extension. A key is a word
+//followed by an unescaped =, its value ends before the spaces of the next key.
+func cefPairs(s string, ext int) [][4]int {
+	var pairs [][4]int
+	for i := ext; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '=':
+			k := i
+			for k > ext && isCefKeyChar(s[k-1]) {
+				k--
+			}
+			if k == i || (k > ext && s[k-1] != ' ') {
+				continue
+			}
+			if len(pairs) > 0 {
+				pairs[len(pairs)-1][3] = len(strings.TrimRight(s[:k], " "))
+			}
+			pairs = append(pairs, [4]int{k, i, i + 1, len(s)})
+		}
+	}
+	if len(pairs) > 0 {
+		pairs[len(pairs)-1][3] = len(strings.TrimRight(s, " \r\n"))
+	}
+	for i := range pairs {
+		if pairs[i][3] < pairs[i][2] {
+			pairs[i][3] = pairs[i][2]
+		}
+	}
+	return pairs
+}
+
+func isCefKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '.' || c == '-' || c == '[' || c == ']'
+}
+
+//leefDelimiter returns the delimiter of the LEEF 2.0 header, a character or its hex code such
+//as x5E or 0x5E.
+func leefDelimiter(d string) (string, bool) {
+	switch {
+	case len(d) == 1:
+		return d, true
+	case strings.HasPrefix(d, "0x") || strings.HasPrefix(d, "x"):
+		c, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimPrefix(d, "0"), "x"), 16, 8)
+		if err == nil && c > 0 {
+			return string(rune(c)), true
+		}
+	}
+	return "", false
+}
+
+//parseSecurityEventRecord returns the log record of a CEF or LEEF event, the device product of the
+//header is the service and the whole line is the message, as the header is scanned with it.
+func parseSecurityEventRecord(line string, format string) LogRecord {
+	header := "CEF:"
+	if format == "leef" {
+		header = "LEEF:"
+	}
+	r := LogRecord{Service: "none", Message: line}
+	if start := strings.Index(line, header); start >= 0 {
+		if fields, _, ok := splitEventHeader(line, start, 3); ok && fields[2][1] > fields[2][0] {
+			r.Service = line[fields[2][0]:fields[2][1]]
+		}
+	}
+	return r
+}
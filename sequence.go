@@ -17,6 +17,7 @@ package sequence
 import (
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 )
 
@@ -24,7 +25,8 @@ import (
 //go:generate go fmt reqmethods.go
 
 var (
-	ErrNoMatch = errors.New("sequence: no pattern matched for this message")
+	ErrNoMatch         = errors.New("sequence: no pattern matched for this message")
+	ErrPatternNotFound = errors.New("sequence: pattern not found in the parser")
 )
 
 // Sequence represents a list of tokens returned from the scanner, analyzer or parser.
@@ -43,8 +45,8 @@ func (this Sequence) String() (string, []int) {
 		if token.Tag != TagUnknown {
 			c = token.Tag.String()
 
-			if token.Type == TokenTime && token.Tag == TagRegExTime {
-				//append the regex type
+			if token.Type == TokenTime && (token.Tag == TagRegExTime || isEpochSubtype(token.Special)) {
+				//append the regex type, or the unit of the epoch time stamps
 				c += ":" + token.Special
 			}
 			if token.until != "" {
@@ -63,10 +65,16 @@ func (this Sequence) String() (string, []int) {
 					c += ":*"
 				}
 			}
+			if token.constraint != "" {
+				c += ":" + token.constraint
+			}
 			c = "%" + c + "%"
 			pos = append(pos, start)
 		} else if token.Type != TokenUnknown && token.Type != TokenLiteral {
 			c = token.Type.String()
+			if token.Type == TokenTime && isEpochSubtype(token.Special) {
+				c += ":" + token.Special
+			}
 			if token.plus {
 				c += ":+"
 			} else if token.minus {
@@ -74,10 +82,17 @@ func (this Sequence) String() (string, []int) {
 			} else if token.star {
 				c += ":*"
 			}
+			if token.constraint != "" {
+				c += ":" + token.constraint
+			}
 			c = "%" + c + "%"
 			pos = append(pos, start)
 		} else {
 			c = token.Value
+			if c == jsonMarker {
+				//the marker of the embedded json is read back as a tag token
+				pos = append(pos, start)
+			}
 		}
 		//if the spaces are marked on the token
 		//if we need one before isSpaceBefore will be set to true
@@ -112,6 +127,74 @@ func (this Sequence) Signature() string {
 	return sig
 }
 
+// Fields returns the values of the variable tokens in the sequence, keyed by field
+// name. The field name is the tag name if the token is tagged, otherwise the token
+// type name. If rename is not nil, it is applied to each name, e.g. to use the
+// field names of an output format. Names that appear more than once are numbered,
+// starting with 1 for the second occurrence, so the values are string, string1,
+// string2 and so on. Literals and multiline tokens, whose value is truncated by
+// the scanner, are not included.
+func (this Sequence) Fields(rename func(string) string) map[string]string {
+	m := make(map[string]string)
+	this.eachField(rename, func(name string, token Token) {
+		m[name] = token.Value
+	})
+	return m
+}
+
+// Values is the same as Fields, but the values are converted according to the
+// token type: int64 for integers, float64 for floats, net.IP for IPv4 and IPv6
+// addresses, net.HardwareAddr for mac addresses and time.Time for time stamps,
+// which are parsed with the formats of the [timesettings] section of the config.
+// Other values are kept as strings. If a value cannot be converted, the field is
+// left out of the values and the error is returned for it in the second map.
+func (this Sequence) Values(rename func(string) string) (map[string]interface{}, map[string]error) {
+	var (
+		m    = make(map[string]interface{})
+		errs = make(map[string]error)
+	)
+
+	this.eachField(rename, func(name string, token Token) {
+		if v, err := token.TypedValue(); err != nil {
+			errs[name] = err
+		} else {
+			m[name] = v
+		}
+	})
+
+	return m, errs
+}
+
+// eachField calls f for each of the variable tokens with its field name, see Fields.
+func (this Sequence) eachField(rename func(string) string, f func(string, Token)) {
+	mtc := make(map[string]int)
+
+	for _, token := range this {
+		if token.Type == TokenLiteral || token.Type == TokenMultiLine {
+			continue
+		}
+
+		var name string
+		if token.Tag != TagUnknown {
+			name = token.Tag.String()
+		} else {
+			name = token.Type.String()
+		}
+
+		if rename != nil {
+			name = rename(name)
+		}
+
+		if t, ok := mtc[name]; ok {
+			f(name+strconv.Itoa(t), token)
+			mtc[name] = t + 1
+		} else {
+			f(name, token)
+			mtc[name] = 1
+		}
+	}
+}
+
 // Longstring returns a multi-line representation of the tokens in the sequence
 func (this Sequence) PrintTokens() string {
 	var str string
@@ -0,0 +1,216 @@
+package sequence
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+//The rfc3164 and rfc5424 input formats read the raw syslog lines, the app-name or tag of the
+//header is the service and the rest of the line is the message:
+//
+//	<34>Oct 11 22:14:15 mymachine su[230]: 'su root' failed for lonvick on /dev/pts/8
+//	<34>1 2003-10-11T22:14:15.003Z mymachine su 230 ID47 [exampleSDID@32473 iut="3"] 'su root' failed
+//
+//The header fields are kept in the log record with the examples. A line without a valid header
+//has the service none and is kept whole as the message.
+
+//parseSyslogRecord returns the log record of a syslog line in the rfc3164 or rfc5424 format.
+func parseSyslogRecord(line string, format string) LogRecord {
+	var (
+		r  LogRecord
+		ok bool
+	)
+	if format == "rfc5424" {
+		r, ok = parseRfc5424(line)
+	} else {
+		r, ok = parseRfc3164(line)
+	}
+	if !ok || r.Service == "" {
+		return LogRecord{Service: "none", Message: line}
+	}
+	return r
+}
+
+//parsePriority returns the <PRI> at the start of the line and the rest of the line.
+func parsePriority(line string) (string, string, bool) {
+	if len(line) < 3 || line[0] != '<' {
+		return "", line, false
+	}
+	i := strings.IndexByte(line, '>')
+	if i < 2 || i > 4 {
+		return "", line, false
+	}
+	pri, err := strconv.Atoi(line[1:i])
+	if err != nil || pri < 0 || pri > 191 {
+		return "", line, false
+	}
+	return line[1:i], line[i+1:], true
+}
+
+//parseRfc3164 reads the BSD syslog header, the priority is optional as it is not written in
+//the log files. The time stamp can also be an RFC 3339 one, as written by rsyslog.
+func parseRfc3164(line string) (LogRecord, bool) {
+	var r LogRecord
+	r.Priority, line, _ = parsePriority(line)
+
+	if len(line) >= len(time.Stamp) {
+		if _, err := time.Parse(time.Stamp, line[:len(time.Stamp)]); err == nil {
+			r.Timestamp = line[:len(time.Stamp)]
+			line = line[len(time.Stamp):]
+		}
+	}
+	if r.Timestamp == "" {
+		var ts string
+		ts, line = nextSyslogField(line)
+		if _, err := time.Parse(time.RFC3339Nano, ts); err != nil {
+			return r, false
+		}
+		r.Timestamp = ts
+	}
+
+	r.Host, line = nextSyslogField(line)
+	if r.Host == "" {
+		return r, false
+	}
+
+	//the tag ends with a colon, with the pid between brackets before it
+	tag, rest := nextSyslogField(line)
+	if !strings.HasSuffix(tag, ":") {
+		return r, false
+	}
+	tag = tag[:len(tag)-1]
+	if i := strings.IndexByte(tag, '['); i > 0 && strings.HasSuffix(tag, "]") {
+		r.ProcId = tag[i+1 : len(tag)-1]
+		tag = tag[:i]
+	}
+	r.Service = tag
+	r.Message = rest
+
+	return r, true
+}
+
+//parseRfc5424 reads the IETF syslog header, the nil values (-) are left empty.
+func parseRfc5424(line string) (LogRecord, bool) {
+	var (
+		r   LogRecord
+		ok  bool
+		ver string
+	)
+	if r.Priority, line, ok = parsePriority(line); !ok {
+		return r, false
+	}
+	if ver, line = nextSyslogField(line); ver != "1" {
+		return r, false
+	}
+
+	var fields [5]string
+	for i := range fields {
+		fields[i], line = nextSyslogField(line)
+		if fields[i] == "" {
+			return r, false
+		}
+		if fields[i] == "-" {
+			fields[i] = ""
+		}
+	}
+	r.Timestamp, r.Host, r.Service, r.ProcId, r.MsgId = fields[0], fields[1], fields[2], fields[3], fields[4]
+
+	line = strings.TrimLeft(line, " ")
+	switch {
+	case strings.HasPrefix(line, "-"):
+		line = line[1:]
+	case strings.HasPrefix(line, "["):
+		n, ok := structuredDataLen(line)
+		if !ok {
+			return r, false
+		}
+		r.StructuredData, line = line[:n], line[n:]
+	default:
+		return r, false
+	}
+	if line != "" && line[0] != ' ' {
+		return r, false
+	}
+
+	//the message can start with the UTF-8 byte order mark
+	r.Message = strings.TrimPrefix(strings.TrimLeft(line, " "), "\uFEFF")
+
+	return r, true
+}
+
+//nextSyslogField returns the field up to the next space and the rest of the line.
+func nextSyslogField(line string) (string, string) {
+	line = strings.TrimLeft(line, " ")
+	if i := strings.IndexByte(line, ' '); i >= 0 {
+		return line[:i], line[i+1:]
+	}
+	return line, ""
+}
+
+//structuredDataLen returns the length of the STRUCTURED-DATA elements at the start of the line.
+func structuredDataLen(line string) (int, bool) {
+	i := 0
+	for i < len(line) && line[i] == '[' {
+		quoted := false
+		for i++; i < len(line); i++ {
+			if quoted && line[i] == '\\' {
+				i++
+				continue
+			}
+			if line[i] == '"' {
+				quoted = !quoted
+			} else if line[i] == ']' && !quoted {
+				break
+			}
+		}
+		if i >= len(line) {
+			return 0, false
+		}
+		i++
+	}
+	return i, true
+}
+
+//ParseStructuredData returns the parameters of the rfc5424 STRUCTURED-DATA elements, the keys
+//are the element id and the parameter name separated by a dot, e.g. exampleSDID@32473.iut.
+//The escaped ", \ and ] of the values are unescaped.
+func ParseStructuredData(sd string) map[string]string {
+	params := make(map[string]string)
+	for len(sd) > 0 && sd[0] == '[' {
+		sd = sd[1:]
+		i := strings.IndexAny(sd, " ]")
+		if i < 0 {
+			break
+		}
+		id := sd[:i]
+		sd = sd[i:]
+		for len(sd) > 0 && sd[0] == ' ' {
+			sd = strings.TrimLeft(sd, " ")
+			j := strings.Index(sd, "=\"")
+			if j < 0 {
+				return params
+			}
+			name := sd[:j]
+			sd = sd[j+2:]
+			var val strings.Builder
+			for len(sd) > 0 && sd[0] != '"' {
+				if sd[0] == '\\' && len(sd) > 1 && strings.IndexByte("\"\\]", sd[1]) >= 0 {
+					sd = sd[1:]
+				}
+				val.WriteByte(sd[0])
+				sd = sd[1:]
+			}
+			if len(sd) == 0 {
+				return params
+			}
+			params[id+"."+name] = val.String()
+			sd = sd[1:]
+		}
+		if len(sd) == 0 || sd[0] != ']' {
+			break
+		}
+		sd = sd[1:]
+	}
+	return params
+}
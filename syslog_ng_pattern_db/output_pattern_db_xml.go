@@ -154,8 +154,10 @@ func buildRuleXML(result sequence.AnalyzerResult) xRule {
 		}
 		rule.Examples.Examples = append(rule.Examples.Examples, e)
 	}
-	p.Pattern = replaceTags(result.Pattern)
-	rule.Patterns = append(rule.Patterns, p)
+	for _, pattern := range exportPatterns(result) {
+		p.Pattern = pattern
+		rule.Patterns = append(rule.Patterns, p)
+	}
 
 	//create a new UUID
 	rule.ID = result.PatternId
@@ -43,6 +43,7 @@ type yRuleExample struct {
 	Program     string            `yaml:"program"`
 	TestMessage string            `yaml:"test_message"`
 	TextValues  map[string]string `yaml:"test_values"`
+	Header      map[string]string `yaml:"header,omitempty"`
 }
 
 func saveAsYaml(oFile *os.File, db yPatternDB) error {
@@ -78,7 +79,7 @@ func buildRule(result sequence.AnalyzerResult, rsName string) yRule {
 	//get the ruleset from the example (service)
 	rule.Ruleset = rsName
 	rule.RuleClass = "sequence"
-	rule.Patterns = append(rule.Patterns, replaceTags(result.Pattern))
+	rule.Patterns = append(rule.Patterns, exportPatterns(result)...)
 	for _, ex := range result.Examples {
 		m, err := extractTestValuesForTokens(ex.Message, result)
 		if err != nil {
@@ -86,7 +87,7 @@ func buildRule(result sequence.AnalyzerResult, rsName string) yRule {
 			m = make(map[string]string)
 			logger.HandleError(fmt.Sprintf("Unable to make test_values map for examples for pattern %s", result.PatternId))
 		}
-		example := yRuleExample{ex.Service, ex.Message, m}
+		example := yRuleExample{ex.Service, ex.Message, m, headerValues(ex)}
 		rule.Examples = append(rule.Examples, example)
 	}
 	rule.Values.DateCreated = result.DateCreated.Format("2006-01-02")
@@ -107,3 +108,21 @@ func buildRuleset(result sequence.AnalyzerResult, rsID string) yRuleset {
 	rs.ID = rsID
 	return rs
 }
+
+//headerValues returns the syslog header fields of the example, with the parameters of the
+//structured data named as the .SDATA values of syslog-ng, or nil if it has none.
+func headerValues(ex sequence.LogRecord) map[string]string {
+	m := make(map[string]string)
+	for k, v := range map[string]string{"priority": ex.Priority, "timestamp": ex.Timestamp, "host": ex.Host, "procid": ex.ProcId, "msgid": ex.MsgId} {
+		if v != "" {
+			m[k] = v
+		}
+	}
+	for k, v := range ex.Params() {
+		m[".SDATA."+k] = v
+	}
+	if len(m) == 0 {
+		return nil
+	}
+	return m
+}
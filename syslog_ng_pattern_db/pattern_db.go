@@ -11,6 +11,7 @@ import (
 	"gitlab.in2p3.fr/cc-in2p3-system/sequence"
 	"index/suffixarray"
 	"os"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
@@ -24,8 +25,20 @@ var (
 		cfield  map[string]string
 	}
 	logger *sequence.StandardLogger
+
+	//a tag token with a /regex/ or {value|value} constraint
+	constraintTag = regexp.MustCompile(`%[A-Za-z0-9_]+(?::[A-Za-z0-9_+*-]*)*:(?:/.*?/|\{[^}]*\})%`)
+
+	//a tag or token type token, that can be a custom token type of the config
+	plainTag = regexp.MustCompile(`%[A-Za-z0-9_]+%`)
+
+	//a time tag or token with the unit of its epoch time stamps, e.g. %msgtime:epochms%
+	epochTag = regexp.MustCompile(`%[A-Za-z0-9_]+:epoch[a-z]*%`)
 )
 
+//the marker of the json embedded in a text message
+const jsonTag = "%json%"
+
 //Allows the user to set the logger to a global instance.
 func SetLogger(log *sequence.StandardLogger) {
 	logger = log
@@ -59,15 +72,22 @@ func replaceTags(pattern string) string {
 	if len(pattern) < 1 {
 		return pattern
 	}
+	//the json embedded in a text message is left to the json-parser
+	pattern, _ = sequence.TrimEmbeddedJson(pattern)
 	//make sure @ are escaped @@ before we start
 	pattern = strings.Replace(pattern, "@", "@@", -1)
 	//some patterns start with a space, we need to catch that
 	hasSpace := pattern[0:1] == " "
 	s := strings.Fields(pattern)
 	var new []string
+	var pcre []string
 	mtc := make(map[string]int)
 
-	for _, p := range s {
+	for i, p := range s {
+		p, mtc, pcre = replaceConstraints(p, mtc, pcre)
+		p, mtc, pcre = replaceCustomTokens(p, mtc, pcre)
+		p, mtc, pcre = replaceEpochTimes(p, mtc, pcre)
+		p, mtc, pcre = replaceEmbeddedJson(p, mtc, pcre, i == len(s)-1)
 		if val, ok := tags.general[p]; ok {
 			p, mtc = getUpdatedTag(p, mtc, val, "")
 		} else {
@@ -101,9 +121,78 @@ func replaceTags(pattern string) string {
 		result = " " + result
 	}
 
+	for i, r := range pcre {
+		result = strings.Replace(result, constraintPlaceholder(i), r, 1)
+	}
+
 	return result
 }
 
+//the tags with a constraint are replaced by a PCRE parser matching the same values
+//a placeholder is put in the pattern so the regex is not changed by the other replacements
+func replaceConstraints(p string, mtc map[string]int, pcre []string) (string, map[string]int, []string) {
+	for _, m := range constraintTag.FindAllString(p, -1) {
+		tag, re, ok := sequence.TagConstraintRegex(m)
+		if !ok {
+			continue
+		}
+		//the @ in the regex have already been escaped
+		var val string
+		val, mtc = getUpdatedTag("%"+strings.Split(tag[1:len(tag)-1], ":")[0]+"%", mtc, "@PCRE:[fieldname]:"+re+"@", "")
+		p = strings.Replace(p, m, constraintPlaceholder(len(pcre)), 1)
+		pcre = append(pcre, val)
+	}
+	return p, mtc, pcre
+}
+
+//the custom token types of the config are replaced by a PCRE parser with their regex
+func replaceCustomTokens(p string, mtc map[string]int, pcre []string) (string, map[string]int, []string) {
+	for _, m := range plainTag.FindAllString(p, -1) {
+		re, ok := sequence.GetCustomTokenRegex(m[1 : len(m)-1])
+		if !ok {
+			continue
+		}
+		var val string
+		val, mtc = getUpdatedTag(m, mtc, "@PCRE:[fieldname]:"+strings.Replace(re, "@", "@@", -1)+"@", "")
+		p = strings.Replace(p, m, constraintPlaceholder(len(pcre)), 1)
+		pcre = append(pcre, val)
+	}
+	return p, mtc, pcre
+}
+
+//the epoch time stamps are replaced by a PCRE parser with the regex of their unit in the timesettings
+func replaceEpochTimes(p string, mtc map[string]int, pcre []string) (string, map[string]int, []string) {
+	for _, m := range epochTag.FindAllString(p, -1) {
+		i := strings.Index(m, ":")
+		re, ok := sequence.GetTimeSettingsRegExValue(m[i+1 : len(m)-1])
+		if !ok || re == "" {
+			continue
+		}
+		var val string
+		val, mtc = getUpdatedTag(m[:i]+"%", mtc, "@PCRE:[fieldname]:"+strings.Replace(re, "@", "@@", -1)+"@", "")
+		p = strings.Replace(p, m, constraintPlaceholder(len(pcre)), 1)
+		pcre = append(pcre, val)
+	}
+	return p, mtc, pcre
+}
+
+//the json followed by text can not be matched by the ANYSTRING of the config, it is replaced by
+//a PCRE parser matching up to the last bracket before the text
+func replaceEmbeddedJson(p string, mtc map[string]int, pcre []string, last bool) (string, map[string]int, []string) {
+	i := strings.Index(p, jsonTag)
+	if i < 0 || last {
+		return p, mtc, pcre
+	}
+	var val string
+	val, mtc = getUpdatedTag(jsonTag, mtc, `@PCRE:[fieldname]:[\[{].*[\]}]@`, "")
+	p = p[:i] + constraintPlaceholder(len(pcre)) + p[i+len(jsonTag):]
+	return p, mtc, append(pcre, val)
+}
+
+func constraintPlaceholder(i int) string {
+	return "\x00" + strconv.Itoa(i) + "\x00"
+}
+
 func getUpdatedTag(p string, mtc map[string]int, tag string, del string) (string, map[string]int) {
 	tok := ""
 	xchars := len(del)
@@ -196,7 +285,8 @@ func getWithDelimiters(p string, start, end int, last int) (string, string, stri
 	fieldname := p[start+1 : end-1]
 	before := ""
 	//integer and ip fields are not considered strings so can bypass this
-	if fieldname == "integer" || fieldname == "srcip" || fieldname == "dstip" || fieldname == "float" || fieldname == "ipv6" || fieldname == "srcmac" || fieldname == "dstmac" {
+	if fieldname == "integer" || fieldname == "srcip" || fieldname == "dstip" || fieldname == "float" || fieldname == "ipv6" || fieldname == "srcmac" || fieldname == "dstmac" || fieldname == "uuid" || fieldname == "hex" ||
+		fieldname == "timespan" || fieldname == "size" || fieldname == "percent" || fieldname == "host" || fieldname == "email" {
 		return p[start:end], "", fieldname, end - 1
 	}
 	if start > 0 && end < len(p) {
@@ -250,6 +340,7 @@ func OutputToFiles(outformat string, outfile string, config string, complexityle
 		count    int
 		top5     string
 		patmap   map[string]sequence.AnalyzerResult
+		jsonIds  []string
 	)
 
 	if config == "" {
@@ -318,19 +409,31 @@ func OutputToFiles(outformat string, outfile string, config string, complexityle
 		}
 	}
 	//add the patterns and examples
+	skipped := 0
 	for _, result := range patmap {
+		if _, ok := sequence.TrimEmbeddedJson(result.Pattern); ok {
+			jsonIds = append(jsonIds, result.PatternId)
+		}
+		//the keys of the xml patterns are the paths of the elements, which are not in the messages
+		isXml := sequence.IsXmlPattern(result)
+		if isXml {
+			skipped++
+		}
 		for _, fmat := range outformats {
 			if fmat == "" || fmat == "txt" {
 				fmt.Fprintf(txtFile, "# %s\n %s\n# %d log messages matched\n# %s\n\n", result.PatternId, result.Pattern, result.ExampleCount, result.Examples[0].Message)
 			}
-			if fmat == "yaml" {
+			if fmat == "yaml" && !isXml {
 				yPattDB = addToYaml(result, yPattDB)
 			}
-			if fmat == "xml" {
+			if fmat == "xml" && !isXml {
 				xPattDB = addToRuleset(result, xPattDB)
 			}
 		}
 	}
+	if skipped > 0 {
+		logger.HandleInfo(fmt.Sprintf("Skipped %d patterns of XML messages in the patterndb output", skipped))
+	}
 
 	//finalise the files
 	for _, fmat := range outformats {
@@ -348,46 +451,70 @@ func OutputToFiles(outformat string, outfile string, config string, complexityle
 		}
 	}
 
+	//the json embedded in the text messages is parsed after the patterndb
+	if len(jsonIds) > 0 {
+		fname = ""
+		if outfile != "" {
+			fname = outfile + "_json.conf"
+		}
+		jsonFile, err := sequence.OpenOutputFile(fname)
+		if err != nil {
+			return count, top5, err
+		}
+		defer jsonFile.Close()
+		fmt.Fprint(jsonFile, jsonParser(jsonIds))
+	}
+
 	return count, top5, err
 }
 
+//jsonParser returns the syslog-ng config of the json-parser for the json captured in the
+//messages matched by the patterns, with a filter on their rule ids. They are added to the log path
+//after the patterndb parser:
+//	log { source(s_local); parser(p_patterndb); if { filter(f_sequence_json); parser(p_sequence_json); }; destination(d_local); };
+func jsonParser(patternIds []string) string {
+	field := checkForCustomFieldName("json")
+	sort.Strings(patternIds)
+	return fmt.Sprintf("filter f_sequence_json {\n    match(\"^(%s)$\" value(\".classifier.rule_id\") type(pcre));\n};\n"+
+		"parser p_sequence_json {\n    json-parser(template(\"${%s}\") prefix(\"%s.\"));\n};\n", strings.Join(patternIds, "|"), field, field)
+}
+
+//exportPatterns returns the patterns of the result with the tags replaced, the logfmt patterns are
+//written in the key orders of their examples, as the keys are sorted in the pattern.
+func exportPatterns(result sequence.AnalyzerResult) []string {
+	patterns := sequence.LogfmtPatterns(result)
+	if len(patterns) == 0 {
+		patterns = []string{result.Pattern}
+	}
+	for i, p := range patterns {
+		patterns[i] = replaceTags(p)
+	}
+	return patterns
+}
+
 //This function extracts the values of the tokens for the test examples
 func extractTestValuesForTokens(message string, ar sequence.AnalyzerResult) (map[string]string, error) {
-	var (
-		tok string
-	)
 	scanner := sequence.NewScanner()
 	parser := sequence.NewParser()
-	m := make(map[string]string)
 	//no tags to find
 	if ar.TagPositions == "" {
-		return m, nil
+		return make(map[string]string), nil
 	}
 	pos := sequence.SplitToInt(ar.TagPositions, ",")
 	//scan the pattern
 	seq, _, err := scanner.Scan(ar.Pattern, true, pos)
 	//add to the parser
-	err = parser.Add(seq)
+	err = parser.AddPattern(seq, ar.PatternId)
 	//scan the example
 	mseq, _, _ := sequence.ScanMessage(scanner, message, "")
-	//parse the example
-	pseq, err := parser.Parse(mseq)
-	mtc := make(map[string]int)
-	for _, p := range pseq {
-		if p.Type != sequence.TokenLiteral && p.Type != sequence.TokenMultiLine {
-			if p.Tag == 0 {
-				tok = checkForCustomFieldName(p.Type.String())
-			} else {
-				tok = checkForCustomFieldName(p.Tag.String())
-			}
-			if t, ok := mtc[tok]; ok {
-				m[tok+strconv.Itoa(t)] = p.Value
-				mtc[tok] = t + 1
-			} else {
-				m[tok] = p.Value
-				mtc[tok] = 1
+	//parse the example, the logfmt patterns match the example with its keys sorted
+	pr, err := parser.ParseWithResult(mseq)
+	if err != nil {
+		if mseq, _, serr := sequence.ScanMessage(scanner, message, "logfmt"); serr == nil {
+			if lpr, lerr := parser.ParseWithResult(mseq); lerr == nil {
+				pr, err = lpr, nil
 			}
 		}
 	}
-	return m, err
+	return pr.Sequence.Fields(checkForCustomFieldName), err
 }
@@ -3,6 +3,9 @@ package syslog_ng_pattern_db
 import (
 	"github.com/stretchr/testify/require"
 	"gitlab.in2p3.fr/cc-in2p3-system/sequence"
+	"io/ioutil"
+	"os"
+	"strings"
 	"testing"
 )
 
@@ -22,9 +25,27 @@ var (
 		{"%integer% ", "@NUMBER:integer@"},
 		{"%string%,%string%", "@ESTRING:string:,@@ESTRING:string1:@"},
 		{"%srcmac%", "@MACADDR:srcmac@"},
+		{"id=%uuid% ", "id=@PCRE:uuid:[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}@"},
+		{"%hex%,", "@PCRE:hex:[0-9a-fA-F]+@,"},
+		{"open %path% ", "open @ESTRING:path:@"},
+		{"open \"%path%\"", "open @QSTRING:path:\"@"},
+		{"took %timespan% ", "took @PCRE:timespan:(?:[0-9]+(?:\\.[0-9]+)?[a-zµ]+)+@"},
+		{"read %size%,", "read @PCRE:size:[0-9]+(?:\\.[0-9]+)?[a-zA-Z]+@,"},
+		{"usage %percent% ", "usage @PCRE:percent:[0-9]+(?:\\.[0-9]+)?%@"},
+		{"from %host% ", "from @HOSTNAME:host:@"},
+		{"to <%email%>", "to <@EMAIL:email:@>"},
 		{"%dsthost% ", "@HOSTNAME:dsthost:@"},
 		{"<%string%>,", "@QSTRING:string:<>@,"},
 		{"\"%object%\"", "@QSTRING:object:\"@"},
+		{"at %msgtime:epochms% ", "at @PCRE:timestamp:[0-9]{13}@"},
+		{"%time:epoch%,", "@PCRE:time:[0-9]{10}(?:\\.[0-9]+)?@,"},
+		{"%status:string:/^(ok|fail)$/% ", "@PCRE:status:(?:(ok|fail))@"},
+		{"status=%status:/^(ok|fail)$/%,", "status=@PCRE:status:(?:(ok|fail))@,"},
+		{"%action:{allow|deny}% %action:{a.b|c@d}%", "@PCRE:action:(?:allow|deny)@ @PCRE:action1:(?:a\\.b|c@@d)@"},
+		{"login failed: %json% attempts=%integer% user=%string%", "login failed: @ANYSTRING:json@"},
+		{"event=%string% payload=%json% user.name=%string%", "event=@ESTRING:string: @payload=@ANYSTRING:json@"},
+		{"login failed: %json% json.0=%integer% %json% from %srcip%", "login failed: @PCRE:json:[\\[{].*[\\]}]@ from @IPvANY:srcip@"},
+		{"a=%json% x=%integer% %json% b", "a=@PCRE:json:[\\[{].*[\\]}]@ b"},
 	}
 )
 
@@ -34,6 +55,32 @@ func loadConfigs() {
 	sequence.ReadConfig(file)
 }
 
+// readTestConfig reads ../sequence.toml with the sections added, in the sequence
+// package and here, the callers call loadConfigs when they are done.
+func readTestConfig(sections string) error {
+	data, err := ioutil.ReadFile("../sequence.toml")
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile("", "sequence*.toml")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString(string(data) + "\n" + sections)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err := sequence.ReadConfig(f.Name()); err != nil {
+		return err
+	}
+	return readConfig(f.Name())
+}
+
 func TestTagTransformation(t *testing.T) {
 	loadConfigs()
 	for _, tc := range tagtests {
@@ -41,3 +88,65 @@ func TestTagTransformation(t *testing.T) {
 		require.Equal(t, tc.result, tag, tc.data)
 	}
 }
+
+func TestCustomTokenTransformation(t *testing.T) {
+	defer loadConfigs()
+	require.NoError(t, readTestConfig("[tokens.custom.jobid]\nregex = 'job\\.[0-9]+\\.[a-z]+'\n"))
+
+	for _, tc := range []struct {
+		data   string
+		result string
+	}{
+		{"job %jobid% started", "job @PCRE:jobid:job\\.[0-9]+\\.[a-z]+@ started"},
+		{"%jobid%,%jobid%", "@PCRE:jobid:job\\.[0-9]+\\.[a-z]+@,@PCRE:jobid1:job\\.[0-9]+\\.[a-z]+@"},
+	} {
+		tag := replaceTags(tc.data)
+		require.Equal(t, tc.result, tag, tc.data)
+	}
+}
+
+func TestTimeLocaleTransformation(t *testing.T) {
+	loadConfigs()
+	tag := replaceTags("%regextime:7% job")
+	require.Contains(t, tag, "|january|")
+	require.NotContains(t, tag, "|févr\\.|")
+
+	// the locales are commented out in sequence.toml
+	locales, err := ioutil.ReadFile("../testdata/locales.toml")
+	require.NoError(t, err)
+	defer loadConfigs()
+	require.NoError(t, readTestConfig(string(locales)))
+
+	tag = replaceTags("%regextime:7% job")
+	require.True(t, strings.HasPrefix(tag, "@PCRE:timestamp:\\b(?:0?[1-9]|1[0-9]|2[0-9]|3[0-1])\\s(?i:"), tag)
+	require.Contains(t, tag, "|févr\\.|")
+	require.True(t, strings.HasSuffix(tag, "@ job"), tag)
+}
+
+func TestJsonParser(t *testing.T) {
+	loadConfigs()
+
+	conf := jsonParser([]string{"id2", "id1"})
+	require.Contains(t, conf, `match("^(id1|id2)$" value(".classifier.rule_id") type(pcre));`)
+	require.Contains(t, conf, `json-parser(template("${json}") prefix("json."));`)
+}
+
+func TestHeaderValues(t *testing.T) {
+	ex := sequence.LogRecord{Service: "app", Message: "'su root' failed", Priority: "34", Host: "host", ProcId: "123",
+		StructuredData: `[exampleSDID@32473 iut="3"][meta seq="1"]`}
+	require.Equal(t, map[string]string{"priority": "34", "host": "host", "procid": "123", ".SDATA.exampleSDID@32473.iut": "3", ".SDATA.meta.seq": "1"}, headerValues(ex))
+	require.Nil(t, headerValues(sequence.LogRecord{Service: "app", Message: "m"}))
+}
+
+func TestExportLogfmtPatterns(t *testing.T) {
+	loadConfigs()
+	ar := sequence.AnalyzerResult{PatternId: "id1", Pattern: "level=%string% took=%timespan%", TagPositions: "6,20",
+		Examples: []sequence.LogRecord{{Message: "level=info took=3ms"}, {Message: "took=12ms level=error"}}}
+	require.Equal(t, []string{"level=@ESTRING:string: @took=@PCRE:timespan:(?:[0-9]+(?:\\.[0-9]+)?[a-zµ]+)+@",
+		"took=@PCRE:timespan:(?:[0-9]+(?:\\.[0-9]+)?[a-zµ]+)+@ level=@ESTRING:string:@"}, exportPatterns(ar))
+
+	// the values of the examples in another order are found with the keys sorted
+	m, err := extractTestValuesForTokens("took=12ms level=error", ar)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"string": "error", "timespan": "12ms"}, m)
+}
@@ -15,7 +15,12 @@
 package sequence
 
 import (
+	"fmt"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
 )
 
 type timeNode struct {
@@ -41,52 +46,293 @@ const (
 var (
 	timeFsmRoot   *timeNode
 	minTimeLength int = 1000
+
+	// timeLayouts are the time formats of the config, in the order of their ids
+	timeLayouts []string
+
+	// epochUnits are the epoch time stamps, the subtype of their tokens gives the
+	// unit of the number. Only the seconds can have a fraction, e.g. 1697612345.123
+	epochUnits = []struct {
+		subtype string
+		digits  int
+		unit    time.Duration
+	}{
+		{"epoch", 10, time.Second},
+		{"epochms", 13, time.Millisecond},
+		{"epochus", 16, time.Microsecond},
+		{"epochns", 19, time.Nanosecond},
+	}
+
+	// the fixed fractions of the formats also parse the time stamps with more or
+	// less digits, see timeFractionLen
+	fractionLayouts = strings.NewReplacer("05.000000000", "05.999999999", "05.000000", "05.999999",
+		"05.000", "05.999", "05,000", "05,999")
+
+	// the layouts of the time stamps with translated names, see timeLocale
+	shortNameLayouts = strings.NewReplacer("January", "Jan", "Monday", "Mon")
 )
 
 func buildTimeFSM(fmts map[int][]string) *timeNode {
 	root := &timeNode{ntype: timeNodeRoot}
 
 	for i, fm := range fmts {
-		f := fm[0]
-		f = strings.ToLower(f)
-		if len(f) < minTimeLength {
-			minTimeLength = len(f)
-		}
-
-		parent := root
-
-		for _, r := range f {
-			t := tnType(r)
-
-			hasChild := false
-			var child *timeNode
-
-			for _, child = range parent.children {
-				if (child.ntype == t && (t != timeNodeLiteral || (t == timeNodeLiteral && child.value == r))) ||
-					(child.ntype == timeNodeDigitOrSpace && (t == timeNodeDigit || t == timeNodeSpace)) {
-					hasChild = true
-					break
-				} else if child.ntype == timeNodeDigit && t == timeNodeDigitOrSpace {
-					child.ntype = timeNodeDigitOrSpace
-					hasChild = true
-					break
-				}
+		addTimeFormat(root, fm[0], i, fm[1])
+
+		// the names of the locales can have other lengths, dots or accents
+		for _, f := range localeTimeFormats(fm[0]) {
+			addTimeFormat(root, f, i, fm[1])
+		}
+	}
+
+	return root
+}
+
+func addTimeFormat(root *timeNode, f string, subtype int, regextype string) {
+	f = strings.ToLower(f)
+	if len(f) < minTimeLength {
+		minTimeLength = len(f)
+	}
+
+	parent := root
+
+	for _, r := range f {
+		t := tnType(r)
+
+		hasChild := false
+		var child *timeNode
+
+		for _, child = range parent.children {
+			if (child.ntype == t && (t != timeNodeLiteral || (t == timeNodeLiteral && child.value == r))) ||
+				(child.ntype == timeNodeDigitOrSpace && (t == timeNodeDigit || t == timeNodeSpace)) {
+				hasChild = true
+				break
+			} else if child.ntype == timeNodeDigit && t == timeNodeDigitOrSpace {
+				child.ntype = timeNodeDigitOrSpace
+				hasChild = true
+				break
+			}
+		}
+
+		if !hasChild {
+			child = &timeNode{ntype: t, value: r}
+			parent.children = append(parent.children, child)
+		}
+
+		parent = child
+	}
+
+	parent.final = TokenTime
+	parent.subtype = subtype
+	parent.regextype = regextype
+}
+
+func buildTimeLayouts(fmts map[int][]string) []string {
+	ids := make([]int, 0, len(fmts))
+	for i := range fmts {
+		ids = append(ids, i)
+	}
+	sort.Ints(ids)
+
+	layouts := make([]string, 0, len(ids))
+	for _, i := range ids {
+		layouts = append(layouts, fractionLayouts.Replace(fmts[i][0]))
+	}
+
+	return layouts
+}
+
+// parseTime converts a time stamp using the first time format of the config that
+// matches it, in English or in one of the locales, or as an epoch time stamp.
+// Formats without a year give a time in year 0, as time.Parse does.
+func parseTime(s string) (time.Time, error) {
+	for _, l := range timeLayouts {
+		if t, err := time.Parse(l, s); err == nil {
+			return t, nil
+		}
+	}
+
+	if t, _, ok := parseEpoch(s); ok {
+		return t, nil
+	}
+
+	// the names of the locales are translated, the layouts then only have the
+	// short English names
+	for _, loc := range timeLocales {
+		ls, ok := loc.translate(s)
+		if !ok {
+			continue
+		}
+		for _, l := range timeLayouts {
+			if t, err := time.Parse(shortNameLayouts.Replace(l), ls); err == nil {
+				return t, nil
+			}
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("Invalid time %q: no matching format in the timesettings", s)
+}
+
+// parseEpoch converts an epoch time stamp in seconds, milliseconds, microseconds or
+// nanoseconds, given by its number of digits, and returns its subtype.
+func parseEpoch(s string) (time.Time, string, bool) {
+	i := 0
+	for i < len(s) && isDigit(rune(s[i])) {
+		i++
+	}
+
+	var nsec int64
+	if frac := s[i:]; frac != "" {
+		if i != 10 || len(frac) < 2 || len(frac) > 10 || frac[0] != '.' {
+			return time.Time{}, "", false
+		}
+		for _, r := range frac[1:] {
+			if !isDigit(r) {
+				return time.Time{}, "", false
 			}
+		}
+		nsec, _ = strconv.ParseInt(frac[1:]+strings.Repeat("0", 10-len(frac)), 10, 64)
+	}
+
+	for _, u := range epochUnits {
+		if u.digits != i {
+			continue
+		}
+		n, err := strconv.ParseInt(s[:i], 10, 64)
+		if err != nil {
+			return time.Time{}, "", false
+		}
+		perSec := int64(time.Second / u.unit)
+		return time.Unix(n/perSec, n%perSec*int64(u.unit)+nsec).UTC(), u.subtype, true
+	}
+
+	return time.Time{}, "", false
+}
 
-			if !hasChild {
-				child = &timeNode{ntype: t, value: r}
-				parent.children = append(parent.children, child)
+// isEpochSubtype returns true if s is the subtype of an epoch time stamp token.
+func isEpochSubtype(s string) bool {
+	for _, u := range epochUnits {
+		if u.subtype == s {
+			return true
+		}
+	}
+	return false
+}
+
+// scanEpoch returns the length and subtype of the epoch time stamp at the start of
+// data, or 0 if there is none. The time must be within the plausibility window of
+// the timesettings, so the other numbers with as many digits are not times, and
+// there is none when the window is not set.
+func (this *Message) scanEpoch(data string, nt int) (int, string) {
+	if timesettings.epochTo == 0 {
+		return 0, ""
+	}
+
+	n := numberLen(data)
+	if n < 10 || (nt > 0 && n > nt) {
+		return 0, ""
+	}
+
+	if n < len(data) {
+		r := rune(data[n])
+		switch {
+		case r == '.':
+			// the end of a sentence
+			if n+1 < len(data) && data[n+1] != ' ' {
+				return 0, ""
 			}
+		case isLiteral(r) || r == ':':
+			return 0, ""
+		}
+	}
+
+	t, subtype, ok := parseEpoch(data[:n])
+	if !ok || t.Unix() < timesettings.epochFrom || t.Unix() >= timesettings.epochTo {
+		return 0, ""
+	}
+
+	return n, subtype
+}
 
-			parent = child
+// timeFractionLen returns the length of the fractional seconds that follow the time
+// stamp data[:n] found by the time FSM, as the formats of the config only have a
+// fixed number of digits. The time stamp ends with the seconds or with the first
+// digits of their fraction.
+func timeFractionLen(data string, n int) int {
+	i := n
+	for i > 0 && isDigit(rune(data[i-1])) {
+		i--
+	}
+
+	j := n
+	switch {
+	case n-i == 2 && i >= 4 && data[i-1] == ':' && data[i-4] == ':' &&
+		isDigit(rune(data[i-3])) && isDigit(rune(data[i-2])):
+		// 15:04:05 followed by .123456
+		if j+1 >= len(data) || (data[j] != '.' && data[j] != ',') || !isDigit(rune(data[j+1])) {
+			return 0
 		}
+		j++
 
-		parent.final = TokenTime
-		parent.subtype = i
-		parent.regextype = fm[1]
+	case n > i && i >= 4 && (data[i-1] == '.' || data[i-1] == ',') && data[i-4] == ':' &&
+		isDigit(rune(data[i-3])) && isDigit(rune(data[i-2])):
+		// 15:04:05.000 followed by more digits
+
+	default:
+		return 0
 	}
 
-	return root
+	for j < len(data) && isDigit(rune(data[j])) {
+		j++
+	}
+	return j - n
+}
+
+// timeSecondsEnd returns true if the time stamp ending at n ends with the seconds,
+// such as 15:04:05 or 15:04:05.123456.
+func timeSecondsEnd(data string, n int) bool {
+	i := n
+	for i > 0 && isDigit(rune(data[i-1])) {
+		i--
+	}
+	if n > i && i > 0 && (data[i-1] == '.' || data[i-1] == ',') {
+		n = i - 1
+		for i = n; i > 0 && isDigit(rune(data[i-1])); i-- {
+		}
+	}
+	return n-i == 2 && i >= 3 && data[i-1] == ':' && isDigit(rune(data[i-2])) && isDigit(rune(data[i-3]))
+}
+
+// timeZoneLen returns the length of the time zone that follows the seconds of the
+// time stamp ending at n, Z or ±hh:mm or ±hhmm as in RFC 3339, or 0 if there is none.
+func timeZoneLen(data string, n int) int {
+	if n >= len(data) || !timeSecondsEnd(data, n) {
+		return 0
+	}
+
+	switch data[n] {
+	case 'Z':
+		if n+1 < len(data) && (isLetter(rune(data[n+1])) || isDigit(rune(data[n+1]))) {
+			return 0
+		}
+		return 1
+
+	case '+', '-':
+		j := n + 1
+		for k := 0; k < 4; k++ {
+			if k == 2 && j < len(data) && data[j] == ':' {
+				j++
+			}
+			if j >= len(data) || !isDigit(rune(data[j])) {
+				return 0
+			}
+			j++
+		}
+		if j < len(data) && isDigit(rune(data[j])) {
+			return 0
+		}
+		return j - n
+	}
+	return 0
 }
 
 func tnType(r rune) int {
@@ -101,6 +347,9 @@ func tnType(r rune) int {
 		return timeNodeDigitOrSpace
 	case r == '+' || r == '-' || r == 'z' || r == 'Z':
 		return timeNodePlusOrMinus
+	case r > unicode.MaxASCII && unicode.IsLetter(r):
+		// the accents of the month and day names of the locales
+		return timeNodeLetter
 	}
 
 	return timeNodeLiteral
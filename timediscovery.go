@@ -0,0 +1,543 @@
+package sequence
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+//A TimeDiscovery finds the time stamps of the messages that are not in the formats of the
+//config. The scanner splits them into integers and literals, so the runs of date like tokens
+//are grouped by their shape, such as d2/d2/d4 d2:d2:d2, and a format is proposed for each
+//group with the regex and grok pattern of the exporters:
+//
+//	td := sequence.NewTimeDiscovery()
+//	for each unmatched message {
+//		seq, _, _ := scanner.Scan(msg, false, pos)
+//		td.Add(msg, seq)
+//	}
+//	for _, p := range td.Proposals(2) { ... }
+
+//TimeFormatProposal is a time stamp format missing from the config, with the entries of
+//[timesettings.formats], [timesettings.regex] and [timesettings.grok] that add it.
+type TimeFormatProposal struct {
+	Format   string
+	FormatId int
+	RegexId  string
+	Regex    string
+	Grok     string
+	Count    int // the number of messages with this format
+	Example  string
+}
+
+type TimeDiscovery struct {
+	groups map[string]*timeGroup
+}
+
+type timeGroup struct {
+	comps    []timeComp
+	count    int
+	examples []string
+}
+
+//a part of a time stamp, the kind is one of the timeComp constants or the separator itself
+type timeComp struct {
+	kind byte
+	n    int // the number of digits
+	full bool
+	end  int // the offset of the end of the part
+}
+
+const (
+	timeCompDigits  = 'd'
+	timeCompMonth   = 'M'
+	timeCompDay     = 'W'
+	timeCompName    = 'N' // a month or a day, such as mar in Spanish
+	timeCompAmPm    = 'P'
+	timeCompZone    = 'Z'
+	timeCompUTC     = 'z'
+	maxTimeComps    = 32
+	maxTimeExamples = 100
+)
+
+func NewTimeDiscovery() *TimeDiscovery {
+	return &TimeDiscovery{groups: make(map[string]*timeGroup)}
+}
+
+//Add looks for the time stamps of an unmatched message, seq is the sequence of the scanner
+//for the message. A message is counted once for each of its formats.
+func (this *TimeDiscovery) Add(msg string, seq Sequence) {
+	seen := make(map[string]bool)
+	end := 0
+
+	for i, tok := range seq {
+		if tok.Start < end || tok.End > len(msg) || tok.Value == "" || !timeRunStart(tok) {
+			continue
+		}
+
+		comps := lexTimeComps(msg[tok.Start:])
+		for ; len(comps) > 0; comps = comps[:len(comps)-1] {
+			if _, _, _, ok := timeLayoutOf(comps, true); ok {
+				break
+			}
+		}
+		if len(comps) == 0 {
+			continue
+		}
+		n := comps[len(comps)-1].end
+
+		// the time stamps the scanner already knows are left out
+		known := true
+		for _, t := range seq[i:] {
+			if t.Start >= tok.Start+n {
+				break
+			}
+			known = known && t.Type == TokenTime
+		}
+		end = tok.Start + n
+		if known {
+			continue
+		}
+
+		key := timeShapeKey(comps)
+		g, ok := this.groups[key]
+		if !ok {
+			g = &timeGroup{comps: comps}
+			this.groups[key] = g
+		}
+		if !seen[key] {
+			seen[key] = true
+			g.count++
+		}
+		if len(g.examples) < maxTimeExamples {
+			g.examples = append(g.examples, msg[tok.Start:end])
+		}
+	}
+}
+
+//Proposals returns the formats found in at least min messages, the most frequent first. The
+//ids follow the ones of the config, the formats already in the config are left out.
+func (this *TimeDiscovery) Proposals(min int) []TimeFormatProposal {
+	var props []TimeFormatProposal
+
+	known := make(map[string]bool)
+	formatId := 0
+	for id, fm := range timesettings.formats {
+		known[fm[0]] = true
+		if id >= formatId {
+			formatId = id + 1
+		}
+	}
+
+	for _, g := range this.groups {
+		if g.count < min {
+			continue
+		}
+
+		// the dates such as 01/02/2006 take the order the examples agree with
+		var best TimeFormatProposal
+		bestParsed := 0
+		for _, dayFirst := range []bool{true, false} {
+			layout, regex, grok, ok := timeLayoutOf(g.comps, dayFirst)
+			if !ok {
+				continue
+			}
+			parsed := 0
+			for _, ex := range g.examples {
+				if timeLayoutParses(layout, ex) {
+					parsed++
+				}
+			}
+			if parsed > bestParsed {
+				best = TimeFormatProposal{Format: layout, Regex: regex, Grok: grok, Count: g.count, Example: g.examples[0]}
+				bestParsed = parsed
+			}
+		}
+
+		if bestParsed == 0 || known[best.Format] {
+			continue
+		}
+		known[best.Format] = true
+		props = append(props, best)
+	}
+
+	sort.Slice(props, func(i, j int) bool {
+		if props[i].Count != props[j].Count {
+			return props[i].Count > props[j].Count
+		}
+		return props[i].Format < props[j].Format
+	})
+
+	regexId := 0
+	for i := range props {
+		for {
+			if _, ok := timesettings.regex[strconv.Itoa(regexId)]; !ok {
+				break
+			}
+			regexId++
+		}
+		props[i].FormatId = formatId + i
+		props[i].RegexId = strconv.Itoa(regexId)
+		regexId++
+	}
+
+	return props
+}
+
+//timeRunStart returns true if a time stamp can start with the token.
+func timeRunStart(tok Token) bool {
+	switch tok.Type {
+	case TokenInteger, TokenFloat, TokenLiteral, TokenPath, TokenTime:
+	default:
+		return false
+	}
+	r, _ := utf8.DecodeRuneInString(tok.Value)
+	return isDigit(r) || unicode.IsLetter(r)
+}
+
+//lexTimeComps returns the parts of the time stamp at the start of s, up to the first
+//character that cannot be in a time stamp.
+func lexTimeComps(s string) []timeComp {
+	var comps []timeComp
+	i := 0
+
+	for i < len(s) && len(comps) < maxTimeComps {
+		r, n := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case isDigit(r):
+			j := i
+			for j < len(s) && isDigit(rune(s[j])) {
+				j++
+			}
+			comps = append(comps, timeComp{kind: timeCompDigits, n: j - i, end: j})
+			i = j
+			continue
+
+		case unicode.IsLetter(r):
+			j := i
+			for j < len(s) {
+				r, n := utf8.DecodeRuneInString(s[j:])
+				if !unicode.IsLetter(r) {
+					break
+				}
+				j += n
+			}
+			c, l, ok := timeNameComp(s[i:j], j < len(s) && s[j] == '.')
+			if !ok {
+				return timeCompsEnd(comps)
+			}
+			i += l
+			c.end = i
+			comps = append(comps, c)
+			continue
+
+		case strings.ContainsRune(" -/.:,+", r):
+			comps = append(comps, timeComp{kind: byte(r), end: i + n})
+
+		default:
+			return timeCompsEnd(comps)
+		}
+		i += n
+	}
+
+	return timeCompsEnd(comps)
+}
+
+//timeCompsEnd resolves the names that can be a month or a day, the month is the last one.
+func timeCompsEnd(comps []timeComp) []timeComp {
+	month := -1
+	for i, c := range comps {
+		if c.kind == timeCompMonth || c.kind == timeCompName {
+			month = i
+		}
+	}
+	for i := range comps {
+		if comps[i].kind == timeCompName {
+			if i == month {
+				comps[i].kind = timeCompMonth
+			} else {
+				comps[i].kind = timeCompDay
+			}
+		}
+	}
+	return comps
+}
+
+//timeNameComp returns the part of a word of a time stamp and its length, dot tells if the word
+//is followed by a dot, as the short names of some locales end with one.
+func timeNameComp(w string, dot bool) (timeComp, int, bool) {
+	switch {
+	case w == "T":
+		return timeComp{kind: 'T'}, 1, true
+	case w == "Z":
+		return timeComp{kind: timeCompUTC}, 1, true
+	case strings.EqualFold(w, "AM") || strings.EqualFold(w, "PM"):
+		return timeComp{kind: timeCompAmPm}, 2, true
+	}
+
+	for _, d := range []bool{true, false} {
+		if d && !dot {
+			continue
+		}
+		name := strings.ToLower(w)
+		if d {
+			name += "."
+		}
+		month, fullMonth := timeNameIn(name, true)
+		day, fullDay := timeNameIn(name, false)
+		switch {
+		case month && day:
+			return timeComp{kind: timeCompName, full: fullMonth && fullDay}, len(name), true
+		case month:
+			return timeComp{kind: timeCompMonth, full: fullMonth}, len(name), true
+		case day:
+			return timeComp{kind: timeCompDay, full: fullDay}, len(name), true
+		}
+	}
+
+	if l := len(w); l >= 2 && l <= 5 && strings.ToUpper(w) == w {
+		return timeComp{kind: timeCompZone}, l, true
+	}
+	return timeComp{}, 0, false
+}
+
+//timeNameIn returns true if name is a month or day name, in English or in a locale, and if it
+//is only a full name.
+func timeNameIn(name string, month bool) (bool, bool) {
+	var short, full []string
+	if month {
+		for i := 1; i <= 12; i++ {
+			full = append(full, time.Month(i).String())
+			short = append(short, time.Month(i).String()[:3])
+		}
+	} else {
+		for i := 0; i < 7; i++ {
+			full = append(full, time.Weekday(i).String())
+			short = append(short, time.Weekday(i).String()[:3])
+		}
+	}
+	for _, loc := range timeLocales {
+		if month {
+			full, short = append(full, loc.Months...), append(short, loc.ShortMonths...)
+		} else {
+			full, short = append(full, loc.Days...), append(short, loc.ShortDays...)
+		}
+	}
+
+	for _, n := range short {
+		if strings.ToLower(n) == name {
+			return true, false
+		}
+	}
+	for _, n := range full {
+		if strings.ToLower(n) == name {
+			return true, true
+		}
+	}
+	return false, false
+}
+
+func timeShapeKey(comps []timeComp) string {
+	var b strings.Builder
+	for _, c := range comps {
+		b.WriteByte(c.kind)
+		if c.kind == timeCompDigits {
+			b.WriteString(strconv.Itoa(c.n))
+		} else if c.full {
+			b.WriteByte('+')
+		}
+	}
+	return b.String()
+}
+
+//timeLayoutOf returns the layout, regex and grok pattern of the time stamp made of comps, or
+//false if it is not a date or a time with seconds. The day of the dates such as 01/02/2006
+//comes first if dayFirst is true.
+func timeLayoutOf(comps []timeComp, dayFirst bool) (string, string, string, bool) {
+	var (
+		layout, regex, grok                    strings.Builder
+		year, month, day, hour, minute, second bool
+		ampm                                   bool
+	)
+
+	add := func(l, re, gk string) {
+		layout.WriteString(l)
+		regex.WriteString(re)
+		grok.WriteString(gk)
+	}
+	digits := func(i int, min, max int) bool {
+		return i < len(comps) && comps[i].kind == timeCompDigits && comps[i].n >= min && comps[i].n <= max
+	}
+	is := func(i int, kinds string) bool {
+		return i >= 0 && i < len(comps) && strings.IndexByte(kinds, comps[i].kind) >= 0
+	}
+	for _, c := range comps {
+		ampm = ampm || c.kind == timeCompAmPm
+	}
+
+	for i := 0; i < len(comps); i++ {
+		c := comps[i]
+		switch {
+		case c.kind == timeCompDay:
+			if c.full {
+				add("Monday", "[daynames]", "[daynames]")
+			} else {
+				add("Mon", "[daynames]", "[daynames]")
+			}
+
+		case c.kind == timeCompMonth && !month:
+			month = true
+			if c.full {
+				add("January", "[monthnames]", "[monthnames]")
+			} else {
+				add("Jan", "[monthnames]", "[monthnames]")
+			}
+
+		// 15:04:05, or 15.04.05 after a date
+		case !hour && digits(i, 1, 2) && (is(i+1, ":") || (year && is(i+1, "."))) && digits(i+2, 2, 2):
+			sep := string(comps[i+1].kind)
+			hour, minute = true, true
+			switch {
+			case ampm && c.n == 1:
+				add("3", "(?:0?[1-9]|1[0-2])", "%{HOUR}")
+			case ampm:
+				add("03", "(?:0[1-9]|1[0-2])", "%{HOUR}")
+			case c.n == 2:
+				add("15", "(?:[01][0-9]|2[0-3])", "%{HOUR}")
+			default:
+				return "", "", "", false
+			}
+			add(sep+"04", regexpQuote(sep)+"[0-5][0-9]", regexpQuote(sep)+"%{MINUTE}")
+			i += 2
+			if is(i+1, sep) && digits(i+2, 2, 2) {
+				second = true
+				add(sep+"05", regexpQuote(sep)+"(?:[0-5][0-9]|60)", regexpQuote(sep)+"%{SECOND}")
+				i += 2
+				if is(i+1, ".,") && digits(i+2, 1, 9) && sep != "." {
+					f := string(comps[i+1].kind)
+					n := strconv.Itoa(comps[i+2].n)
+					add(f+strings.Repeat("0", comps[i+2].n), regexpQuote(f)+"[0-9]{"+n+"}", regexpQuote(f)+"[0-9]{"+n+"}")
+					i += 2
+				}
+			}
+
+		// 2006-01-02
+		case !year && !month && digits(i, 4, 4) && is(i+1, "-/.") && digits(i+2, 1, 2) && is(i+3, string(comps[i+1].kind)) && digits(i+4, 1, 2):
+			sep := string(comps[i+1].kind)
+			year, month, day = true, true, true
+			add("2006", "[0-9]{4}", "%{YEAR}")
+			add(sep, regexpQuote(sep), regexpQuote(sep))
+			addMonth(add, comps[i+2].n)
+			add(sep, regexpQuote(sep), regexpQuote(sep))
+			addDay(add, comps[i+4].n)
+			i += 4
+
+		// 02/01/2006 or 01/02/2006
+		case !year && !month && digits(i, 1, 2) && is(i+1, "-/.") && digits(i+2, 1, 2) && is(i+3, string(comps[i+1].kind)) && digits(i+4, 4, 4):
+			sep := string(comps[i+1].kind)
+			year, month, day = true, true, true
+			if dayFirst {
+				addDay(add, c.n)
+				add(sep, regexpQuote(sep), regexpQuote(sep))
+				addMonth(add, comps[i+2].n)
+			} else {
+				addMonth(add, c.n)
+				add(sep, regexpQuote(sep), regexpQuote(sep))
+				addDay(add, comps[i+2].n)
+			}
+			add(sep+"2006", regexpQuote(sep)+"[0-9]{4}", regexpQuote(sep)+"%{YEAR}")
+			i += 4
+
+		// 20060102
+		case !year && !month && digits(i, 8, 8):
+			year, month, day = true, true, true
+			add("20060102", "[0-9]{8}", "%{YEAR}%{MONTHNUM}%{MONTHDAY}")
+
+		// 150405 after 20060102
+		case year && !hour && digits(i, 6, 6):
+			hour, minute, second = true, true, true
+			add("150405", "[0-9]{6}", "%{HOUR}%{MINUTE}%{SECOND}")
+
+		// the day and year of the dates with a month name
+		case !day && digits(i, 1, 2) && (is(i-1, "M") || is(i-2, "M") || is(i+1, "M") || is(i+2, "M")):
+			day = true
+			addDay(add, c.n)
+
+		case !year && month && digits(i, 4, 4):
+			year = true
+			add("2006", "[0-9]{4}", "%{YEAR}")
+
+		case hour && c.kind == timeCompAmPm:
+			add("PM", "[AP]M", "[AP]M")
+
+		case hour && c.kind == timeCompUTC:
+			add("Z", "Z", "Z")
+
+		case hour && is(i, "+-") && digits(i+1, 4, 4):
+			add("-0700", "[+-][0-9]{4}", "%{ISO8601_TIMEZONE}")
+			i++
+
+		case hour && is(i, "+-") && digits(i+1, 2, 2) && is(i+2, ":") && digits(i+3, 2, 2):
+			add("-07:00", "[+-][0-9]{2}:[0-9]{2}", "%{ISO8601_TIMEZONE}")
+			i += 3
+
+		case hour && c.kind == timeCompZone:
+			add("MST", "[A-Z]{2,5}", "[A-Z]{2,5}")
+
+		case c.kind == ' ':
+			add(" ", "\\s", " ")
+
+		case i > 0 && i < len(comps)-1 && is(i, "-/.,T"):
+			add(string(c.kind), regexpQuote(string(c.kind)), regexpQuote(string(c.kind)))
+
+		default:
+			return "", "", "", false
+		}
+	}
+
+	if len(comps) == 0 || comps[len(comps)-1].kind == ' ' || !(year && month && day || hour && minute && second) {
+		return "", "", "", false
+	}
+	return layout.String(), regex.String(), "(?<timestamp>" + grok.String() + ")", true
+}
+
+func addMonth(add func(l, re, gk string), n int) {
+	if n == 1 {
+		add("1", "(?:1[0-2]|[1-9])", "%{MONTHNUM}")
+	} else {
+		add("01", "(?:0[1-9]|1[0-2])", "%{MONTHNUM}")
+	}
+}
+
+func addDay(add func(l, re, gk string), n int) {
+	if n == 1 {
+		add("2", "(?:[12][0-9]|3[01]|[1-9])", "%{MONTHDAY}")
+	} else {
+		add("02", "(?:0[1-9]|[12][0-9]|3[01])", "%{MONTHDAY}")
+	}
+}
+
+func regexpQuote(s string) string {
+	if s == "." {
+		return "\\."
+	}
+	return s
+}
+
+//timeLayoutParses returns true if the layout parses s, with the names of the locales.
+func timeLayoutParses(layout, s string) bool {
+	if _, err := time.Parse(layout, s); err == nil {
+		return true
+	}
+	for _, loc := range timeLocales {
+		if ls, ok := loc.translate(s); ok {
+			if _, err := time.Parse(shortNameLayouts.Replace(layout), ls); err == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,321 @@
+package sequence
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+//The month and weekday names of the languages other than English are declared in the
+//[timesettings.locales] section of the config, in the order of time.Month and time.Weekday:
+//
+//	[timesettings.locales.fr]
+//	months = ["janvier", "février", "mars", ...]
+//	shortmonths = ["janv.", "févr.", "mars", ...]
+//	days = ["dimanche", "lundi", ...]
+//	shortdays = ["dim.", "lun.", ...]
+//
+//The formats with Jan, January, Mon or Monday also match the time stamps with these names, and
+//the [monthnames] and [daynames] of the time regex and grok patterns are replaced by the names
+//of all the locales.
+
+//timeLocale is the month and weekday names of a language, as read from the config. The
+//short names are the full ones if they are not given.
+type timeLocale struct {
+	Months      []string
+	ShortMonths []string
+	Days        []string
+	ShortDays   []string
+
+	name   string
+	months map[string]string // the lowercase names and their English name
+	days   map[string]string
+}
+
+var timeLocales []*timeLocale
+
+//readTimeLocales replaces the locales with the ones of the config.
+func readTimeLocales(locales map[string]*timeLocale) error {
+	timeLocales = timeLocales[:0]
+
+	names := make([]string, 0, len(locales))
+	for name := range locales {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		loc := locales[name]
+		loc.name = name
+		if len(loc.ShortMonths) == 0 {
+			loc.ShortMonths = loc.Months
+		}
+		if len(loc.ShortDays) == 0 {
+			loc.ShortDays = loc.Days
+		}
+		if len(loc.Months) != 12 || len(loc.ShortMonths) != 12 {
+			return fmt.Errorf("Error parsing time locale %q: expecting 12 months", name)
+		}
+		if len(loc.Days) != 7 || len(loc.ShortDays) != 7 {
+			return fmt.Errorf("Error parsing time locale %q: expecting 7 days, starting with sunday", name)
+		}
+
+		for _, names := range [][]string{loc.Months, loc.ShortMonths, loc.Days, loc.ShortDays} {
+			for _, n := range names {
+				if n == "" || strings.ContainsAny(n, " %") {
+					return fmt.Errorf("Error parsing time locale %q: invalid name %q", name, n)
+				}
+			}
+		}
+
+		loc.months = make(map[string]string)
+		loc.days = make(map[string]string)
+		for i := range loc.Months {
+			m := time.Month(i + 1).String()
+			loc.months[strings.ToLower(loc.ShortMonths[i])] = m[:3]
+			loc.months[strings.ToLower(loc.Months[i])] = m[:3]
+		}
+		for i := range loc.Days {
+			d := time.Weekday(i).String()
+			loc.days[strings.ToLower(loc.ShortDays[i])] = d[:3]
+			loc.days[strings.ToLower(loc.Days[i])] = d[:3]
+		}
+		timeLocales = append(timeLocales, loc)
+	}
+
+	return nil
+}
+
+//englishTimeNames is the set of the lowercase English month and weekday names, full and short.
+var englishTimeNames = func() map[string]bool {
+	names := make(map[string]bool)
+	for i := 1; i <= 12; i++ {
+		m := strings.ToLower(time.Month(i).String())
+		names[m], names[m[:3]] = true, true
+	}
+	for i := 0; i < 7; i++ {
+		d := strings.ToLower(time.Weekday(i).String())
+		names[d], names[d[:3]] = true, true
+	}
+	return names
+}()
+
+//timeNamesValid returns false if a word before the first digit of the time stamp s is not a
+//month or weekday name, in English or in one of the locales. The time FSM does not tell the
+//letters apart, so it also matches the words before a time, such as "at Mar 11 22:14:15".
+func timeNamesValid(s string) bool {
+	for i := 0; i < len(s); {
+		r, n := utf8.DecodeRuneInString(s[i:])
+		if unicode.IsDigit(r) {
+			return true
+		}
+		if !unicode.IsLetter(r) {
+			i += n
+			continue
+		}
+
+		j := i + n
+		for j < len(s) {
+			r, n := utf8.DecodeRuneInString(s[j:])
+			if !unicode.IsLetter(r) {
+				break
+			}
+			j += n
+		}
+
+		w := strings.ToLower(s[i:j])
+		ok := englishTimeNames[w]
+		for _, loc := range timeLocales {
+			if ok {
+				break
+			}
+			_, month := loc.months[w]
+			_, day := loc.days[w]
+			_, dotMonth := loc.months[w+"."]
+			_, dotDay := loc.days[w+"."]
+			ok = month || day || (j < len(s) && s[j] == '.' && (dotMonth || dotDay))
+		}
+		if !ok {
+			return false
+		}
+		i = j
+	}
+	return true
+}
+
+//localeTimeFormats returns the formats of f with the month and weekday names of the locales.
+//The names are given in the shapes seen by the time FSM, where the letters are all alike, so
+//there are few of them.
+func localeTimeFormats(f string) []string {
+	if len(timeLocales) == 0 || (!strings.Contains(f, "Jan") && !strings.Contains(f, "Mon")) {
+		return nil
+	}
+
+	fmts := []string{""}
+	for len(f) > 0 {
+		var names []string
+		switch {
+		case strings.HasPrefix(f, "January"):
+			names, f = localeNameShapes(func(loc *timeLocale) []string { return loc.Months }), f[7:]
+		case strings.HasPrefix(f, "Jan"):
+			names, f = localeNameShapes(func(loc *timeLocale) []string { return loc.ShortMonths }), f[3:]
+		case strings.HasPrefix(f, "Monday"):
+			names, f = localeNameShapes(func(loc *timeLocale) []string { return loc.Days }), f[6:]
+		case strings.HasPrefix(f, "Mon"):
+			names, f = localeNameShapes(func(loc *timeLocale) []string { return loc.ShortDays }), f[3:]
+		default:
+			_, n := utf8.DecodeRuneInString(f)
+			names, f = []string{f[:n]}, f[n:]
+		}
+
+		next := make([]string, 0, len(fmts)*len(names))
+		for _, s := range fmts {
+			for _, name := range names {
+				next = append(next, s+name)
+			}
+		}
+		fmts = next
+	}
+
+	return fmts
+}
+
+//localeNameShapes returns the shapes of the names of the locales, the letters are replaced by
+//an 'a' as the time FSM does not tell them apart.
+func localeNameShapes(names func(loc *timeLocale) []string) []string {
+	seen := make(map[string]bool)
+	var shapes []string
+	for _, loc := range timeLocales {
+		for _, n := range names(loc) {
+			shape := strings.Map(func(r rune) rune {
+				if tnType(unicode.ToLower(r)) == timeNodeLetter {
+					return 'a'
+				}
+				return unicode.ToLower(r)
+			}, n)
+			if !seen[shape] {
+				seen[shape] = true
+				shapes = append(shapes, shape)
+			}
+		}
+	}
+	return shapes
+}
+
+//expandTimeNames replaces the [monthnames] and [daynames] of a time regex or grok pattern by a
+//regex of the English names and of the names of the locales.
+func expandTimeNames(re string) string {
+	if !strings.Contains(re, "[monthnames]") && !strings.Contains(re, "[daynames]") {
+		return re
+	}
+
+	var months, days []string
+	for i := 1; i <= 12; i++ {
+		months = append(months, time.Month(i).String(), time.Month(i).String()[:3])
+	}
+	for i := 0; i < 7; i++ {
+		days = append(days, time.Weekday(i).String(), time.Weekday(i).String()[:3])
+	}
+	for _, loc := range timeLocales {
+		months = append(append(months, loc.Months...), loc.ShortMonths...)
+		days = append(append(days, loc.Days...), loc.ShortDays...)
+	}
+
+	return strings.NewReplacer("[monthnames]", namesRegex(months), "[daynames]", namesRegex(days)).Replace(re)
+}
+
+//namesRegex returns a case insensitive regex of the names, the longest names come first.
+func namesRegex(names []string) string {
+	seen := make(map[string]bool)
+	var quoted []string
+	for _, n := range names {
+		n = strings.ToLower(n)
+		if !seen[n] {
+			seen[n] = true
+			quoted = append(quoted, regexp.QuoteMeta(n))
+		}
+	}
+	sort.Slice(quoted, func(i, j int) bool {
+		if len(quoted[i]) != len(quoted[j]) {
+			return len(quoted[i]) > len(quoted[j])
+		}
+		return quoted[i] < quoted[j]
+	})
+	return "(?i:" + strings.Join(quoted, "|") + ")"
+}
+
+//translate returns the time stamp s with the names of the locale replaced by the short English
+//names, so it can be parsed with the layouts of the config. The weekday comes before the month
+//in the time stamps, so a name that is both a month and a day, such as mar in Spanish, is the
+//month if it is the last name that can be one.
+func (this *timeLocale) translate(s string) (string, bool) {
+	type name struct {
+		start, end int
+		month, day string
+		isDay      bool
+	}
+
+	var names []name
+	month := -1
+	for i := 0; i < len(s); {
+		r, n := utf8.DecodeRuneInString(s[i:])
+		if !unicode.IsLetter(r) {
+			i += n
+			continue
+		}
+
+		j := i + n
+		for j < len(s) {
+			r, n := utf8.DecodeRuneInString(s[j:])
+			if !unicode.IsLetter(r) {
+				break
+			}
+			j += n
+		}
+
+		w := strings.ToLower(s[i:j])
+		for _, end := range []int{j + 1, j} {
+			if end == j+1 && (j >= len(s) || s[j] != '.') {
+				continue
+			}
+			key := w
+			if end == j+1 {
+				key += "."
+			}
+			m, isMonth := this.months[key]
+			d, isDay := this.days[key]
+			if isMonth || isDay {
+				if isMonth {
+					month = len(names)
+				}
+				names = append(names, name{i, end, m, d, isDay})
+				j = end
+				break
+			}
+		}
+		i = j
+	}
+
+	if len(names) == 0 {
+		return s, false
+	}
+
+	var b strings.Builder
+	last := 0
+	for i, n := range names {
+		b.WriteString(s[last:n.start])
+		if i == month || !n.isDay {
+			b.WriteString(n.month)
+		} else {
+			b.WriteString(n.day)
+		}
+		last = n.end
+	}
+	b.WriteString(s[last:])
+
+	return b.String(), true
+}
@@ -14,7 +14,11 @@
 
 package sequence
 
-import "fmt"
+import (
+	"fmt"
+	"net"
+	"strconv"
+)
 
 type (
 	// TagType is the semantic representation of a token.
@@ -29,12 +33,20 @@ type (
 // address, a URL, a mac address, an integer or a floating point number. In addition,
 // if the Scanner finds a token that's surrounded by %, e.g., %srcuser%, it will
 // try to determine the correct tag type the token represents.
+//
+// Start and End are the byte offsets of the token in the original message, so
+// message[Start:End] is the text the token came from. Tokens the scanner rewrites,
+// such as flattened json keys, keep the offsets of the original text, tokens that
+// are not in the message at all have an empty span. After parsing, tokens merged
+// by the +, *, - and until meta characters span all the tokens they consumed.
 type Token struct {
 	Type          TokenType // Type is the type of token the Value represents.
 	Tag           TagType   // Tag determines which tag the Value should be.
 	Value         string    // Value is the extracted string from the log message.
 	Special       string    // % is reserved for the tokens, if a literal contains one it must become a string, this also stores the regex index for the RegExTimeTag
 	IsSpaceBefore bool      // Is there token a space before this token
+	Start         int       // Start is the byte offset of the Value in the message.
+	End           int       // End is the byte offset just after the Value in the message.
 
 	isValue bool // Is this token a key in k=v pair
 	isKey   bool // Is this token a value in k=v pair
@@ -44,6 +56,8 @@ type Token struct {
 	star  bool // For parser, should this token consume zero or more tokens
 
 	until string // For parser, consume all tokens until, but not including, this string
+
+	constraint string // For parser, the /regex/ or {value|value} the token value must match
 }
 
 func (this Token) String() string {
@@ -60,11 +74,17 @@ const (
 	TokenFloat                      // Token is a floating point number
 	TokenURI                        // Token is an URL, in the form of http://... or https://...
 	TokenMac                        // Token is a mac address
+	TokenUUID                       // Token is an uuid, in the form of 8-4-4-4-12 hex digits
+	TokenHex                        // Token is a hex number, such as a hash digest or a git sha
+	TokenPath                       // Token is an absolute or relative file system path
+	TokenTimeSpan                   // Token is a time span with its unit, such as 153ms or 1h30m
+	TokenSize                       // Token is a size with its unit, such as 12.5MB
+	TokenPercent                    // Token is a percentage, such as 87%
+	TokenHost                       // Token is a host name, ending with a known top level domain
+	TokenEmail                      // Token is an email address
 	TokenString                     // Token is a string that represents multiple possible values
 	TokenMultiLine                  // Token represents every thing after the first \n in a message
 	token__END__                    // All tag types must be inserted before this one
-	token__host__                   // Token is a host name
-	token__email__                  // Token is an email address
 )
 
 var tokens = [...]struct {
@@ -79,14 +99,68 @@ var tokens = [...]struct {
 	{"float"},
 	{"uri"},
 	{"mac"},
+	{"uuid"},
+	{"hex"},
+	{"path"},
+	{"timespan"},
+	{"size"},
+	{"percent"},
+	{"host"},
+	{"email"},
 	{"string"},
 	{"multiline"},
 	{"token__END__"},
-	{"token__host__"},
-	{"token__email__"},
+}
+
+// TypedValue converts the Value according to the token type: int64 for TokenInteger,
+// float64 for TokenFloat, net.IP for TokenIPv4 and TokenIPv6, net.HardwareAddr for
+// TokenMac, time.Time for TokenTime, and float64 for TokenTimeSpan in seconds,
+// TokenSize in bytes and TokenPercent as a ratio. The values of the other types
+// are returned as strings.
+func (this Token) TypedValue() (interface{}, error) {
+	switch this.Type {
+	case TokenInteger:
+		i, err := strconv.ParseInt(this.Value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid integer %q: %v", this.Value, err)
+		}
+		return i, nil
+
+	case TokenFloat:
+		f, err := strconv.ParseFloat(this.Value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid float %q: %v", this.Value, err)
+		}
+		return f, nil
+
+	case TokenIPv4, TokenIPv6:
+		ip := net.ParseIP(this.Value)
+		if ip == nil {
+			return nil, fmt.Errorf("Invalid IP address %q", this.Value)
+		}
+		return ip, nil
+
+	case TokenMac:
+		mac, err := net.ParseMAC(this.Value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid mac address %q: %v", this.Value, err)
+		}
+		return mac, nil
+
+	case TokenTime:
+		return parseTime(this.Value)
+
+	case TokenTimeSpan, TokenSize, TokenPercent:
+		return quantityValue(this.Value, this.Type)
+	}
+
+	return this.Value, nil
 }
 
 func (this TokenType) String() string {
+	if ct := this.customToken(); ct != nil {
+		return ct.name
+	}
 	return tokens[this].label
 }
 
@@ -102,6 +176,29 @@ func (this TagType) TokenType() TokenType {
 	return TokenUnknown
 }
 
+// isText returns true for the token types of values that used to be scanned as
+// literals, such as uuids, paths, 153ms, host names or the custom types, which a %string%
+// pattern token matches.
+func (this TokenType) isText() bool {
+	switch this {
+	case TokenUUID, TokenHex, TokenPath, TokenTimeSpan, TokenSize, TokenPercent, TokenHost, TokenEmail:
+		return true
+	}
+	return this.isCustom()
+}
+
+// accepts returns true if a token of type t can be given a tag of this type. The
+// time spans and sizes can be plain numbers, in seconds and bytes.
+func (this TokenType) accepts(t TokenType) bool {
+	switch {
+	case this == t:
+		return true
+	case this == TokenTimeSpan || this == TokenSize:
+		return t == TokenInteger || t == TokenFloat
+	}
+	return false
+}
+
 func name2TokenType(s string) TokenType {
 	switch s {
 	case "tunknown":
@@ -122,19 +219,31 @@ func name2TokenType(s string) TokenType {
 		return TokenURI
 	case "mac":
 		return TokenMac
+	case "uuid":
+		return TokenUUID
+	case "hex":
+		return TokenHex
+	case "path":
+		return TokenPath
+	case "timespan":
+		return TokenTimeSpan
+	case "size":
+		return TokenSize
+	case "percent":
+		return TokenPercent
+	case "host":
+		return TokenHost
+	case "email":
+		return TokenEmail
 	case "string":
 		return TokenString
 	case "multiline":
 		return TokenMultiLine
 	case "token__END__":
 		return token__END__
-	case "token__host__":
-		return token__host__
-	case "token__email__":
-		return token__email__
 	}
 
-	return TokenUnknown
+	return name2CustomTokenType(s)
 }
 
 func name2TagType(s string) TagType {
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"math"
 	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
@@ -21,13 +22,28 @@ func ScanMessage(scanner *Scanner, data string, format string) (Sequence, bool,
 
 	if testJson(data) {
 		seq, isJson, err = scanner.ScanJson_Preserve(data)
+	} else if testXml(data) {
+		seq, isJson, err = scanner.ScanXml(data)
 	} else {
 		switch format {
 		case "json":
 			seq, isJson, err = scanner.ScanJson(data)
 
+		case "logfmt":
+			seq, isJson, err = scanner.ScanLogfmt(data)
+
+		case "cef":
+			seq, isJson, err = scanner.ScanCef(data)
+
+		case "leef":
+			seq, isJson, err = scanner.ScanLeef(data)
+
 		default:
-			seq, isJson, err = scanner.Scan(data, false, pos)
+			if start, end := embeddedJsonSpan(data); start > 0 {
+				seq, isJson, err = scanner.scanEmbeddedJson(data, start, end)
+			} else {
+				seq, isJson, err = scanner.Scan(data, false, pos)
+			}
 		}
 	}
 	return seq, isJson, err
@@ -93,13 +109,27 @@ func BuildParser(patfile string) *Parser {
 	return parser
 }
 
-func BuildParserFromDb(serviceid string) *Parser {
-	parser := NewParser()
-	scanner := NewScanner()
+//Builds the parser of the service from the patterns in the database. If cachedir is set, the
+//parser is saved to the file <serviceid>.seqp of the directory, and loaded from it the next time
+//if it has the same pattern ids as the database, as the ids change with the patterns.
+func BuildParserFromDb(serviceid string, cachedir string) *Parser {
 	db, ctx := OpenDbandSetContext()
 	defer db.Close()
 	//load all patterns from the database
 	pmap := GetPatternsFromDatabaseByService(db, ctx, serviceid)
+
+	var cache string
+	if cachedir != "" {
+		cache = filepath.Join(cachedir, serviceid+".seqp")
+		if parser, err := loadCachedParser(cache); err == nil && parser.hasPatternIds(pmap) {
+			return parser
+		} else if err != nil && !os.IsNotExist(err) {
+			logger.HandleError(fmt.Sprintf("Rebuilding the parser cache %s: %v", cache, err))
+		}
+	}
+
+	parser := NewParser()
+	scanner := NewScanner()
 	for _, ar := range pmap {
 		pos := SplitToInt(ar.TagPositions, ",")
 		seq, _, err := scanner.Scan(ar.Pattern, true, pos)
@@ -107,13 +137,132 @@ func BuildParserFromDb(serviceid string) *Parser {
 			logger.HandleError(fmt.Sprintf("%s, Service: %s, Pattern: %s", err.Error(), ar.Service.Name, ar.PatternId))
 		}
 
-		if err := parser.Add(seq); err != nil {
+		if err := parser.AddPattern(seq, ar.PatternId); err != nil {
 			logger.HandleError(fmt.Sprintf("%s, Service: %s, Pattern: %s", err.Error(), ar.Service.Name, ar.PatternId))
 		}
 	}
+
+	if cache != "" {
+		if err := parser.SaveToFile(cache); err != nil {
+			logger.HandleError(fmt.Sprintf("Unable to save the parser cache %s: %v", cache, err))
+		}
+	}
 	return parser
 }
 
+//Two patterns of the same service that both match some of the examples in the database.
+type CompetingPatterns struct {
+	Service      string
+	PatternId1   string
+	Pattern1     string
+	Score1       int
+	PatternId2   string
+	Pattern2     string
+	Score2       int
+	ExampleCount int
+	Example      string
+}
+
+//Finds the patterns in the database that compete for the same examples, by parsing the examples
+//of each service with all the matching patterns of the service.
+//The pairs are returned with the ones sharing the most examples first.
+func FindCompetingPatterns(format string) []CompetingPatterns {
+	db, ctx := OpenDbandSetContext()
+	defer db.Close()
+	//no complexity limit or threshold, we want all the patterns
+	pmap, _ := GetPatternsWithExamplesFromDatabase(db, ctx, 1, "", "0")
+
+	//the services and their patterns are sorted, so the report is the same from one run to the next
+	bysvc := make(map[string][]AnalyzerResult)
+	var svcs []string
+	for _, ar := range pmap {
+		if _, ok := bysvc[ar.Service.ID]; !ok {
+			svcs = append(svcs, ar.Service.ID)
+		}
+		bysvc[ar.Service.ID] = append(bysvc[ar.Service.ID], ar)
+	}
+	sort.Strings(svcs)
+
+	var result []CompetingPatterns
+	scanner := NewScanner()
+	for _, svc := range svcs {
+		ars := bysvc[svc]
+		sort.Slice(ars, func(i, j int) bool {
+			return ars[i].PatternId < ars[j].PatternId
+		})
+		parser := NewParser()
+		for _, ar := range ars {
+			pos := SplitToInt(ar.TagPositions, ",")
+			seq, _, err := scanner.Scan(ar.Pattern, true, pos)
+			if err != nil {
+				logger.HandleError(fmt.Sprintf("%s, Service: %s, Pattern: %s", err.Error(), ar.Service.Name, ar.PatternId))
+				continue
+			}
+			if err := parser.AddPattern(seq, ar.PatternId); err != nil {
+				logger.HandleError(fmt.Sprintf("%s, Service: %s, Pattern: %s", err.Error(), ar.Service.Name, ar.PatternId))
+			}
+		}
+
+		pairs := make(map[string]*CompetingPatterns)
+		var keys []string
+		for _, ar := range ars {
+			for _, ex := range ar.Examples {
+				seq, _, err := ScanMessage(scanner, ex.Message, format)
+				if err != nil {
+					continue
+				}
+				prs, err := parser.ParseAll(seq)
+				if err != nil {
+					continue
+				}
+				//a pattern can match on more than one path, the results are sorted so keep the first
+				var matched []ParseResult
+				seen := make(map[string]bool)
+				for _, pr := range prs {
+					if !seen[pr.PatternId] {
+						seen[pr.PatternId] = true
+						matched = append(matched, pr)
+					}
+				}
+				for i := 0; i < len(matched); i++ {
+					for j := i + 1; j < len(matched); j++ {
+						a, b := matched[i], matched[j]
+						if a.PatternId > b.PatternId {
+							a, b = b, a
+						}
+						key := a.PatternId + "," + b.PatternId
+						cp, ok := pairs[key]
+						if !ok {
+							cp = &CompetingPatterns{Service: ar.Service.Name, PatternId1: a.PatternId, Pattern1: a.Pattern, Score1: a.Score,
+								PatternId2: b.PatternId, Pattern2: b.Pattern, Score2: b.Score, Example: ex.Message}
+							pairs[key] = cp
+							keys = append(keys, key)
+						}
+						cp.ExampleCount++
+					}
+				}
+			}
+		}
+		for _, k := range keys {
+			result = append(result, *pairs[k])
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].ExampleCount != result[j].ExampleCount {
+			return result[i].ExampleCount > result[j].ExampleCount
+		}
+		if result[i].Service != result[j].Service {
+			return result[i].Service < result[j].Service
+		}
+		if result[i].PatternId1 != result[j].PatternId1 {
+			return result[i].PatternId1 < result[j].PatternId1
+		}
+		return result[i].PatternId2 < result[j].PatternId2
+	})
+	return result
+}
+
 //Calculate the threshold value to use when exporting patterns from the database.
 func getThreshold(numTotal int, typ string, val string) int {
 	if typ == "count" {
@@ -11,15 +11,17 @@ import (
 
 //input format
 //the in-format is for supporting a feed that has the service and the message provided.
-//this can be either txt or json
+//this can be either txt or json, or rfc3164 or rfc5424 for raw syslog lines
+//logfmt is read as txt, and the messages are scanned as logfmt
+//cef and leef are for the security events, the messages are scanned as such
 func ValidateInformat(informat string) string {
-	if (informat == "json") || (informat == "txt") {
+	switch informat {
+	case "json", "txt", "rfc3164", "rfc5424", "logfmt", "cef", "leef":
 		return ""
+	case "":
+		return "Input format is required for this method, please select either json, txt, logfmt, cef, leef, rfc3164 or rfc5424"
 	}
-	if informat == "" {
-		return "Input format is required for this method, please select either json or txt"
-	}
-	return informat + " is not a supported input format type, please select either json or txt"
+	return informat + " is not a supported input format type, please select either json, txt, logfmt, cef, leef, rfc3164 or rfc5424"
 }
 
 //output format
@@ -0,0 +1,243 @@
+package sequence
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//ScanXml returns a Sequence, or a list of tokens, for the XML string supplied. Like ScanJson,
+//it flattens the message into key=value pairs:
+//   - the keys are the paths of the elements, with the names separated by ".", so
+//   		<Event><System><EventID>4625</EventID></System></Event>
+//     will be returned as
+//   		Event.System.EventID=4625
+//   - the attributes are keys under their element, so <Provider Name="Security"/> in
+//     System is Event.System.Provider.Name=Security
+//   - the elements with the same name in an element are numbered from the second one,
+//     Data, Data.1, Data.2 and so on
+//   - the Data elements of the Windows events are keyed by their Name attribute, so
+//     <EventData><Data Name="TargetUserName">bob</Data></EventData> in Event is
+//     Event.EventData.TargetUserName=bob
+//   - the values are typed tokens, the literal values and the texts with spaces being strings
+//   - the texts of an element with mixed content, such as <a>text <b>x</b> more</a>, are
+//     joined with a space into one value, a=text more, spanning from the first text to the
+//     last one in the message
+//   - the empty elements and attributes, the namespace declarations, the comments and
+//     the processing instructions are skipped
+//
+//The pairs are sorted by key, so the messages with the same element paths have the same
+//sequence, and the parser groups their patterns. The sequence is structured, so the returned
+//bool is true.
+func (this *Scanner) ScanXml(s string) (Sequence, bool, error) {
+	this.msg.Data = s
+	this.msg.reset()
+	this.seq = this.seq[:0]
+
+	type element struct {
+		path       string
+		seen       map[string]int
+		text       []string
+		start, end int
+	}
+
+	type pair struct {
+		key   string
+		value Token
+	}
+
+	var (
+		stack []element
+		pairs []pair
+		root  bool
+		prev  int
+		val   = &Message{}
+		d     = xml.NewDecoder(strings.NewReader(s))
+	)
+
+	add := func(key, value string, start, end int) {
+		pairs = append(pairs, pair{key, Token{
+			Tag:     TagUnknown,
+			Type:    val.valueType(value),
+			Value:   value,
+			Start:   start,
+			End:     end,
+			isValue: true,
+		}})
+	}
+
+	for {
+		t, err := d.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, true, fmt.Errorf("Invalid message. %v", err)
+		}
+		off := int(d.InputOffset())
+
+		switch t := t.(type) {
+		case xml.StartElement:
+			path, named := t.Name.Local, xmlDataName(t)
+			if named != "" {
+				path = named
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				n := parent.seen[path]
+				parent.seen[path] = n + 1
+				path = parent.path + "." + path
+				if n > 0 {
+					path += "." + strconv.Itoa(n)
+				}
+			} else if root {
+				return nil, true, fmt.Errorf("Invalid message. Expecting one root element, got %q.", t.Name.Local)
+			}
+			root = true
+			stack = append(stack, element{path: path, seen: make(map[string]int)})
+
+			for _, a := range t.Attr {
+				if a.Name.Space == "xmlns" || a.Name.Local == "xmlns" || a.Value == "" || (named != "" && a.Name.Local == "Name") {
+					continue
+				}
+				start, end := xmlAttrSpan(s[prev:off], a.Name.Local)
+				add(path+"."+a.Name.Local, a.Value, prev+start, prev+end)
+			}
+
+		case xml.EndElement:
+			e := stack[len(stack)-1]
+			if len(e.text) > 0 {
+				add(e.path, strings.Join(e.text, " "), e.start, e.end)
+			}
+			stack = stack[:len(stack)-1]
+
+		case xml.CharData:
+			text := strings.TrimSpace(string(t))
+			if text == "" {
+				continue
+			}
+			if len(stack) == 0 {
+				return nil, true, fmt.Errorf("Invalid message. Expecting an element, got %q.", text)
+			}
+			raw := s[prev:off]
+			e := &stack[len(stack)-1]
+			if len(e.text) == 0 {
+				e.start = prev + len(raw) - len(strings.TrimLeft(raw, " \t\r\n"))
+			}
+			e.end = prev + len(strings.TrimRight(raw, " \t\r\n"))
+			e.text = append(e.text, text)
+		}
+		prev = off
+	}
+
+	if !root {
+		return nil, true, fmt.Errorf("Invalid message. Expecting an XML element.")
+	}
+
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return pairs[i].key < pairs[j].key
+	})
+
+	// the key and "=" are not in the message, so they get an empty span at the
+	// start of the value
+	for i, p := range pairs {
+		this.insertToken(Token{Tag: TagUnknown, Type: TokenLiteral, Value: p.key, Start: p.value.Start, End: p.value.Start, isKey: true, IsSpaceBefore: config.markSpaces && i > 0})
+		this.insertToken(Token{Tag: TagUnknown, Type: TokenLiteral, Value: "=", Start: p.value.Start, End: p.value.Start})
+		this.insertToken(p.value)
+	}
+
+	return this.seq, true, nil
+}
+
+//xmlDataName returns the Name attribute of a Data element, empty for the other elements.
+func xmlDataName(t xml.StartElement) string {
+	if t.Name.Local != "Data" {
+		return ""
+	}
+	for _, a := range t.Attr {
+		if a.Name.Local == "Name" && a.Name.Space == "" && !strings.ContainsAny(a.Value, ". \t\r\n") {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+//IsXmlPattern returns true if the examples of the result are XML messages. The keys of their
+//patterns are the paths of the elements, which are not in the messages, so the patterns are
+//not exported to the patterndb or grok.
+func IsXmlPattern(ar AnalyzerResult) bool {
+	for _, ex := range ar.Examples {
+		if testXml(ex.Message) {
+			return true
+		}
+	}
+	return false
+}
+
+//xmlAttrSpan returns the start and end of the value of the attribute in the raw start tag.
+func xmlAttrSpan(tag, name string) (int, int) {
+	for i := 0; i < len(tag); {
+		j := strings.Index(tag[i:], name)
+		if j < 0 {
+			break
+		}
+		j += i
+		i = j + len(name)
+
+		// the name must be a whole word followed by =
+		if j == 0 || (tag[j-1] != ' ' && tag[j-1] != ':' && tag[j-1] != '\t' && tag[j-1] != '\n') {
+			continue
+		}
+		k := i
+		for k < len(tag) && (tag[k] == ' ' || tag[k] == '\t' || tag[k] == '\n' || tag[k] == '\r') {
+			k++
+		}
+		if k >= len(tag) || tag[k] != '=' {
+			continue
+		}
+		k++
+		for k < len(tag) && (tag[k] == ' ' || tag[k] == '\t' || tag[k] == '\n' || tag[k] == '\r') {
+			k++
+		}
+		if k < len(tag) && (tag[k] == '"' || tag[k] == '\'') {
+			if e := strings.IndexByte(tag[k+1:], tag[k]); e >= 0 {
+				return k + 1, k + 1 + e
+			}
+		}
+	}
+	return 0, 0
+}
+
+func testXml(data string) bool {
+	data = strings.TrimSpace(data)
+	if len(data) < 4 || data[0] != '<' || data[len(data)-1] != '>' {
+		return false
+	}
+
+	// the message is XML if it is a single well formed element
+	d := xml.NewDecoder(strings.NewReader(data))
+	depth, roots := 0, 0
+	for {
+		t, err := d.Token()
+		if err == io.EOF {
+			return roots == 1 && depth == 0
+		} else if err != nil {
+			return false
+		}
+		switch t := t.(type) {
+		case xml.StartElement:
+			if depth == 0 {
+				roots++
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+		case xml.CharData:
+			if depth == 0 && strings.TrimSpace(string(t)) != "" {
+				return false
+			}
+		}
+	}
+}